@@ -9,6 +9,7 @@ import (
 	"github.com/labstack/echo/v4"
 	"github.com/rs/zerolog/log"
 	"github.com/xifanyan/ediscovery-data-service/config"
+	"github.com/xifanyan/ediscovery-data-service/logging"
 )
 
 type UserInfo struct {
@@ -16,12 +17,41 @@ type UserInfo struct {
 	Roles map[string]struct{}
 }
 
-func UserAuthMiddleware(cfg config.Config) echo.MiddlewareFunc {
+// publicRoutes are the route paths served without USER and ADP headers.
+// They are registered while setting up the router, before serving starts.
+var publicRoutes = map[string]struct{}{}
+
+// Public marks a route path as served without USER and ADP headers and returns
+// it, so it can wrap the path where the route is registered.
+func Public(path string) string {
+	publicRoutes[path] = struct{}{}
+	return path
+}
+
+func isPublic(c echo.Context) bool {
+	_, ok := publicRoutes[c.Path()]
+	return ok
+}
+
+// UserAuthMiddleware authenticates the USER header against the roles of the
+// live config, so reloaded role aliases apply to the next request.
+func UserAuthMiddleware(live *config.Live) echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
+			if isPublic(c) {
+				return next(c)
+			}
+
+			cfg := live.Config()
+
 			// expecting the user header to be in the format "username:role1,role2,role3"
 			userHeader := c.Request().Header.Get("USER")
-			log.Debug().Msgf("User Info: %s", userHeader)
+
+			// a client certificate mapped to a user takes the place of the header
+			if identity, ok := clientCertUser(cfg, c.Request()); ok {
+				userHeader = identity
+			}
+			logging.From(c).Debug().Msgf("User Info: %s", userHeader)
 
 			// Trim whitespace and check if header is empty
 			userHeader = strings.TrimSpace(userHeader)
@@ -41,6 +71,7 @@ func UserAuthMiddleware(cfg config.Config) echo.MiddlewareFunc {
 
 			// Set the parsed username in the context for potential use in subsequent handlers
 			c.Set("user", userInfo.Name)
+			c.Set("roles", userInfo.Roles)
 			return next(c)
 		}
 	}
@@ -51,7 +82,11 @@ func UserAuthMiddleware(cfg config.Config) echo.MiddlewareFunc {
 func ADPAuthMiddleware(cfg config.Config) echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
-			log.Debug().Msg("ADP Auth Middleware processing request")
+			if isPublic(c) {
+				return next(c)
+			}
+
+			logging.From(c).Debug().Msg("ADP Auth Middleware processing request")
 
 			// Extract ADP credentials from headers
 			adpToken := c.Request().Header.Get("ADP")
@@ -61,26 +96,44 @@ func ADPAuthMiddleware(cfg config.Config) echo.MiddlewareFunc {
 
 			decoded, err := base64.StdEncoding.DecodeString(adpToken)
 			if err != nil {
-				log.Warn().Err(err).Msg("Error decoding ADP token")
+				logging.From(c).Warn().Err(err).Msg("Error decoding ADP token")
 				return echo.NewHTTPError(http.StatusBadRequest, "Error decoding ADP token")
 			}
 
 			items := strings.Split(string(decoded), ":")
 			if len(items) != 2 {
-				log.Warn().Msg("Invalid ADP token format")
+				logging.From(c).Warn().Msg("Invalid ADP token format")
 				return echo.NewHTTPError(http.StatusBadRequest, "Invalid ADP token format")
 			}
 
 			c.Set("adp_user", items[0])
 			c.Set("adp_password", items[1])
 
-			log.Debug().Msg("ADP token set in context")
+			logging.From(c).Debug().Msg("ADP token set in context")
 
 			return next(c)
 		}
 	}
 }
 
+// clientCertUser returns the USER identity echo.tls.clientUsers maps the
+// verified client certificate to, looking up its full subject first and its
+// common name after.
+func clientCertUser(cfg config.Config, req *http.Request) (string, bool) {
+	if req.TLS == nil || len(req.TLS.VerifiedChains) == 0 || len(req.TLS.VerifiedChains[0]) == 0 {
+		return "", false
+	}
+
+	subject := req.TLS.VerifiedChains[0][0].Subject
+	if identity, ok := cfg.Echo.TLS.ClientUsers[subject.String()]; ok {
+		return identity, true
+	}
+	if identity, ok := cfg.Echo.TLS.ClientUsers[subject.CommonName]; ok && subject.CommonName != "" {
+		return identity, true
+	}
+	return "", false
+}
+
 func isCaseManager(cfg config.Config, userInfo UserInfo) bool {
 	for role := range userInfo.Roles {
 		m := cfg.RoleMap["CaseManager"]
@@ -7,10 +7,22 @@ import (
 )
 
 func NewADPClient(cfg config.Config) *adp.Client {
+	return NewClient(cfg.ADP.Domain, cfg.ADP.Port, cfg.ADP.User, cfg.ADP.Password)
+}
+
+// NewBackendClient returns a client of one of the adpBackends.
+func NewBackendClient(b config.ADPBackend) *adp.Client {
+	return NewClient(b.Domain, b.Port, b.User, b.Password)
+}
+
+// NewClient returns a client of the ADP instance at domain and port that calls
+// it as user. Clients are never given other credentials once built, a request
+// with its own ADP credentials gets its own client.
+func NewClient(domain string, port int, user string, password string) *adp.Client {
 	return adp.NewClientBuilder().
-		WithDomain(cfg.ADP.Domain).
-		WithPort(cfg.ADP.Port).
-		WithUser(cfg.ADP.User).
-		WithPassword(cfg.ADP.Password).
+		WithDomain(domain).
+		WithPort(port).
+		WithUser(user).
+		WithPassword(password).
 		Build()
 }
@@ -1,21 +1,25 @@
 package config
 
 import (
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"os"
+	"strconv"
 	"strings"
 
 	"github.com/rs/zerolog/log"
+	"gopkg.in/yaml.v3"
 )
 
 type Config struct {
 	ADP struct {
 		Domain   string `json:"domain"`
 		User     string `json:"user"`
-		Password string `json:"password"`
+		Password string `json:"password" secret:"true"`
 		Port     int    `json:"port"`
 	} `json:"adp"`
+	ADPBackends  map[string]ADPBackend `json:"adpBackends"`
 	SearchWebAPI struct {
 		Domain   string `json:"domain"`
 		Port     int    `json:"port"`
@@ -24,32 +28,272 @@ type Config struct {
 	Echo struct {
 		Host string `json:"host"`
 		Port int    `json:"port"`
+		TLS  TLS    `json:"tls"`
 	} `json:"echo"`
 	Log struct {
 		Level   string `json:"level"`
 		Path    string `json:"path"`
 		Console bool   `json:"console"`
+	} `json:"log"`
+	Roles      map[string]string              `json:"roles"`
+	RoleMap    map[string]map[string]struct{} `json:"-"`
+	Categories map[string]Category            `json:"categories"`
+	Drift      struct {
+		Baselines string `json:"baselines"`
+		Interval  string `json:"interval"`
+		Checks    []struct {
+			Application string `json:"application"`
+			Baseline    string `json:"baseline"`
+		} `json:"checks"`
+	} `json:"drift"`
+	Tracing struct {
+		Exporter    string `json:"exporter"`
+		Endpoint    string `json:"endpoint"`
+		Insecure    bool   `json:"insecure"`
+		File        string `json:"file"`
+		ServiceName string `json:"serviceName"`
+	} `json:"tracing"`
+	Health struct {
+		ProbeTimeout  string `json:"probeTimeout"`
+		ProbeCacheTTL string `json:"probeCacheTTL"`
+	} `json:"health"`
+	Cache struct {
+		TTL map[string]string `json:"ttl"`
+	} `json:"cache"`
+	Resilience struct {
+		Timeout         string            `json:"timeout"`
+		Timeouts        map[string]string `json:"timeouts"`
+		Retries         int               `json:"retries"`
+		Backoff         string            `json:"backoff"`
+		MaxBackoff      string            `json:"maxBackoff"`
+		BreakerFailures int               `json:"breakerFailures"`
+		BreakerCooldown string            `json:"breakerCooldown"`
+	} `json:"resilience"`
+	Limits struct {
+		User         RateLimit            `json:"user"`
+		Roles        map[string]RateLimit `json:"roles"`
+		Routes       map[string]RateLimit `json:"routes"`
+		Concurrency  map[string]int       `json:"concurrency"`
+		QueueTimeout string               `json:"queueTimeout"`
+	} `json:"limits"`
+	Reload struct {
+		Watch    bool   `json:"watch"`
+		Interval string `json:"interval"`
+	} `json:"reload"`
+	Shutdown struct {
+		Timeout     string `json:"timeout"`
+		StopTimeout string `json:"stopTimeout"`
+		Checkpoints string `json:"checkpoints"`
+	} `json:"shutdown"`
+	Ingestion struct {
+		Records string `json:"records"`
+	} `json:"ingestion"`
+	Taggers struct {
+		Records string `json:"records"`
+	} `json:"taggers"`
+	Idempotency struct {
+		Store  string `json:"store"`
+		Window string `json:"window"`
+	} `json:"idempotency"`
+	Provisioning struct {
+		Runs string `json:"runs"`
+	} `json:"provisioning"`
+	Applications struct {
+		DecommissionRecords string `json:"decommissionRecords"`
+	} `json:"applications"`
+	LegalHold struct {
+		Store         string `json:"store"`
+		BaseURL       string `json:"baseURL"`
+		SigningKey    string `json:"signingKey" secret:"true"`
+		CheckInterval string `json:"checkInterval"`
+		ReminderAfter string `json:"reminderAfter"`
+		EscalateAfter string `json:"escalateAfter"`
+		EscalateTo    string `json:"escalateTo"`
+		LinkValidity  string `json:"linkValidity"`
+		SMTP          struct {
+			Host     string `json:"host"`
+			Port     int    `json:"port"`
+			User     string `json:"user"`
+			Password string `json:"password" secret:"true"`
+			From     string `json:"from"`
+		} `json:"smtp"`
+	} `json:"legalHold"`
+}
+
+const (
+	// DefaultADPBackend names the ADP instance of the adp section.
+	DefaultADPBackend = "default"
+	// AllADPBackends selects every backend for the listings that merge the
+	// entities of all of them.
+	AllADPBackends = "all"
+)
+
+// ADPBackend is an ADP instance besides the one of the adp section, e.g. one
+// per region. Requests are routed to it by the ADP-Backend header, by the
+// prefix of their application ID or by their workspace. Its settings are read
+// from EDS_ADPBACKENDS_<NAME>_ variables as well, e.g. the password from
+// EDS_ADPBACKENDS_EMEA_PASSWORD_FILE.
+type ADPBackend struct {
+	Domain              string   `json:"domain"`
+	User                string   `json:"user"`
+	Password            string   `json:"password" secret:"true"`
+	Port                int      `json:"port"`
+	ApplicationPrefixes []string `json:"applicationPrefixes"`
+	Workspaces          []string `json:"workspaces"`
+}
+
+// RateLimit is a token bucket refilled at Rate, a number of requests per
+// second, minute or hour such as "10/s" or "300/m", holding up to Burst
+// requests. An empty Rate does not limit.
+type RateLimit struct {
+	Rate  string `json:"rate"`
+	Burst int    `json:"burst"`
+}
+
+// PerSecond returns the rate in requests per second, 0 if unlimited.
+func (r RateLimit) PerSecond() (float64, error) {
+	if r.Rate == "" {
+		return 0, nil
+	}
+
+	n, unit, ok := strings.Cut(r.Rate, "/")
+	count, err := strconv.ParseFloat(strings.TrimSpace(n), 64)
+	if !ok || err != nil || count <= 0 {
+		return 0, fmt.Errorf("%q is not a rate such as 10/s or 300/m", r.Rate)
+	}
+
+	switch strings.TrimSpace(unit) {
+	case "s":
+		return count, nil
+	case "m":
+		return count / 60, nil
+	case "h":
+		return count / 3600, nil
+	default:
+		return 0, fmt.Errorf("%q is not a rate such as 10/s or 300/m", r.Rate)
 	}
-	Roles   map[string]string `json:"roles"`
-	RoleMap map[string]map[string]struct{}
 }
 
-func LoadConfig(name string) (Config, error) {
-	f, err := os.Open(name)
+// TLS configures HTTPS, served with the certificate and key. With a
+// client CA, client certificates signed by it are verified, and required with
+// clientAuth "require". ClientUsers maps client certificate subjects, or their
+// common names, to a USER identity in the USER header format
+// "username:role1,role2". The files are reloaded when they change.
+type TLS struct {
+	Cert           string            `json:"cert"`
+	Key            string            `json:"key"`
+	ClientCA       string            `json:"clientCA"`
+	ClientAuth     string            `json:"clientAuth"`
+	ClientUsers    map[string]string `json:"clientUsers"`
+	MinVersion     string            `json:"minVersion"`
+	CipherSuites   []string          `json:"cipherSuites"`
+	ReloadInterval string            `json:"reloadInterval"`
+}
+
+// Enabled reports whether HTTPS is configured.
+func (t TLS) Enabled() bool {
+	return t.Cert != "" || t.Key != ""
+}
+
+// Version returns the minimum TLS version, TLS 1.2 unless set to "1.3".
+func (t TLS) Version() (uint16, error) {
+	switch t.MinVersion {
+	case "", "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	default:
+		return 0, fmt.Errorf("echo.tls.minVersion %q is not supported, use 1.2 or 1.3", t.MinVersion)
+	}
+}
+
+// Ciphers returns the IDs of the cipher suites, or nil for the Go defaults.
+// Only suites Go considers secure are accepted. They apply to TLS 1.2, the
+// TLS 1.3 suites are not configurable.
+func (t TLS) Ciphers() ([]uint16, error) {
+	if len(t.CipherSuites) == 0 {
+		return nil, nil
+	}
+
+	known := make(map[string]uint16)
+	for _, suite := range tls.CipherSuites() {
+		known[suite.Name] = suite.ID
+	}
+
+	var ids []uint16
+	for _, name := range t.CipherSuites {
+		id, ok := known[name]
+		if !ok {
+			return nil, fmt.Errorf("%q is not a secure cipher suite", name)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// Category maps a friendly category type used in the API to the ADP category.
+// ID is the internal category ID used to read the values, Name is the category
+// name used to create or update a value.
+type Category struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// defaultCategories are the category types known without any configuration.
+// Entries in the config file with the same key replace them.
+var defaultCategories = map[string]Category{
+	"redactionReason": {ID: "rmRedactReason", Name: "Redaction Reason"},
+	"custodian":       {Name: "Custodian"},
+}
+
+// LoadConfig builds the config in layers: the JSON or YAML file, then the
+// EDS_ environment variables, then the path=value overrides given on the
+// command line. See Getenv and Set for the names.
+func LoadConfig(name string, overrides ...string) (Config, error) {
+	doc, err := os.ReadFile(name)
 	if err != nil {
 		return Config{}, fmt.Errorf("failed to open config file: %v", err)
 	}
-	defer f.Close()
 
-	var cfg Config
-	err = json.NewDecoder(f).Decode(&cfg)
+	// the file is decoded as YAML, which JSON is a subset of, and then mapped
+	// onto the config through JSON so both formats share the same field names
+	var raw interface{}
+	if err := yaml.Unmarshal(doc, &raw); err != nil {
+		return Config{}, fmt.Errorf("failed to parse config file %s: %v", name, err)
+	}
+
+	js, err := json.Marshal(raw)
 	if err != nil {
-		return Config{}, fmt.Errorf("failed to parse config file: %v", err)
+		return Config{}, fmt.Errorf("failed to parse config file %s: %v", name, err)
+	}
+
+	// unknown keys are ignored, the config file keeps disabled settings under
+	// names such as "_domain"
+	var cfg Config
+	if err := json.Unmarshal(js, &cfg); err != nil {
+		return Config{}, fmt.Errorf("failed to parse config file %s: %v", name, err)
+	}
+
+	if err := cfg.applyEnv(os.LookupEnv); err != nil {
+		return Config{}, err
+	}
+
+	for _, override := range overrides {
+		path, value, ok := strings.Cut(override, "=")
+		if !ok {
+			return Config{}, fmt.Errorf("invalid override %q, use path=value", override)
+		}
+		if err := cfg.Set(path, value); err != nil {
+			return Config{}, err
+		}
 	}
 
 	cfg.RoleMap = getRoleMap(cfg.Roles)
 	log.Debug().Msgf("cfg.RoleMap: %+v", cfg.RoleMap)
 
+	cfg.Categories = getCategories(cfg.Categories)
+	log.Debug().Msgf("cfg.Categories: %+v", cfg.Categories)
+
 	return cfg, nil
 }
 
@@ -85,6 +329,18 @@ func getRoleMap(m map[string]string) map[string]map[string]struct{} {
 	return roleMap
 }
 
+// getCategories merges the configured category types over the default ones.
+func getCategories(m map[string]Category) map[string]Category {
+	categories := make(map[string]Category, len(defaultCategories)+len(m))
+	for k, v := range defaultCategories {
+		categories[k] = v
+	}
+	for k, v := range m {
+		categories[k] = v
+	}
+	return categories
+}
+
 func (cfg Config) EchoAddress() string {
 	return fmt.Sprintf("%s:%d", cfg.Echo.Host, cfg.Echo.Port)
 }
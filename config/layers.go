@@ -0,0 +1,262 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	envPrefix = "EDS_"
+
+	// redacted replaces the secrets in Redacted
+	redacted = "REDACTED"
+)
+
+// setting is a string, number, flag, list or string map of the config,
+// addressed by the path of its JSON names, e.g. "echo.tls.minVersion".
+type setting struct {
+	path   string
+	value  reflect.Value
+	secret bool
+}
+
+// settings lists the settings of v, a pointer to the config or a part of it.
+// Lists and maps of sections, such as drift.checks, can only be set in the file.
+func settings(v reflect.Value, prefix string, secret bool) []setting {
+	var res []setting
+
+	v = reflect.Indirect(v)
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" || !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		path := name
+		if prefix != "" {
+			path = prefix + "." + name
+		}
+		isSecret := secret || f.Tag.Get("secret") == "true"
+
+		fv := v.Field(i)
+		switch {
+		case fv.Kind() == reflect.Struct:
+			res = append(res, settings(fv, path, isSecret)...)
+		case settable(fv.Type()):
+			res = append(res, setting{path: path, value: fv, secret: isSecret})
+		}
+	}
+
+	return res
+}
+
+func settable(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.String, reflect.Int, reflect.Bool:
+		return true
+	case reflect.Slice:
+		return t.Elem().Kind() == reflect.String
+	case reflect.Map:
+		return t.Key().Kind() == reflect.String && t.Elem().Kind() == reflect.String
+	}
+	return false
+}
+
+// backendSettings calls fn with the settings of every backend of adpBackends,
+// addressed as "adpBackends.<name>.password", and stores what fn changed
+// back into the map, as the backends are a map of sections.
+func (cfg *Config) backendSettings(fn func(settings []setting) error) error {
+	for name, b := range cfg.ADPBackends {
+		if err := fn(settings(reflect.ValueOf(&b), "adpBackends."+name, false)); err != nil {
+			return err
+		}
+		cfg.ADPBackends[name] = b
+	}
+	return nil
+}
+
+// envName is the environment variable of a setting: EDS_ and the path in
+// upper case with "_" for "." and "-", e.g. EDS_ECHO_TLS_MINVERSION or
+// EDS_ADPBACKENDS_EU_WEST_PASSWORD.
+func envName(path string) string {
+	return envPrefix + strings.ToUpper(strings.NewReplacer(".", "_", "-", "_").Replace(path))
+}
+
+// applyEnv sets the settings given in EDS_ environment variables. A variable
+// with the suffix _FILE names a file to read the value from, such as a Docker
+// or Kubernetes secret, e.g. EDS_ADP_PASSWORD_FILE=/run/secrets/adp_password.
+// Lists are comma separated and string maps are "key=value" pairs separated
+// by commas. The backends of the config file read theirs by name, e.g.
+// EDS_ADPBACKENDS_EMEA_PASSWORD_FILE.
+func (cfg *Config) applyEnv(lookup func(string) (string, bool)) error {
+	if err := applyEnvSettings(settings(reflect.ValueOf(cfg), "", false), lookup); err != nil {
+		return err
+	}
+	return cfg.backendSettings(func(settings []setting) error {
+		return applyEnvSettings(settings, lookup)
+	})
+}
+
+func applyEnvSettings(settings []setting, lookup func(string) (string, bool)) error {
+	for _, s := range settings {
+		name := envName(s.path)
+
+		value, ok := lookup(name)
+		if file, fromFile := lookup(name + "_FILE"); fromFile {
+			if ok {
+				return fmt.Errorf("both %s and %s_FILE are set", name, name)
+			}
+
+			b, err := os.ReadFile(file)
+			if err != nil {
+				return fmt.Errorf("failed to read %s_FILE: %v", name, err)
+			}
+			value, ok = strings.TrimRight(string(b), "\r\n"), true
+		}
+		if !ok {
+			continue
+		}
+
+		if err := setValue(s.value, value); err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// Set sets the setting at path, e.g. "adp.port" to "443". A key of a string
+// map is set with the path of the map and the key, e.g. "roles.CaseManager".
+// A setting of a backend of the config file is set with its name, e.g.
+// "adpBackends.emea.port".
+func (cfg *Config) Set(path string, value string) error {
+	if strings.HasPrefix(path, "adpBackends.") {
+		found := false
+		err := cfg.backendSettings(func(settings []setting) error {
+			for _, s := range settings {
+				if s.path == path {
+					found = true
+					return setValue(s.value, value)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		if !found {
+			return fmt.Errorf("unknown config setting %q", path)
+		}
+		return nil
+	}
+
+	for _, s := range settings(reflect.ValueOf(cfg), "", false) {
+		if s.path == path {
+			if err := setValue(s.value, value); err != nil {
+				return fmt.Errorf("%s: %v", path, err)
+			}
+			return nil
+		}
+
+		if key, ok := strings.CutPrefix(path, s.path+"."); ok && s.value.Kind() == reflect.Map {
+			if s.value.IsNil() {
+				s.value.Set(reflect.MakeMap(s.value.Type()))
+			}
+			s.value.SetMapIndex(reflect.ValueOf(key), reflect.ValueOf(value))
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown config setting %q", path)
+}
+
+func setValue(v reflect.Value, value string) error {
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(value)
+	case reflect.Int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%q is not a number", value)
+		}
+		v.SetInt(int64(n))
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%q is not true or false", value)
+		}
+		v.SetBool(b)
+	case reflect.Slice:
+		var list []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		v.Set(reflect.ValueOf(list))
+	case reflect.Map:
+		m := make(map[string]string)
+		for _, pair := range strings.Split(value, ",") {
+			if pair = strings.TrimSpace(pair); pair == "" {
+				continue
+			}
+			k, val, ok := strings.Cut(pair, "=")
+			if !ok {
+				return fmt.Errorf("%q is not a key=value pair", pair)
+			}
+			m[strings.TrimSpace(k)] = strings.TrimSpace(val)
+		}
+		v.Set(reflect.ValueOf(m))
+	}
+	return nil
+}
+
+// Redacted returns a copy of the config with the secrets replaced, to be
+// printed or logged.
+func (cfg Config) Redacted() Config {
+	for _, s := range settings(reflect.ValueOf(&cfg), "", false) {
+		if s.secret && s.value.Kind() == reflect.String && s.value.String() != "" {
+			s.value.SetString(redacted)
+		}
+	}
+
+	// the map of backends is shared with the config it was copied from
+	if cfg.ADPBackends != nil {
+		backends := make(map[string]ADPBackend, len(cfg.ADPBackends))
+		for name, b := range cfg.ADPBackends {
+			backends[name] = b
+		}
+		cfg.ADPBackends = backends
+	}
+	cfg.backendSettings(func(settings []setting) error {
+		for _, s := range settings {
+			if s.secret && s.value.Kind() == reflect.String && s.value.String() != "" {
+				s.value.SetString(redacted)
+			}
+		}
+		return nil
+	})
+	return cfg
+}
+
+// EnvNames lists the environment variables the config reads, sorted.
+func EnvNames() []string {
+	var cfg Config
+
+	var names []string
+	for _, s := range settings(reflect.ValueOf(&cfg), "", false) {
+		names = append(names, envName(s.path))
+	}
+	for _, s := range settings(reflect.ValueOf(&ADPBackend{}), "adpBackends.<name>", false) {
+		names = append(names, envName(s.path))
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,101 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func lookupMap(env map[string]string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		v, ok := env[name]
+		return v, ok
+	}
+}
+
+func TestApplyEnvBackends(t *testing.T) {
+	secret := filepath.Join(t.TempDir(), "emea_password")
+	if err := os.WriteFile(secret, []byte("from-file\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		env     map[string]string
+		want    ADPBackend
+		wantErr string
+	}{
+		{
+			name: "password",
+			env:  map[string]string{"EDS_ADPBACKENDS_EU_WEST_PASSWORD": "from-env"},
+			want: ADPBackend{Domain: "adp-eu.example.com", Port: 8443, User: "svc", Password: "from-env"},
+		},
+		{
+			name: "password file",
+			env:  map[string]string{"EDS_ADPBACKENDS_EU_WEST_PASSWORD_FILE": secret},
+			want: ADPBackend{Domain: "adp-eu.example.com", Port: 8443, User: "svc", Password: "from-file"},
+		},
+		{
+			name: "port and prefixes",
+			env:  map[string]string{"EDS_ADPBACKENDS_EU_WEST_PORT": "443", "EDS_ADPBACKENDS_EU_WEST_APPLICATIONPREFIXES": "documentHold.EU_,axcelerate.EU_"},
+			want: ADPBackend{Domain: "adp-eu.example.com", Port: 443, User: "svc", ApplicationPrefixes: []string{"documentHold.EU_", "axcelerate.EU_"}},
+		},
+		{
+			name:    "password and file",
+			env:     map[string]string{"EDS_ADPBACKENDS_EU_WEST_PASSWORD": "x", "EDS_ADPBACKENDS_EU_WEST_PASSWORD_FILE": secret},
+			wantErr: "both EDS_ADPBACKENDS_EU_WEST_PASSWORD and EDS_ADPBACKENDS_EU_WEST_PASSWORD_FILE are set",
+		},
+		{
+			name:    "invalid port",
+			env:     map[string]string{"EDS_ADPBACKENDS_EU_WEST_PORT": "https"},
+			wantErr: "EDS_ADPBACKENDS_EU_WEST_PORT",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Config{ADPBackends: map[string]ADPBackend{
+				"eu-west": {Domain: "adp-eu.example.com", Port: 8443, User: "svc"},
+			}}
+
+			err := cfg.applyEnv(lookupMap(tt.env))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("applyEnv() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("applyEnv() error = %v", err)
+			}
+
+			got := cfg.ADPBackends["eu-west"]
+			if got.Domain != tt.want.Domain || got.Port != tt.want.Port || got.User != tt.want.User ||
+				got.Password != tt.want.Password || strings.Join(got.ApplicationPrefixes, ",") != strings.Join(tt.want.ApplicationPrefixes, ",") {
+				t.Errorf("adpBackends.eu-west = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBackendSetAndRedacted(t *testing.T) {
+	cfg := Config{ADPBackends: map[string]ADPBackend{"emea": {Domain: "adp-emea.example.com", Password: "secret"}}}
+
+	if err := cfg.Set("adpBackends.emea.port", "8443"); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.ADPBackends["emea"].Port != 8443 {
+		t.Errorf("adpBackends.emea.port = %d", cfg.ADPBackends["emea"].Port)
+	}
+	if err := cfg.Set("adpBackends.apac.port", "8443"); err == nil {
+		t.Error("Set() of an unknown backend succeeded")
+	}
+
+	if got := cfg.Redacted().ADPBackends["emea"].Password; got != redacted {
+		t.Errorf("redacted password = %q", got)
+	}
+	if cfg.ADPBackends["emea"].Password != "secret" {
+		t.Error("Redacted() changed the config it was called on")
+	}
+}
@@ -0,0 +1,228 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const defaultReloadInterval = 10 * time.Second
+
+// hotSettings are the settings applied by a reload. Changes to any other
+// setting are reported as pending until the service is restarted.
+var hotSettings = []string{"roles", "log.level", "cache.ttl", "limits"}
+
+// ReloadResult reports what a reload of the config file changed.
+type ReloadResult struct {
+	ReloadedAt time.Time `json:"reloadedAt"`
+	Applied    []string  `json:"applied"`
+	Pending    []string  `json:"pending"`
+}
+
+// Live is the config of the running service. Reloading the config file swaps
+// in the hot settings atomically, and the other settings keep the values the
+// service was started with.
+type Live struct {
+	name      string
+	overrides []string
+
+	current atomic.Pointer[Config]
+
+	mu        sync.Mutex
+	modTime   time.Time
+	listeners []func(Config)
+	last      ReloadResult
+}
+
+// NewLive returns the live config of a service started with cfg, loaded from
+// the file name with the overrides.
+func NewLive(name string, overrides []string, cfg Config) *Live {
+	l := &Live{name: name, overrides: overrides}
+	l.current.Store(&cfg)
+
+	if info, err := os.Stat(name); err == nil {
+		l.modTime = info.ModTime()
+	}
+	return l
+}
+
+// Config returns the config currently in effect.
+func (l *Live) Config() Config {
+	return *l.current.Load()
+}
+
+// OnReload registers fn to be called with the new config after every reload
+// that applied a change.
+func (l *Live) OnReload(fn func(Config)) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.listeners = append(l.listeners, fn)
+}
+
+// LastReload returns the result of the last reload.
+func (l *Live) LastReload() ReloadResult {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.last
+}
+
+// Reload loads and validates the config file and swaps in its hot settings.
+// An invalid config is rejected as a whole and the current one is kept.
+func (l *Live) Reload() (ReloadResult, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if info, err := os.Stat(l.name); err == nil {
+		l.modTime = info.ModTime()
+	}
+
+	loaded, err := LoadConfig(l.name, l.overrides...)
+	if err != nil {
+		return ReloadResult{}, err
+	}
+	if err := loaded.Validate(); err != nil {
+		return ReloadResult{}, err
+	}
+
+	current := l.Config()
+
+	next := current
+	next.Roles = loaded.Roles
+	next.RoleMap = loaded.RoleMap
+	next.Log.Level = loaded.Log.Level
+	next.Cache.TTL = loaded.Cache.TTL
+	next.Limits = loaded.Limits
+
+	res := ReloadResult{
+		ReloadedAt: time.Now(),
+		Applied:    diff(current, next),
+		Pending:    diff(next, loaded),
+	}
+
+	if len(res.Applied) > 0 {
+		l.current.Store(&next)
+		for _, fn := range l.listeners {
+			fn(next)
+		}
+	}
+	l.last = res
+
+	log.Info().Msgf("reloaded config %s, applied %v, pending restart %v", l.name, res.Applied, res.Pending)
+
+	return res, nil
+}
+
+// Watch reloads the config file when it changes, checking every interval,
+// until ctx is done.
+func (l *Live) Watch(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = defaultReloadInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			info, err := os.Stat(l.name)
+			if err != nil {
+				continue
+			}
+
+			l.mu.Lock()
+			changed := !info.ModTime().Equal(l.modTime)
+			l.mu.Unlock()
+			if !changed {
+				continue
+			}
+
+			if _, err := l.Reload(); err != nil {
+				log.Error().Err(err).Msgf("config %s changed but was not reloaded, keeping the current config", l.name)
+			}
+		}
+	}
+}
+
+// diff lists the paths of the settings that differ between a and b, with the
+// hot settings reported by their section, e.g. "roles" or "cache.ttl".
+func diff(a Config, b Config) []string {
+	fa, fb := flatten(a), flatten(b)
+
+	changed := make(map[string]struct{})
+	for path, v := range fa {
+		if w, ok := fb[path]; !ok || !reflect.DeepEqual(v, w) {
+			changed[section(path)] = struct{}{}
+		}
+	}
+	for path := range fb {
+		if _, ok := fa[path]; !ok {
+			changed[section(path)] = struct{}{}
+		}
+	}
+
+	res := make([]string, 0, len(changed))
+	for path := range changed {
+		res = append(res, path)
+	}
+	sort.Strings(res)
+	return res
+}
+
+func section(path string) string {
+	for _, hot := range hotSettings {
+		if path == hot || strings.HasPrefix(path, hot+".") {
+			return hot
+		}
+	}
+	return path
+}
+
+// flatten maps the paths of the JSON values of the config to the values.
+func flatten(cfg Config) map[string]interface{} {
+	res := make(map[string]interface{})
+
+	js, err := json.Marshal(cfg)
+	if err != nil {
+		return res
+	}
+
+	var doc interface{}
+	if err := json.Unmarshal(js, &doc); err != nil {
+		return res
+	}
+
+	var walk func(prefix string, v interface{})
+	walk = func(prefix string, v interface{}) {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			for k, item := range v {
+				path := k
+				if prefix != "" {
+					path = prefix + "." + k
+				}
+				walk(path, item)
+			}
+		case []interface{}:
+			for i, item := range v {
+				walk(fmt.Sprintf("%s[%d]", prefix, i), item)
+			}
+		default:
+			res[prefix] = v
+		}
+	}
+	walk("", doc)
+
+	return res
+}
@@ -0,0 +1,306 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// FieldError is an invalid or missing setting.
+type FieldError struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+func (e FieldError) Error() string {
+	return e.Path + ": " + e.Message
+}
+
+// ValidationError lists every invalid or missing setting of a config.
+type ValidationError []FieldError
+
+func (e ValidationError) Error() string {
+	msgs := make([]string, len(e))
+	for i, fe := range e {
+		msgs[i] = fe.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+var (
+	backendPattern  = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+	hostnamePattern = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(\.[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$`)
+
+	logLevels = map[string]struct{}{"": {}, "trace": {}, "debug": {}, "info": {}, "warn": {}, "error": {}}
+)
+
+type validator struct {
+	errs ValidationError
+}
+
+func (v *validator) fail(path string, format string, args ...interface{}) {
+	v.errs = append(v.errs, FieldError{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) required(path string, value string) bool {
+	if strings.TrimSpace(value) == "" {
+		v.fail(path, "is required")
+		return false
+	}
+	return true
+}
+
+func (v *validator) port(path string, port int, required bool) {
+	switch {
+	case port == 0 && required:
+		v.fail(path, "is required")
+	case port < 0 || port > 65535:
+		v.fail(path, "%d is not a port between 1 and 65535", port)
+	}
+}
+
+func (v *validator) domain(path string, domain string) {
+	if !v.required(path, domain) {
+		return
+	}
+	if net.ParseIP(domain) == nil && !hostnamePattern.MatchString(domain) {
+		v.fail(path, "%q is not a host name or IP address", domain)
+	}
+}
+
+func (v *validator) duration(path string, value string) {
+	if value == "" {
+		return
+	}
+	if d, err := time.ParseDuration(value); err != nil || d <= 0 {
+		v.fail(path, "%q is not a positive duration such as 30s or 24h", value)
+	}
+}
+
+// Validate checks the config and reports every invalid or missing setting
+// with its path as a ValidationError.
+func (cfg Config) Validate() error {
+	var v validator
+
+	v.domain("adp.domain", cfg.ADP.Domain)
+	v.port("adp.port", cfg.ADP.Port, true)
+	// requests use the ADP credentials of their headers, the configured ones
+	// are optional but go together
+	if cfg.ADP.User != "" && cfg.ADP.Password == "" {
+		v.fail("adp.password", "is required with adp.user")
+	}
+	if cfg.ADP.Password != "" && cfg.ADP.User == "" {
+		v.fail("adp.user", "is required with adp.password")
+	}
+	cfg.validateBackends(&v)
+
+	if cfg.SearchWebAPI.Domain != "" {
+		v.domain("searchWebAPI.domain", cfg.SearchWebAPI.Domain)
+	}
+	v.port("searchWebAPI.port", cfg.SearchWebAPI.Port, false)
+
+	if cfg.Echo.Host != "" {
+		v.domain("echo.host", cfg.Echo.Host)
+	}
+	v.port("echo.port", cfg.Echo.Port, true)
+	cfg.validateTLS(&v)
+
+	if _, ok := logLevels[cfg.Log.Level]; !ok {
+		v.fail("log.level", "%q is not one of trace, debug, info, warn or error", cfg.Log.Level)
+	}
+	v.required("log.path", cfg.Log.Path)
+
+	if v.required("roles.CaseManager", cfg.Roles["CaseManager"]) {
+		keys := make([]string, 0, len(cfg.Roles))
+		for k := range cfg.Roles {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			if len(getRoleMap(map[string]string{k: cfg.Roles[k]})[k]) == 0 {
+				v.fail("roles."+k, "lists no roles")
+			}
+		}
+	}
+
+	for k, c := range cfg.Categories {
+		if c.Name == "" {
+			v.fail("categories."+k+".name", "is required")
+		}
+	}
+
+	v.duration("drift.interval", cfg.Drift.Interval)
+	for i, check := range cfg.Drift.Checks {
+		v.required(fmt.Sprintf("drift.checks[%d].application", i), check.Application)
+		v.required(fmt.Sprintf("drift.checks[%d].baseline", i), check.Baseline)
+	}
+
+	switch cfg.Tracing.Exporter {
+	case "":
+	case "otlp":
+		v.required("tracing.endpoint", cfg.Tracing.Endpoint)
+	case "file":
+		v.required("tracing.file", cfg.Tracing.File)
+	default:
+		v.fail("tracing.exporter", "%q is not otlp or file", cfg.Tracing.Exporter)
+	}
+
+	v.duration("health.probeTimeout", cfg.Health.ProbeTimeout)
+	v.duration("health.probeCacheTTL", cfg.Health.ProbeCacheTTL)
+	for k, ttl := range cfg.Cache.TTL {
+		// a TTL of 0 turns caching of the resource off
+		if d, err := time.ParseDuration(ttl); err != nil || d < 0 {
+			v.fail("cache.ttl."+k, "%q is not a duration such as 0s or 5m", ttl)
+		}
+	}
+	v.duration("resilience.timeout", cfg.Resilience.Timeout)
+	for op, timeout := range cfg.Resilience.Timeouts {
+		v.duration("resilience.timeouts."+op, timeout)
+	}
+	if cfg.Resilience.Retries < 0 {
+		v.fail("resilience.retries", "%d is negative", cfg.Resilience.Retries)
+	}
+	v.duration("resilience.backoff", cfg.Resilience.Backoff)
+	v.duration("resilience.maxBackoff", cfg.Resilience.MaxBackoff)
+	if cfg.Resilience.BreakerFailures < 0 {
+		v.fail("resilience.breakerFailures", "%d is negative", cfg.Resilience.BreakerFailures)
+	}
+	v.duration("resilience.breakerCooldown", cfg.Resilience.BreakerCooldown)
+	cfg.validateLimits(&v)
+	v.duration("reload.interval", cfg.Reload.Interval)
+	v.duration("idempotency.window", cfg.Idempotency.Window)
+	v.duration("shutdown.timeout", cfg.Shutdown.Timeout)
+	v.duration("shutdown.stopTimeout", cfg.Shutdown.StopTimeout)
+
+	v.duration("legalHold.checkInterval", cfg.LegalHold.CheckInterval)
+	v.duration("legalHold.reminderAfter", cfg.LegalHold.ReminderAfter)
+	v.duration("legalHold.escalateAfter", cfg.LegalHold.EscalateAfter)
+	v.duration("legalHold.linkValidity", cfg.LegalHold.LinkValidity)
+	v.port("legalHold.smtp.port", cfg.LegalHold.SMTP.Port, false)
+
+	if len(v.errs) == 0 {
+		return nil
+	}
+
+	sort.SliceStable(v.errs, func(i, j int) bool { return v.errs[i].Path < v.errs[j].Path })
+	return v.errs
+}
+
+func (cfg Config) validateBackends(v *validator) {
+	names := make([]string, 0, len(cfg.ADPBackends))
+	for name := range cfg.ADPBackends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	prefixes := make(map[string]string)
+	workspaces := make(map[string]string)
+	for _, name := range names {
+		b := cfg.ADPBackends[name]
+		path := "adpBackends." + name
+
+		switch {
+		case name == DefaultADPBackend || name == AllADPBackends:
+			v.fail(path, "%q is reserved, use another backend name", name)
+		case !backendPattern.MatchString(name):
+			v.fail(path, "%q is not a backend name of letters, digits, _ and -", name)
+		}
+
+		v.domain(path+".domain", b.Domain)
+		v.port(path+".port", b.Port, true)
+		if b.User != "" && b.Password == "" {
+			v.fail(path+".password", "is required with user")
+		}
+		if b.Password != "" && b.User == "" {
+			v.fail(path+".user", "is required with password")
+		}
+
+		for i, prefix := range b.ApplicationPrefixes {
+			p := fmt.Sprintf("%s.applicationPrefixes[%d]", path, i)
+			if v.required(p, prefix) {
+				if other, ok := prefixes[prefix]; ok {
+					v.fail(p, "%q is also a prefix of backend %s", prefix, other)
+				}
+				prefixes[prefix] = name
+			}
+		}
+		for i, workspace := range b.Workspaces {
+			p := fmt.Sprintf("%s.workspaces[%d]", path, i)
+			if v.required(p, workspace) {
+				if other, ok := workspaces[workspace]; ok {
+					v.fail(p, "%q is also a workspace of backend %s", workspace, other)
+				}
+				workspaces[workspace] = name
+			}
+		}
+	}
+}
+
+func (v *validator) rateLimit(path string, r RateLimit) {
+	if _, err := r.PerSecond(); err != nil {
+		v.fail(path+".rate", "%v", err)
+	}
+	if r.Burst < 0 {
+		v.fail(path+".burst", "%d is negative", r.Burst)
+	}
+}
+
+func (cfg Config) validateLimits(v *validator) {
+	l := cfg.Limits
+
+	v.rateLimit("limits.user", l.User)
+	for role, r := range l.Roles {
+		if _, ok := cfg.Roles[role]; !ok {
+			v.fail("limits.roles."+role, "%q is not a role of roles", role)
+		}
+		v.rateLimit("limits.roles."+role, r)
+	}
+	for route, r := range l.Routes {
+		v.rateLimit("limits.routes."+route, r)
+	}
+	for name, n := range l.Concurrency {
+		if n < 1 {
+			v.fail("limits.concurrency."+name, "%d is not a positive number", n)
+		}
+	}
+
+	// a queue timeout of 0 rejects at once when a cap is reached
+	if l.QueueTimeout != "" {
+		if d, err := time.ParseDuration(l.QueueTimeout); err != nil || d < 0 {
+			v.fail("limits.queueTimeout", "%q is not a duration such as 0s or 10s", l.QueueTimeout)
+		}
+	}
+}
+
+func (cfg Config) validateTLS(v *validator) {
+	t := cfg.Echo.TLS
+	if !t.Enabled() {
+		return
+	}
+
+	v.required("echo.tls.cert", t.Cert)
+	v.required("echo.tls.key", t.Key)
+
+	if _, err := t.Version(); err != nil {
+		v.fail("echo.tls.minVersion", "%q is not 1.2 or 1.3", t.MinVersion)
+	}
+	if _, err := t.Ciphers(); err != nil {
+		v.fail("echo.tls.cipherSuites", "%v", err)
+	}
+
+	switch t.ClientAuth {
+	case "", "verify":
+	case "require":
+		if t.ClientCA == "" {
+			v.fail("echo.tls.clientCA", "is required with clientAuth require")
+		}
+	default:
+		v.fail("echo.tls.clientAuth", "%q is not verify or require", t.ClientAuth)
+	}
+
+	v.duration("echo.tls.reloadInterval", t.ReloadInterval)
+}
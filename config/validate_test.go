@@ -0,0 +1,122 @@
+package config
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func validConfig() Config {
+	var cfg Config
+	cfg.ADP.Domain = "adp.example.com"
+	cfg.ADP.Port = 443
+	cfg.Echo.Port = 8080
+	cfg.Log.Path = "logs/eds.log"
+	cfg.Roles = map[string]string{"CaseManager": "Case Manager,Administrator"}
+	return cfg
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name      string
+		change    func(cfg *Config)
+		wantPaths []string
+	}{
+		{
+			name:   "valid",
+			change: func(cfg *Config) {},
+		},
+		{
+			name:   "IP address as domain",
+			change: func(cfg *Config) { cfg.ADP.Domain = "10.0.0.1" },
+		},
+		{
+			name: "every error with its path, sorted",
+			change: func(cfg *Config) {
+				cfg.ADP.Domain = ""
+				cfg.ADP.Port = 70000
+				cfg.Log.Level = "verbose"
+			},
+			wantPaths: []string{"adp.domain", "adp.port", "log.level"},
+		},
+		{
+			name:      "invalid host name",
+			change:    func(cfg *Config) { cfg.ADP.Domain = "adp example.com" },
+			wantPaths: []string{"adp.domain"},
+		},
+		{
+			name:      "user without password",
+			change:    func(cfg *Config) { cfg.ADP.User = "svc" },
+			wantPaths: []string{"adp.password"},
+		},
+		{
+			name:      "CaseManager role missing",
+			change:    func(cfg *Config) { cfg.Roles = map[string]string{"Reviewer": "Reviewer"} },
+			wantPaths: []string{"roles.CaseManager"},
+		},
+		{
+			name: "durations",
+			change: func(cfg *Config) {
+				cfg.Drift.Interval = "daily"
+				cfg.Resilience.Timeout = "-5s"
+				cfg.Cache.TTL = map[string]string{"templates": "0s", "users": "soon"}
+			},
+			wantPaths: []string{"cache.ttl.users", "drift.interval", "resilience.timeout"},
+		},
+		{
+			name: "tracing exporter",
+			change: func(cfg *Config) {
+				cfg.Tracing.Exporter = "otlp"
+			},
+			wantPaths: []string{"tracing.endpoint"},
+		},
+		{
+			name: "backends",
+			change: func(cfg *Config) {
+				cfg.ADPBackends = map[string]ADPBackend{
+					DefaultADPBackend: {Domain: "adp-a.example.com", Port: 443},
+					"emea":            {Domain: "adp-emea.example.com", Port: 443, ApplicationPrefixes: []string{"documentHold.EU_"}},
+					"eu-west":         {Domain: "adp-eu.example.com", ApplicationPrefixes: []string{"documentHold.EU_"}},
+				}
+			},
+			wantPaths: []string{"adpBackends." + DefaultADPBackend, "adpBackends.eu-west.applicationPrefixes[0]", "adpBackends.eu-west.port"},
+		},
+		{
+			name: "limits",
+			change: func(cfg *Config) {
+				cfg.Limits.User = RateLimit{Rate: "10 per second"}
+				cfg.Limits.Roles = map[string]RateLimit{"Auditor": {Rate: "1/s"}}
+				cfg.Limits.Concurrency = map[string]int{"/provision": 0}
+				cfg.Limits.QueueTimeout = "-1s"
+			},
+			wantPaths: []string{"limits.concurrency./provision", "limits.queueTimeout", "limits.roles.Auditor", "limits.user.rate"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := validConfig()
+			tt.change(&cfg)
+
+			err := cfg.Validate()
+			if len(tt.wantPaths) == 0 {
+				if err != nil {
+					t.Fatalf("Validate() error = %v", err)
+				}
+				return
+			}
+
+			var verr ValidationError
+			if !errors.As(err, &verr) {
+				t.Fatalf("Validate() error = %v, want a ValidationError", err)
+			}
+			paths := make([]string, len(verr))
+			for i, fe := range verr {
+				paths[i] = fe.Path
+			}
+			if !reflect.DeepEqual(paths, tt.wantPaths) {
+				t.Errorf("Validate() failed %v, want %v: %v", paths, tt.wantPaths, err)
+			}
+		})
+	}
+}
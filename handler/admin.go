@@ -0,0 +1,31 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/xifanyan/ediscovery-data-service/config"
+)
+
+// reloadConfig reloads the config file. The roles, log level, cache TTLs and
+// limits take effect at once; the settings that need a restart are reported
+// as pending. An invalid config is rejected and the current one is kept.
+func (h *Handler) reloadConfig(c echo.Context) error {
+	res, err := h.live.Reload()
+
+	var invalid config.ValidationError
+	if errors.As(err, &invalid) {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid config, keeping the current one", "fields": invalid})
+	}
+	if err != nil {
+		return h.handleValidationError(c, err)
+	}
+	return c.JSON(http.StatusOK, res)
+}
+
+// getConfigReload returns the result of the last reload.
+func (h *Handler) getConfigReload(c echo.Context) error {
+	return c.JSON(http.StatusOK, h.live.LastReload())
+}
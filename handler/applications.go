@@ -0,0 +1,153 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/xifanyan/adp"
+
+	"github.com/xifanyan/ediscovery-data-service/logging"
+	"github.com/xifanyan/ediscovery-data-service/service"
+)
+
+// getApplicationEntity returns the entity of the application with the given ID.
+func getApplicationEntity(ctx context.Context, adpService *adp.Service, applicationID string) (adp.Entity, error) {
+	entities, err := service.Call(ctx, "ListEntities", service.BindV(adpService.ListEntities, adp.WithListEntitiesID(applicationID)))
+	if err != nil {
+		return adp.Entity{}, err
+	}
+
+	if len(entities) == 0 {
+		return adp.Entity{}, service.ErrApplicationNotFound
+	}
+
+	return entities[0], nil
+}
+
+// getApplicationStatus returns the ADP entity of the application, which carries its current state.
+func (h *Handler) getApplicationStatus(c echo.Context) error {
+	applicationID := c.Param("applicationID")
+
+	adpService := h.service.ResetADPServiceWithContextCredential(c)
+	ctx := c.Request().Context()
+	entity, err := getApplicationEntity(ctx, adpService, applicationID)
+	if err != nil {
+		if errors.Is(err, service.ErrApplicationNotFound) {
+			return c.JSON(http.StatusNotFound, echo.Map{"error": err.Error()})
+		}
+		return h.handleADPError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, entity)
+}
+
+// startApplication starts the application asynchronously and returns the
+// execution ID to follow the progress with.
+func (h *Handler) startApplication(c echo.Context) error {
+	applicationID := c.Param("applicationID")
+
+	adpService := h.service.ResetADPServiceWithContextCredential(c)
+	ctx := c.Request().Context()
+	executionID, err := service.Call(ctx, "StartApplicationAsync", service.Bind(adpService.StartApplicationAsync, applicationID))
+	if err != nil {
+		return h.handleADPError(c, err)
+	}
+	logging.From(c).Debug().Msgf("%s : start executionID: %s", applicationID, executionID)
+
+	return c.JSON(http.StatusOK, echo.Map{"applicationID": applicationID, "executionID": executionID})
+}
+
+// stopApplication would stop a running application.
+//
+// The ADP client can start applications but has no call to stop them, so
+// stopping is blocked on ADP: the route answers 404 for an unknown
+// application and 501 otherwise.
+func (h *Handler) stopApplication(c echo.Context) error {
+	applicationID := c.Param("applicationID")
+
+	adpService := h.service.ResetADPServiceWithContextCredential(c)
+	ctx := c.Request().Context()
+	if _, err := getApplicationEntity(ctx, adpService, applicationID); err != nil {
+		if errors.Is(err, service.ErrApplicationNotFound) {
+			return c.JSON(http.StatusNotFound, errorBody(c, err))
+		}
+		return h.handleADPError(c, err)
+	}
+
+	err := fmt.Errorf("%w: ADP cannot stop application %s", service.ErrNotImplemented, applicationID)
+	return c.JSON(http.StatusNotImplemented, errorBody(c, err))
+}
+
+// decommissionApplication removes an application in two steps.
+//
+// Without the confirm query parameter it answers 428 with a confirmation
+// token for the user and application that expires after a few minutes.
+// Repeating the request with confirm=<token> consumes the token, records the
+// state of the application, its entity and its users and groups, to the
+// decommission records directory and then removes the application.
+//
+// The ADP client has no call to remove an application yet, so the removal is
+// blocked on ADP: the record says the application was not removed and the
+// request answers 501 with the record file.
+func (h *Handler) decommissionApplication(c echo.Context) error {
+	applicationID := c.Param("applicationID")
+	userName := c.Get("user").(string)
+
+	confirm := c.QueryParam("confirm")
+	if confirm == "" {
+		token, expires := h.service.DecommissionToken(userName, applicationID)
+		body := errorBody(c, service.ErrConfirmationRequired)
+		body["confirmationToken"] = token
+		body["expiresAt"] = expires
+		return c.JSON(http.StatusPreconditionRequired, body)
+	}
+
+	if err := h.service.VerifyDecommissionToken(userName, applicationID, confirm); err != nil {
+		return h.handleValidationError(c, err)
+	}
+
+	adpService := h.service.ResetADPServiceWithContextCredential(c)
+	ctx := c.Request().Context()
+
+	entity, err := getApplicationEntity(ctx, adpService, applicationID)
+	if err != nil {
+		if errors.Is(err, service.ErrApplicationNotFound) {
+			return c.JSON(http.StatusNotFound, errorBody(c, err))
+		}
+		return h.handleADPError(c, err)
+	}
+
+	users, groups, err := service.Call2(ctx, "GetUsersAndGroupsByApplicationID", service.BindPair(adpService.GetUsersAndGroupsByApplicationID, applicationID))
+	if err != nil {
+		return h.handleADPError(c, err)
+	}
+
+	record, err := h.service.DecommissionApplication(ctx, adpService, service.ApplicationSnapshot{
+		Application: applicationID,
+		RecordedAt:  time.Now(),
+		RecordedBy:  userName,
+		Entity:      entity,
+		Users:       users,
+		Groups:      groups,
+	})
+	if record != "" {
+		logging.From(c).Info().Msgf("user [%s] recorded state of %s to %s before decommissioning", userName, applicationID, record)
+	}
+	switch {
+	case errors.Is(err, service.ErrNotImplemented):
+		body := errorBody(c, err)
+		body["record"] = record
+		return c.JSON(http.StatusNotImplemented, body)
+	case err != nil && record == "":
+		logging.From(c).Error().Err(err).Msgf("failed to record state of %s", applicationID)
+		return c.JSON(http.StatusInternalServerError, errorBody(c, err))
+	case err != nil:
+		return h.handleADPError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{"applicationID": applicationID, "record": record})
+}
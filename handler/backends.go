@@ -0,0 +1,43 @@
+package handler
+
+import (
+	"github.com/labstack/echo/v4"
+
+	"github.com/xifanyan/ediscovery-data-service/config"
+	"github.com/xifanyan/ediscovery-data-service/service"
+)
+
+// fanOutRoutes are the listings that merge the entities of all ADP backends
+// when requested with "ADP-Backend: all".
+var fanOutRoutes = map[string]struct{}{
+	"/getApplications":    {},
+	"/getRnaApplications": {},
+}
+
+// routeBackend picks the ADP backend of the request before it is handled.
+func (h *Handler) routeBackend(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		name, err := h.service.RouteBackend(c)
+		if err != nil {
+			return h.handleValidationError(c, err)
+		}
+
+		if name == config.AllADPBackends {
+			if _, ok := fanOutRoutes[c.Path()]; !ok {
+				return h.handleValidationError(c, service.ErrFanOutNotSupported)
+			}
+		}
+
+		c.Set("adp_backend", name)
+		if name != config.AllADPBackends {
+			c.SetRequest(c.Request().WithContext(service.WithBackend(c.Request().Context(), name)))
+		}
+		return next(c)
+	}
+}
+
+// fanOut reports whether the request lists the entities of all ADP backends.
+func fanOut(c echo.Context) bool {
+	name, _ := c.Get("adp_backend").(string)
+	return name == config.AllADPBackends
+}
@@ -0,0 +1,45 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/xifanyan/ediscovery-data-service/service"
+)
+
+// cacheInvalidations lists the cached resources changed by mutating routes.
+var cacheInvalidations = map[string][]string{
+	"/createGlobalSearches":           {service.CacheGlobalSearches},
+	"/updateGlobalSearches":           {service.CacheGlobalSearches},
+	"/importGlobalSearchesAndTaggers": {service.CacheGlobalSearches, service.CacheIndexConfiguration, service.CacheFieldProperties},
+
+	"/submitTagger":                                  {service.CacheIndexConfiguration, service.CacheFieldProperties},
+	"/applications/:applicationID/taggers":           {service.CacheIndexConfiguration, service.CacheFieldProperties},
+	"/applications/:applicationID/taggers/:taggerID": {service.CacheIndexConfiguration, service.CacheFieldProperties},
+
+	"/createApplication":                 {service.CacheTemplates},
+	"/applications/:applicationID/clone": {service.CacheTemplates, service.CacheGlobalSearches},
+	"/applications/:applicationID":       {service.CacheTemplates, service.CacheDataModel},
+	"/provision":                         {service.CacheTemplates, service.CacheGlobalSearches},
+	"/provision/:runID/resume":           {service.CacheTemplates, service.CacheGlobalSearches},
+}
+
+// invalidateCache drops the cached resources related to a mutating request
+// once it is handled. It does so whether the request succeeded or not, as a
+// failed request may have changed some of them.
+func (h *Handler) invalidateCache(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		err := next(c)
+
+		switch c.Request().Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+		default:
+			if resources, ok := cacheInvalidations[c.Path()]; ok {
+				h.service.InvalidateCache(resources...)
+			}
+		}
+
+		return err
+	}
+}
@@ -0,0 +1,207 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/xifanyan/adp"
+
+	"github.com/xifanyan/ediscovery-data-service/config"
+	"github.com/xifanyan/ediscovery-data-service/logging"
+	"github.com/xifanyan/ediscovery-data-service/service"
+)
+
+// listCategoryValues reads the values of a category of the application.
+//
+// Custodians are not stored under a readable category ID, they are read
+// through GetCustodiansByApplicationID instead.
+func listCategoryValues(ctx context.Context, adpService *adp.Service, app string, categoryType string, category config.Category) (interface{}, error) {
+	if category.ID == "" {
+		if categoryType != "custodian" {
+			return nil, fmt.Errorf("%w: %s has no category ID to list", service.ErrCategoryTypeNotSupported, categoryType)
+		}
+		return service.Call(ctx, "GetCustodiansByApplicationID", service.Bind(adpService.GetCustodiansByApplicationID, app))
+	}
+
+	return service.Call(ctx, "GetCategories", service.Bind2(adpService.GetCategories, app, category.ID))
+}
+
+// addCategoryValues creates or updates the given values one by one and returns
+// the ADP responses in the same order. It stops at the first failure.
+func addCategoryValues(ctx context.Context, adpService *adp.Service, app string, category config.Category, values []service.CategoryValue) ([]interface{}, error) {
+	results := make([]interface{}, 0, len(values))
+	for _, v := range values {
+		logging.Ctx(ctx).Debug().Msgf("%s : %s : create or update %s (%s)", app, category.Name, v.ID, v.DisplayName)
+
+		var res interface{}
+		err := service.Exec(ctx, "CreateOrUpdateCategory", func() (err error) {
+			res, err = adpService.CreateOrUpdateCategory(app, category.Name, v.ID, v.DisplayName)
+			return err
+		})
+		if err != nil {
+			return results, err
+		}
+		results = append(results, res)
+	}
+	return results, nil
+}
+
+func (h *Handler) getCategoryValues(c echo.Context) error {
+	applicationID := c.Param("applicationID")
+	categoryType := c.Param("categoryType")
+
+	category, err := h.service.Category(categoryType)
+	if err != nil {
+		return h.handleValidationError(c, err)
+	}
+
+	adpService := h.service.ResetADPServiceWithContextCredential(c)
+	ctx := c.Request().Context()
+	res, err := listCategoryValues(ctx, adpService, applicationID, categoryType, category)
+	if errors.Is(err, service.ErrCategoryTypeNotSupported) {
+		return h.handleValidationError(c, err)
+	}
+	if err != nil {
+		return h.handleADPError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, res)
+}
+
+func (h *Handler) addCategoryValue(c echo.Context) error {
+	applicationID := c.Param("applicationID")
+
+	category, err := h.service.Category(c.Param("categoryType"))
+	if err != nil {
+		return h.handleValidationError(c, err)
+	}
+
+	var value service.CategoryValue
+	if err := c.Bind(&value); err != nil {
+		return h.handleValidationError(c, err)
+	}
+
+	values, err := service.VerifyCategoryValues([]service.CategoryValue{value})
+	if err != nil {
+		return h.handleValidationError(c, err)
+	}
+
+	adpService := h.service.ResetADPServiceWithContextCredential(c)
+	ctx := c.Request().Context()
+	res, err := addCategoryValues(ctx, adpService, applicationID, category, values)
+	if err != nil {
+		return h.handleADPError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, res[0])
+}
+
+func (h *Handler) addCategoryValuesBulk(c echo.Context) error {
+	applicationID := c.Param("applicationID")
+
+	category, err := h.service.Category(c.Param("categoryType"))
+	if err != nil {
+		return h.handleValidationError(c, err)
+	}
+
+	var values []service.CategoryValue
+	if err := c.Bind(&values); err != nil {
+		return h.handleValidationError(c, err)
+	}
+
+	values, err = service.VerifyCategoryValues(values)
+	if err != nil {
+		return h.handleValidationError(c, err)
+	}
+
+	adpService := h.service.ResetADPServiceWithContextCredential(c)
+	ctx := c.Request().Context()
+	res, err := addCategoryValues(ctx, adpService, applicationID, category, values)
+	if err != nil {
+		return c.JSON(
+			http.StatusInternalServerError,
+			echo.Map{"error": err.Error(), "added": values[:len(res)]},
+		)
+	}
+
+	return c.JSON(http.StatusOK, res)
+}
+
+// renameCategoryValue changes the display name of an existing category value.
+func (h *Handler) renameCategoryValue(c echo.Context) error {
+	applicationID := c.Param("applicationID")
+
+	category, err := h.service.Category(c.Param("categoryType"))
+	if err != nil {
+		return h.handleValidationError(c, err)
+	}
+
+	var value service.CategoryValue
+	if err := c.Bind(&value); err != nil {
+		return h.handleValidationError(c, err)
+	}
+	value.ID = c.Param("valueID")
+
+	values, err := service.VerifyCategoryValues([]service.CategoryValue{value})
+	if err != nil {
+		return h.handleValidationError(c, err)
+	}
+
+	adpService := h.service.ResetADPServiceWithContextCredential(c)
+	ctx := c.Request().Context()
+	res, err := addCategoryValues(ctx, adpService, applicationID, category, values)
+	if err != nil {
+		return h.handleADPError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, res[0])
+}
+
+// removeCategoryValue would remove a value from a category.
+//
+// The ADP client can create and update category values but has no call that
+// removes one, so removal is blocked on ADP: the route answers 404 for a value
+// the category does not have and 501 otherwise, leaving the value as it is.
+func (h *Handler) removeCategoryValue(c echo.Context) error {
+	applicationID := c.Param("applicationID")
+	categoryType := c.Param("categoryType")
+	valueID := c.Param("valueID")
+
+	category, err := h.service.Category(categoryType)
+	if err != nil {
+		return h.handleValidationError(c, err)
+	}
+
+	adpService := h.service.ResetADPServiceWithContextCredential(c)
+	ctx := c.Request().Context()
+	res, err := listCategoryValues(ctx, adpService, applicationID, categoryType, category)
+	if errors.Is(err, service.ErrCategoryTypeNotSupported) {
+		return h.handleValidationError(c, err)
+	}
+	if err != nil {
+		return h.handleADPError(c, err)
+	}
+
+	values, err := service.CategoryValues(res)
+	if err != nil {
+		return h.handleADPError(c, err)
+	}
+
+	found := false
+	for _, v := range values {
+		if v.ID == valueID {
+			found = true
+			break
+		}
+	}
+	if !found {
+		err := fmt.Errorf("%w: %s in %s of %s", service.ErrCategoryValueNotFound, valueID, categoryType, applicationID)
+		return c.JSON(http.StatusNotFound, errorBody(c, err))
+	}
+
+	err = fmt.Errorf("%w: ADP cannot remove %s from %s of %s", service.ErrNotImplemented, valueID, categoryType, applicationID)
+	return c.JSON(http.StatusNotImplemented, errorBody(c, err))
+}
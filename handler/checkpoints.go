@@ -0,0 +1,16 @@
+package handler
+
+import (
+	"github.com/labstack/echo/v4"
+)
+
+// getCheckpoints lists the ingestions and imports that failed or were stopped
+// by a shutdown after some of their steps. Submitting them again continues
+// with the first step that did not finish.
+func (h *Handler) getCheckpoints(c echo.Context) error {
+	checkpoints, err := h.service.Checkpoints()
+	if err != nil {
+		return h.handleADPError(c, err)
+	}
+	return h.listJSON(c, checkpoints)
+}
@@ -0,0 +1,305 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/labstack/echo/v4"
+	"github.com/xifanyan/adp"
+
+	"github.com/xifanyan/ediscovery-data-service/logging"
+	"github.com/xifanyan/ediscovery-data-service/service"
+)
+
+// CloneApplicationRequest describes the application to create from the source.
+// The template of the source cannot be read from ADP, so it has to be given.
+//
+// GlobalSearches copies the global searches scoped to the source, Taggers the
+// taggers the service installed into the source.
+type CloneApplicationRequest struct {
+	Name            string `json:"name"`
+	Template        string `json:"template"`
+	Workspace       string `json:"workspace"`
+	Host            string `json:"host"`
+	Start           bool   `json:"start"`
+	ExcludeSecurity bool   `json:"excludeSecurity"`
+	GlobalSearches  bool   `json:"globalSearches"`
+	Taggers         bool   `json:"taggers"`
+}
+
+// clonedCategories are the category types copied to a clone, by their ID.
+var clonedCategories = []string{"redactionReason", "custodian"}
+
+// cloneApplication creates a new application like the source and copies its
+// redaction reasons, custodians and, unless excluded, its security assignments
+// and, if asked for, its global searches and taggers.
+//
+// Everything is read from the source before the application is created, so a
+// source that cannot be copied completely fails without creating anything.
+// The response is a report of what was copied and what was skipped and why.
+// Global searches and taggers that cannot be copied are skipped. When another
+// copy fails the report so far is returned next to the error, the new
+// application is left in place.
+func (h *Handler) cloneApplication(c echo.Context) error {
+	source := c.Param("applicationID")
+
+	var req CloneApplicationRequest
+	if err := c.Bind(&req); err != nil {
+		return h.handleValidationError(c, err)
+	}
+
+	if req.Name == "" {
+		return h.handleValidationError(c, service.ErrApplicationNameRequired)
+	}
+	if req.Template == "" {
+		return h.handleValidationError(c, service.ErrTemplateRequired)
+	}
+
+	applicationType, err := service.ApplicationTypeFromID(source)
+	if err != nil {
+		return h.handleValidationError(c, err)
+	}
+
+	adpService := h.service.ResetADPServiceWithContextCredential(c)
+	ctx := c.Request().Context()
+
+	if _, err := getApplicationEntity(ctx, adpService, source); err != nil {
+		if errors.Is(err, service.ErrApplicationNotFound) {
+			return c.JSON(http.StatusNotFound, echo.Map{"error": err.Error()})
+		}
+		return h.handleADPError(c, err)
+	}
+
+	categories := make(map[string][]service.CategoryValue, len(clonedCategories))
+	for _, categoryType := range clonedCategories {
+		values, err := h.sourceCategoryValues(ctx, adpService, source, categoryType)
+		if err != nil {
+			return h.handleADPError(c, err)
+		}
+		categories[categoryType] = values
+	}
+
+	var members []service.ApplicationMember
+	if !req.ExcludeSecurity {
+		users, groups, err := service.Call2(ctx, "GetUsersAndGroupsByApplicationID", service.BindPair(adpService.GetUsersAndGroupsByApplicationID, source))
+		if err != nil {
+			return h.handleADPError(c, err)
+		}
+
+		if members, err = service.ApplicationMembers(users, groups); err != nil {
+			return h.handleADPError(c, err)
+		}
+	}
+
+	// global searches and taggers are copied as far as they can be, the ones
+	// that cannot are reported as skipped instead of failing the clone
+	var searches map[string]interface{}
+	var searchesErr error
+	if req.GlobalSearches {
+		listing, err := service.Call(ctx, "ListGlobalSearches", adpService.ListGlobalSearches)
+		if err == nil {
+			searches, err = service.SourceGlobalSearches(listing, source)
+		}
+		searchesErr = err
+	}
+
+	var taggers []service.TaggerRecord
+	var taggersErr error
+	if req.Taggers {
+		taggers, taggersErr = h.service.Taggers(ctx, source)
+	}
+
+	opts := []func(*adp.CreateApplicationConfiguration){
+		adp.WithCreateApplicationApplicationType(applicationType),
+		adp.WithCreateApplicationApplicationName(req.Name),
+		adp.WithCreateApplicationApplicationTemplate(req.Template),
+	}
+	if req.Workspace != "" {
+		opts = append(opts, adp.WithCreateApplicationApplicationWorkspace(req.Workspace))
+	}
+	if req.Host != "" {
+		opts = append(opts, adp.WithCreateApplicationApplicationHost(req.Host))
+	}
+
+	res, err := service.Call(ctx, "CreateApplication", service.BindV(adpService.CreateApplication, opts...))
+	if err != nil {
+		return h.handleADPError(c, err)
+	}
+
+	report := service.NewCloneReport(source)
+	report.ApplicationID = res.ApplicationIdentifier
+	logging.From(c).Info().Msgf("cloning %s into %s", source, report.ApplicationID)
+
+	cloneFailed := func(err error) error {
+		logging.From(c).Error().Err(err).Msgf("failed to clone %s into %s", source, report.ApplicationID)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error(), "report": report})
+	}
+
+	for _, categoryType := range clonedCategories {
+		category, _ := h.service.Category(categoryType)
+		for _, v := range categories[categoryType] {
+			if err := service.Exec(ctx, "CreateOrUpdateCategory", func() error {
+				_, err := adpService.CreateOrUpdateCategory(report.ApplicationID, category.Name, v.ID, v.DisplayName)
+				return err
+			}); err != nil {
+				return cloneFailed(err)
+			}
+			report.Copy(categoryType, v.ID)
+		}
+	}
+
+	if req.ExcludeSecurity {
+		report.Skip("security", "", "excluded by request")
+	} else if len(members) > 0 {
+		roles := service.SecurityAssignments(report.ApplicationID, members)
+		if err := service.Exec(ctx, "AssignUsersOrGroupsToApplication", func() error { return adpService.AssignUsersOrGroupsToApplication(roles) }); err != nil {
+			return cloneFailed(err)
+		}
+		for _, m := range members {
+			report.Copy("security", m.Name)
+		}
+	}
+
+	searchIDs := make(map[string]string)
+	switch {
+	case !req.GlobalSearches:
+		report.Skip("globalSearches", "", "excluded by request")
+	case searchesErr != nil:
+		report.Skip("globalSearches", "", fmt.Sprintf("cannot read the global searches of %s: %v", source, searchesErr))
+	default:
+		searchIDs = cloneGlobalSearches(ctx, adpService, report, searches)
+	}
+
+	switch {
+	case !req.Taggers:
+		report.Skip("taggers", "", "excluded by request")
+	case taggersErr != nil:
+		report.Skip("taggers", "", fmt.Sprintf("cannot read the taggers of %s: %v", source, taggersErr))
+	default:
+		h.cloneTaggers(ctx, adpService, report, taggers, searchIDs)
+	}
+
+	if req.Start {
+		report.ExecutionID, err = service.Call(ctx, "StartApplicationAsync", service.Bind(adpService.StartApplicationAsync, report.ApplicationID))
+		if err != nil {
+			return cloneFailed(err)
+		}
+	}
+
+	return c.JSON(http.StatusOK, report)
+}
+
+// cloneGlobalSearches copies the global searches of the source to the clone and
+// returns the IDs of the copies by the IDs of their originals. A search that
+// cannot be copied is reported as skipped.
+func cloneGlobalSearches(ctx context.Context, adpService *adp.Service, report *service.CloneReport, searches map[string]interface{}) map[string]string {
+	ids := make([]string, 0, len(searches))
+	for id := range searches {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	copies := make([]map[string]interface{}, 0, len(ids))
+	copied := make([]string, 0, len(ids))
+	for _, id := range ids {
+		search, err := service.CloneGlobalSearch(searches[id], service.CloneSearchID(id, report.ApplicationID), report.Source, report.ApplicationID)
+		if err != nil {
+			report.Skip("globalSearches", id, err.Error())
+			continue
+		}
+		copies = append(copies, search)
+		copied = append(copied, id)
+	}
+	if len(copies) == 0 {
+		return map[string]string{}
+	}
+
+	js, err := json.Marshal(copies)
+	if err == nil {
+		_, err = service.Call(ctx, "GlobalSearches", service.BindV(adpService.GlobalSearches,
+			adp.WithGlobalSearchesCreateUpdateGlobalSearches(string(js)),
+		))
+	}
+	if err != nil {
+		logging.Ctx(ctx).Error().Err(err).Msgf("failed to copy the global searches of %s", report.Source)
+		for _, id := range copied {
+			report.Skip("globalSearches", id, err.Error())
+		}
+		return map[string]string{}
+	}
+
+	searchIDs := make(map[string]string, len(copied))
+	for _, id := range copied {
+		searchIDs[id] = service.CloneSearchID(id, report.ApplicationID)
+		report.Copy("globalSearches", searchIDs[id])
+	}
+	return searchIDs
+}
+
+// cloneTaggers installs the taggers of the source into the clone, pointing
+// them at the copies of their global searches. A tagger that cannot be
+// installed is reported as skipped.
+//
+// ADP cannot list the taggers of an application, only the ones the service
+// installed into the source are known.
+func (h *Handler) cloneTaggers(ctx context.Context, adpService *adp.Service, report *service.CloneReport, taggers []service.TaggerRecord, searchIDs map[string]string) {
+	report.Skip("taggers", "", "taggers installed into the source without this service cannot be read from ADP")
+	if len(taggers) == 0 {
+		return
+	}
+
+	taxonomies, err := service.GetApplicationTaxonomies(ctx, adpService, report.ApplicationID)
+	if err != nil {
+		for _, t := range taggers {
+			report.Skip("taggers", t.ID, fmt.Sprintf("cannot read the taxonomies of %s: %v", report.ApplicationID, err))
+		}
+		return
+	}
+
+	infos := make([]adp.TaggerInfo, 0, len(taggers))
+	for _, t := range taggers {
+		info := t.TaggerInfo
+		if id, ok := searchIDs[info.GlobalSearchID]; ok {
+			info.GlobalSearchID = id
+		}
+		if err := service.VerifyTaggers([]adp.TaggerInfo{info}, taxonomies); err != nil {
+			report.Skip("taggers", info.ID, err.Error())
+			continue
+		}
+		infos = append(infos, info)
+	}
+	if len(infos) == 0 {
+		return
+	}
+
+	if err := h.service.InstallTaggers(ctx, adpService, report.ApplicationID, infos); err != nil {
+		logging.Ctx(ctx).Error().Err(err).Msgf("failed to copy the taggers of %s", report.Source)
+		for _, info := range infos {
+			report.Skip("taggers", info.ID, err.Error())
+		}
+		return
+	}
+	for _, info := range infos {
+		report.Copy("taggers", info.ID)
+	}
+}
+
+// sourceCategoryValues reads the values of a category of the source
+// application to copy them under the same IDs.
+func (h *Handler) sourceCategoryValues(ctx context.Context, adpService *adp.Service, source string, categoryType string) ([]service.CategoryValue, error) {
+	category, err := h.service.Category(categoryType)
+	if err != nil {
+		return nil, err
+	}
+
+	listing, err := listCategoryValues(ctx, adpService, source, categoryType, category)
+	if err != nil {
+		return nil, err
+	}
+
+	return service.CategoryValues(listing)
+}
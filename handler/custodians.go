@@ -0,0 +1,91 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/xifanyan/ediscovery-data-service/logging"
+	"github.com/xifanyan/ediscovery-data-service/metrics"
+	"github.com/xifanyan/ediscovery-data-service/service"
+	"github.com/xifanyan/ediscovery-data-service/tracing"
+)
+
+// importCustodians synchronizes the custodians of an application with an HR roster.
+//
+// The roster is uploaded as CSV or XLSX in the "roster" form field. Custodians
+// are compared by normalized name and only the missing ones are created. The
+// response is the reconciliation report; when creating a custodian fails, the
+// report lists the custodians created so far next to the error.
+func (h *Handler) importCustodians(c echo.Context) error {
+	applicationID := c.Param("applicationID")
+
+	r, err := c.FormFile("roster")
+	if err != nil {
+		return c.String(http.StatusBadRequest, fmt.Sprintf("failed to retrieve the uploaded file from form %v", err))
+	}
+
+	tempFile, err := saveToTempFile(r)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, fmt.Sprintf("%v", err))
+	}
+	defer os.Remove(tempFile)
+
+	ctx := c.Request().Context()
+
+	var roster []service.CustodianRecord
+	var invalid []service.InvalidRow
+	err = tracing.Step(ctx, "import.parse", func(context.Context) (err error) {
+		roster, invalid, err = service.GetCustodianRoster(tempFile)
+		return err
+	})
+	if err != nil {
+		return h.handleValidationError(c, err)
+	}
+	metrics.ObserveImportRows("custodians", "custodian", len(roster))
+	metrics.ObserveImportRows("custodians", "invalid", len(invalid))
+
+	category, err := h.service.Category("custodian")
+	if err != nil {
+		return h.handleValidationError(c, err)
+	}
+
+	adpService := h.service.ResetADPServiceWithContextCredential(c)
+
+	custodians, err := service.Call(ctx, "GetCustodiansByApplicationID", service.Bind(adpService.GetCustodiansByApplicationID, applicationID))
+	if err != nil {
+		return h.handleADPError(c, err)
+	}
+
+	existing, err := service.CategoryNames(custodians)
+	if err != nil {
+		return h.handleADPError(c, err)
+	}
+
+	_, span := tracing.Start(ctx, "import.reconcile")
+	report := service.ReconcileCustodians(roster, existing)
+	tracing.End(span, nil)
+	report.Invalid = append(append([]service.InvalidRow{}, invalid...), report.Invalid...)
+	logging.From(c).Debug().Msgf("%s : custodian reconciliation: %+v", applicationID, report)
+
+	toAdd := report.Added
+	report.Added = []service.CustodianRecord{}
+
+	for _, record := range toAdd {
+		if err := service.Exec(ctx, "CreateOrUpdateCategory", func() error {
+			_, err := adpService.CreateOrUpdateCategory(applicationID, category.Name, record.Name, record.Name)
+			return err
+		}); err != nil {
+			logging.From(c).Error().Err(err).Msgf("failed to add custodian %s", record.Name)
+			body := errorBody(c, err)
+			body["report"] = report
+			return c.JSON(http.StatusInternalServerError, body)
+		}
+		report.Added = append(report.Added, record)
+	}
+
+	return c.JSON(http.StatusOK, report)
+}
@@ -0,0 +1,44 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/xifanyan/ediscovery-data-service/service"
+)
+
+// getApplicationDataSources lists the data sources of the application with
+// the state and progress of their crawls.
+func (h *Handler) getApplicationDataSources(c echo.Context) error {
+	applicationID := c.Param("applicationID")
+
+	adpService := h.service.ResetADPServiceWithContextCredential(c)
+	ctx := c.Request().Context()
+	res, err := h.service.ApplicationDataSources(ctx, adpService, applicationID)
+	if err != nil {
+		return h.handleADPError(c, err)
+	}
+
+	return h.listJSON(c, res)
+}
+
+// getDataSourceStatus returns whether the crawl of the data source is running,
+// finished or failed, its start and end time, document and error counts and
+// the custodian, source and batch it classifies documents with.
+func (h *Handler) getDataSourceStatus(c echo.Context) error {
+	dataSourceID := c.Param("dataSourceID")
+
+	adpService := h.service.ResetADPServiceWithContextCredential(c)
+	ctx := c.Request().Context()
+	res, err := h.service.DataSourceStatus(ctx, adpService, dataSourceID)
+	if err != nil {
+		if errors.Is(err, service.ErrDataSourceNotFound) {
+			return c.JSON(http.StatusNotFound, errorBody(c, err))
+		}
+		return h.handleADPError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, res)
+}
@@ -0,0 +1,56 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/xifanyan/ediscovery-data-service/service"
+)
+
+// getDrift compares an application with a baseline, given as the name of a
+// stored baseline or as the ID of another application, which may be on
+// another ADP backend.
+func (h *Handler) getDrift(c echo.Context) error {
+	applicationID := c.Param("applicationID")
+
+	baseline := c.QueryParam("baseline")
+	if baseline == "" {
+		return h.handleValidationError(c, errors.New("baseline is required"))
+	}
+
+	report, err := h.service.CheckDrift(c, applicationID, baseline)
+	if err != nil {
+		if errors.Is(err, service.ErrBaselineNotFound) {
+			return c.JSON(http.StatusNotFound, echo.Map{"error": err.Error()})
+		}
+		return h.handleADPError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, report)
+}
+
+// saveBaseline stores the current configuration of the given application as
+// the named baseline.
+func (h *Handler) saveBaseline(c echo.Context) error {
+	name := c.Param("baselineName")
+
+	app := c.QueryParam("application")
+	if app == "" {
+		return h.handleValidationError(c, service.ErrApplicationRequired)
+	}
+
+	adpService := h.service.ResetADPServiceWithContextCredential(c)
+	ctx := c.Request().Context()
+	snapshot, err := h.service.SnapshotConfiguration(ctx, adpService, app)
+	if err != nil {
+		return h.handleADPError(c, err)
+	}
+
+	if err := h.service.SaveBaseline(name, snapshot); err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, snapshot)
+}
@@ -0,0 +1,137 @@
+package handler
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/xifanyan/ediscovery-data-service/service"
+)
+
+// etag returns the strong entity tag of a response body.
+func etag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// etagMatches reports whether the If-None-Match or If-Match header value
+// matches the tag. Weak tags match their strong counterpart when weak is set.
+func etagMatches(header string, tag string, weak bool) bool {
+	for _, t := range strings.Split(header, ",") {
+		t = strings.TrimSpace(t)
+		if t == "*" {
+			return true
+		}
+		if weak {
+			t = strings.TrimPrefix(t, "W/")
+		}
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// bufferedWriter holds back the response of a GET request until its ETag
+// is known.
+type bufferedWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *bufferedWriter) WriteHeader(status int) {
+	w.status = status
+}
+
+func (w *bufferedWriter) Write(b []byte) (int, error) {
+	return w.body.Write(b)
+}
+
+// Flush is a no-op, the response is written once it is complete.
+func (w *bufferedWriter) Flush() {}
+
+// conditionalGet adds an ETag computed from the payload to every successful
+// GET response and answers 304 Not Modified when it matches If-None-Match.
+func (h *Handler) conditionalGet(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if c.Request().Method != http.MethodGet {
+			return next(c)
+		}
+
+		res := c.Response()
+		orig := res.Writer
+		w := &bufferedWriter{ResponseWriter: orig, status: http.StatusOK}
+		res.Writer = w
+
+		err := next(c)
+		res.Writer = orig
+
+		if !res.Committed {
+			// nothing written yet, e.g. an error left to the error handler
+			return err
+		}
+
+		if w.status == http.StatusOK && orig.Header().Get("ETag") == "" {
+			tag := etag(w.body.Bytes())
+			orig.Header().Set("ETag", tag)
+
+			if inm := c.Request().Header.Get("If-None-Match"); inm != "" && etagMatches(inm, tag, true) {
+				orig.Header().Del(echo.HeaderContentType)
+				orig.Header().Del(echo.HeaderContentLength)
+				orig.WriteHeader(http.StatusNotModified)
+				// the access log and metrics read the response
+				res.Status = http.StatusNotModified
+				res.Size = 0
+				return err
+			}
+		}
+
+		orig.WriteHeader(w.status)
+		if _, werr := orig.Write(w.body.Bytes()); werr != nil && err == nil {
+			err = werr
+		}
+		return err
+	}
+}
+
+// listETag returns the ETag a GET of the list endpoint without paging or
+// filtering parameters answers for the items.
+func listETag(items interface{}) (string, error) {
+	page, err := service.ListQuery{}.Apply(items)
+	if err != nil {
+		return "", err
+	}
+
+	// encoded the way echo's c.JSON does
+	var b bytes.Buffer
+	if err := json.NewEncoder(&b).Encode(page.Items); err != nil {
+		return "", err
+	}
+	return etag(b.Bytes()), nil
+}
+
+// checkIfMatch answers 412 Precondition Failed and returns false when the
+// request has an If-Match header that does not match the current ETag.
+func (h *Handler) checkIfMatch(c echo.Context, current func() (string, error)) (bool, error) {
+	im := c.Request().Header.Get("If-Match")
+	if im == "" {
+		return true, nil
+	}
+
+	tag, err := current()
+	if err != nil {
+		return false, h.handleADPError(c, err)
+	}
+
+	if !etagMatches(im, tag, false) {
+		c.Response().Header().Set("ETag", tag)
+		return false, c.JSON(http.StatusPreconditionFailed, echo.Map{"error": service.ErrPreconditionFailed.Error()})
+	}
+	return true, nil
+}
@@ -0,0 +1,104 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/xifanyan/adp"
+
+	"github.com/xifanyan/ediscovery-data-service/service"
+)
+
+func TestETagMatches(t *testing.T) {
+	const tag = `"abc"`
+
+	tests := []struct {
+		name   string
+		header string
+		weak   bool
+		want   bool
+	}{
+		{"same", `"abc"`, false, true},
+		{"other", `"abd"`, false, false},
+		{"one of a list", `"x", "abc"`, false, true},
+		{"any", `*`, false, true},
+		{"weak with weak comparison", `W/"abc"`, true, true},
+		{"weak with strong comparison", `W/"abc"`, false, false},
+		{"unquoted", `abc`, true, false},
+		{"empty", ``, true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := etagMatches(tt.header, tag, tt.weak); got != tt.want {
+				t.Errorf("etagMatches(%q) = %v, want %v", tt.header, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConditionalGet(t *testing.T) {
+	h := &Handler{}
+	e := echo.New()
+	handler := h.conditionalGet(func(c echo.Context) error {
+		return c.JSON(http.StatusOK, map[string]string{"id": "documentHold.demo"})
+	})
+
+	get := func(inm string) (*httptest.ResponseRecorder, echo.Context) {
+		req := httptest.NewRequest(http.MethodGet, "/getWorkspaces", nil)
+		if inm != "" {
+			req.Header.Set("If-None-Match", inm)
+		}
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		if err := handler(c); err != nil {
+			t.Fatal(err)
+		}
+		return rec, c
+	}
+
+	rec, c := get("")
+	tag := rec.Header().Get("ETag")
+	if rec.Code != http.StatusOK || tag == "" || c.Response().Status != http.StatusOK {
+		t.Fatalf("first GET = %d, ETag %q", rec.Code, tag)
+	}
+
+	rec, c = get(tag)
+	if rec.Code != http.StatusNotModified || rec.Body.Len() != 0 {
+		t.Errorf("GET with If-None-Match = %d with %d bytes", rec.Code, rec.Body.Len())
+	}
+	if c.Response().Status != http.StatusNotModified || c.Response().Size != 0 {
+		t.Errorf("response status = %d, size = %d", c.Response().Status, c.Response().Size)
+	}
+}
+
+func TestTaxonomiesETagIsStable(t *testing.T) {
+	props := make(map[string]adp.IndexConfiguration)
+	for i := 0; i < 32; i++ {
+		props[fmt.Sprintf("rm_taxonomy_%02d", i)] = adp.IndexConfiguration{StructuredView: i%4 != 0}
+	}
+
+	h := &Handler{}
+	e := echo.New()
+	handler := h.conditionalGet(func(c echo.Context) error {
+		return c.JSON(http.StatusOK, service.StructuredViewTaxonomies(props))
+	})
+
+	var tag string
+	for i := 0; i < 10; i++ {
+		rec := httptest.NewRecorder()
+		c := e.NewContext(httptest.NewRequest(http.MethodGet, "/getTaxonomies?application=axcelerate.m1", nil), rec)
+		if err := handler(c); err != nil {
+			t.Fatal(err)
+		}
+
+		got := rec.Header().Get("ETag")
+		if i > 0 && got != tag {
+			t.Fatalf("GET %d has ETag %s, the first one %s", i+1, got, tag)
+		}
+		tag = got
+	}
+}
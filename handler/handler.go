@@ -1,32 +1,69 @@
 package handler
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"mime/multipart"
 	"net/http"
 	"os"
+	"path/filepath"
 	"strings"
-
+	"sync"
+
+	"github.com/xifanyan/ediscovery-data-service/auth"
+	"github.com/xifanyan/ediscovery-data-service/config"
+	"github.com/xifanyan/ediscovery-data-service/legalhold"
+	"github.com/xifanyan/ediscovery-data-service/logging"
+	"github.com/xifanyan/ediscovery-data-service/metrics"
+	"github.com/xifanyan/ediscovery-data-service/provision"
+	"github.com/xifanyan/ediscovery-data-service/ratelimit"
 	"github.com/xifanyan/ediscovery-data-service/service"
+	"github.com/xifanyan/ediscovery-data-service/tracing"
 
 	"github.com/labstack/echo/v4"
-	"github.com/rs/zerolog/log"
 	"github.com/xifanyan/adp"
 )
 
 type Handler struct {
-	service *service.Service
+	service     *service.Service
+	legalHold   *legalhold.Manager
+	provisioner *provision.Provisioner
+	live        *config.Live
+
+	// globalSearchesMu makes the If-Match check and the update of global
+	// searches one step
+	globalSearchesMu sync.Mutex
 }
 
-func NewHandler(service *service.Service) *Handler {
+func NewHandler(service *service.Service, legalHold *legalhold.Manager, provisioner *provision.Provisioner, live *config.Live) *Handler {
 	return &Handler{
-		service: service,
+		service:     service,
+		legalHold:   legalHold,
+		provisioner: provisioner,
+		live:        live,
 	}
 }
 
 func (h *Handler) SetupRouter(e *echo.Echo) {
+	e.Use(h.routeBackend)
+	e.Use(h.idempotent)
+	e.Use(h.invalidateCache)
+	e.Use(h.conditionalGet)
+
+	// Health
+	e.GET(auth.Public("/healthz"), h.getHealth)
+	e.GET(auth.Public("/readyz"), h.getReadiness)
+	e.GET(auth.Public("/diagnostics"), h.getDiagnostics)
+	e.GET(auth.Public("/metrics"), echo.WrapHandler(metrics.Handler()))
+
+	// Admin
+	e.POST("/admin/reload", h.reloadConfig)
+	e.GET("/admin/reload", h.getConfigReload)
 
 	e.GET("/getTemplates", h.getTemplates)
 	e.GET("/getWorkspaces", h.getWorkspaces)
@@ -61,8 +98,29 @@ func (h *Handler) SetupRouter(e *echo.Echo) {
 
 	e.POST("/createApplication", h.createApplication)
 
+	// Matter Provisioning
+	e.POST("/provision", h.provisionMatter)
+	e.GET("/provision/:runID", h.getProvisionRun)
+	e.POST("/provision/:runID/resume", h.resumeProvisionRun)
+
+	// Application Lifecycle
+	e.GET("/applications/:applicationID/status", h.getApplicationStatus)
+	e.POST("/applications/:applicationID/start", h.startApplication)
+	e.POST("/applications/:applicationID/stop", h.stopApplication)
+	e.DELETE("/applications/:applicationID", h.decommissionApplication)
+	e.POST("/applications/:applicationID/clone", h.cloneApplication)
+
+	// Configuration Drift
+	e.GET("/applications/:applicationID/drift", h.getDrift)
+	e.PUT("/baselines/:baselineName", h.saveBaseline)
+
 	e.POST("/submitFtpIngestionData", h.submitFtpIngestionData)
 	e.POST("/submitFileIngestionData", h.submitFileIngestionData)
+	e.GET("/checkpoints", h.getCheckpoints)
+
+	// Data Source Status
+	e.GET("/applications/:applicationID/datasources", h.getApplicationDataSources)
+	e.GET("/datasources/:dataSourceID/status", h.getDataSourceStatus)
 
 	e.GET("/getGlobalSearches", h.getGlobalSearches)
 	e.POST("/createGlobalSearches", h.createGlobalSearches)
@@ -70,82 +128,161 @@ func (h *Handler) SetupRouter(e *echo.Echo) {
 
 	e.POST("/submitTagger", h.submitTagger)
 
+	// Tagger Management
+	e.GET("/applications/:applicationID/taggers", h.getTaggers)
+	e.GET("/applications/:applicationID/taggers/:taggerID", h.getTaggerByID)
+	e.POST("/applications/:applicationID/taggers", h.installApplicationTaggers)
+	e.PUT("/applications/:applicationID/taggers/:taggerID", h.updateApplicationTagger)
+	e.DELETE("/applications/:applicationID/taggers/:taggerID", h.removeApplicationTagger)
+
 	e.POST("/importUsersAndGroups", h.importUsersAndGroups)
 	e.POST("/importGlobalSearchesAndTaggers", h.importGlobalSearchesAndTaggers)
 
 	e.POST("/addRedactionReason", h.addRedactionReason)
 	e.POST("/addCustodian", h.addCustodian)
+	e.POST("/applications/:applicationID/custodians/import", h.importCustodians)
+
+	// Legal Hold Notices
+	e.GET("/holdNoticeTemplates", h.getHoldNoticeTemplates)
+	e.PUT("/holdNoticeTemplates/:templateID", h.putHoldNoticeTemplate)
+	e.POST("/applications/:applicationID/holdNotices", h.sendHoldNotices)
+	e.GET("/applications/:applicationID/holdStatus", h.getHoldStatus)
+	e.GET(auth.Public("/holdNotices/:noticeID/acknowledge"), h.showHoldNotice)
+	e.POST(auth.Public("/holdNotices/:noticeID/acknowledge"), h.acknowledgeHoldNotice)
+
+	// Category Management
+	e.GET("/applications/:applicationID/categories/:categoryType", h.getCategoryValues)
+	e.POST("/applications/:applicationID/categories/:categoryType", h.addCategoryValue)
+	e.POST("/applications/:applicationID/categories/:categoryType/bulk", h.addCategoryValuesBulk)
+	e.PUT("/applications/:applicationID/categories/:categoryType/:valueID", h.renameCategoryValue)
+	e.DELETE("/applications/:applicationID/categories/:categoryType/:valueID", h.removeCategoryValue)
 }
 
-// in echo, Bind query parameters does not work for POST
-type DataIngestionParams struct {
-	Application string
-	Engine      string
-	Datasource  string
-	Template    string
-	Path        string
-	Source      string
-	Custodian   string
-	Batch       string
+// IngestionRequest is the optional JSON body of the ingestion routes. Its
+// fields override the query parameters of the same name.
+type IngestionRequest struct {
+	Application     string                   `json:"application"`
+	Engine          string                   `json:"engine"`
+	DataSource      string                   `json:"dataSource"`
+	Template        string                   `json:"dataSourceTemplate"`
+	Source          string                   `json:"source"`
+	Custodian       string                   `json:"custodian"`
+	Batch           string                   `json:"batch"`
+	FtpPath         string                   `json:"ftpPath"`
+	FilePath        string                   `json:"filePath"`
+	ClassifierRules []service.ClassifierRule `json:"classifierRules"`
 }
 
-func newDataIngestionParams(c echo.Context) *DataIngestionParams {
-	return &DataIngestionParams{
+// bindIngestionRequest reads the ingestion request from the query parameters
+// and the JSON body, which overrides them, and routes the request to the ADP
+// backend of the application of its body. Echo binds query parameters only
+// for GET, DELETE and HEAD, so for POST they are read one by one.
+func (h *Handler) bindIngestionRequest(c echo.Context) (IngestionRequest, error) {
+	req := IngestionRequest{
 		Application: c.QueryParam("application"),
 		Engine:      c.QueryParam("engine"),
-		Datasource:  c.QueryParam("dataSource"),
+		DataSource:  c.QueryParam("dataSource"),
 		Template:    c.QueryParam("dataSourceTemplate"),
 		Source:      c.QueryParam("source"),
 		Custodian:   c.QueryParam("custodian"),
 		Batch:       c.QueryParam("batch"),
+		FtpPath:     c.QueryParam("ftpPath"),
+		FilePath:    c.QueryParam("filePath"),
+	}
+
+	if err := c.Bind(&req); err != nil {
+		return req, err
 	}
+	return req, h.service.RouteApplication(c, req.Application, "")
 }
 
-func geFtpParams(c echo.Context) DataIngestionParams {
+func newDataIngestionParams(req IngestionRequest) *service.DataIngestionParams {
+	return &service.DataIngestionParams{
+		Application: req.Application,
+		Engine:      req.Engine,
+		Datasource:  req.DataSource,
+		Template:    req.Template,
+		Source:      req.Source,
+		Custodian:   req.Custodian,
+		Batch:       req.Batch,
+		Rules:       req.ClassifierRules,
+	}
+}
+
+func geFtpParams(c echo.Context, req IngestionRequest) service.DataIngestionParams {
 	// remove leading slash
-	ftpPath := c.QueryParam("ftpPath")
+	ftpPath := req.FtpPath
 	if len(ftpPath) > 0 && ftpPath[0] == '/' {
 		ftpPath = ftpPath[1:]
 	}
 	ftpPath = fmt.Sprintf("ftp://localhost/%s", ftpPath)
 
-	var params = newDataIngestionParams(c)
+	var params = newDataIngestionParams(req)
 	params.Path = ftpPath
 
-	log.Debug().Msgf("params: %+v", params)
+	logging.From(c).Debug().Msgf("params: %+v", params)
 
 	return *params
 }
 
-func geFileParams(c echo.Context) DataIngestionParams {
-	filePath := c.QueryParam("filePath")
-
-	var params = newDataIngestionParams(c)
-	params.Path = filePath
+func geFileParams(c echo.Context, req IngestionRequest) service.DataIngestionParams {
+	var params = newDataIngestionParams(req)
+	params.Path = req.FilePath
 
-	log.Debug().Msgf("params: %+v", params)
+	logging.From(c).Debug().Msgf("params: %+v", params)
 
 	return *params
 }
 
 func (h *Handler) handleADPError(c echo.Context, err error) error {
+	status := http.StatusInternalServerError
+
+	var unavailable *service.UnavailableError
+	var busy *ratelimit.BusyError
+	switch {
+	case errors.Is(err, service.ErrShuttingDown):
+		status = http.StatusServiceUnavailable
+	case errors.As(err, &unavailable):
+		status = http.StatusServiceUnavailable
+		c.Response().Header().Set("Retry-After", ratelimit.RetryAfterSeconds(unavailable.RetryAfter))
+	case errors.As(err, &busy):
+		status = http.StatusTooManyRequests
+		c.Response().Header().Set("Retry-After", ratelimit.RetryAfterSeconds(busy.RetryAfter))
+	case errors.Is(err, service.ErrADPTimeout):
+		status = http.StatusGatewayTimeout
+	}
+
 	return c.JSON(
-		http.StatusInternalServerError,
-		echo.Map{"error": err.Error()},
+		status,
+		errorBody(c, err),
 	)
 }
 
 func (h *Handler) handleValidationError(c echo.Context, err error) error {
 	return c.JSON(
 		http.StatusBadRequest,
-		echo.Map{"error": err.Error()},
+		errorBody(c, err),
 	)
 }
 
+// errorBody is the body of an error response, with the request and trace IDs
+// of the request so the error can be found in the logs and traces.
+func errorBody(c echo.Context, err error) echo.Map {
+	body := echo.Map{"error": err.Error()}
+	if requestID := logging.RequestID(c); requestID != "" {
+		body["requestID"] = requestID
+	}
+	if traceID := tracing.TraceID(c.Request().Context()); traceID != "" {
+		body["traceID"] = traceID
+	}
+	return body
+}
+
 func (h *Handler) getEntity(c echo.Context) error {
 	userName := c.Get("user").(string)
 
 	adpService := h.service.ResetADPServiceWithContextCredential(c)
+	ctx := c.Request().Context()
 
 	entityType := c.Param("entityType")
 	switch entityType {
@@ -157,14 +294,14 @@ func (h *Handler) getEntity(c echo.Context) error {
 			opts = append(opts, adp.WithListEntitiesWorkspace(c.QueryParam("workspace")))
 		}
 
-		entities, err := adpService.ListEntities(opts...)
+		entities, err := service.Call(ctx, "ListEntities", service.BindV(adpService.ListEntities, opts...))
 
 		if err != nil {
 			return h.handleADPError(c, err)
 		}
 
 		if c.QueryParam("security") != "false" {
-			entities, err = adpService.FindApplicationsUserHasAccess(entities, userName)
+			entities, err = service.Call(ctx, "FindApplicationsUserHasAccess", service.Bind2(adpService.FindApplicationsUserHasAccess, entities, userName))
 			if err != nil {
 				return h.handleADPError(c, err)
 			}
@@ -184,7 +321,7 @@ func (h *Handler) getEntity(c echo.Context) error {
 			return c.JSON(http.StatusNotFound, echo.Map{"error": service.ErrEntityNotFound.Error()})
 		}
 
-		return c.JSON(http.StatusOK, entities)
+		return h.listJSON(c, entities, "workspace", "security", "globalTemplate")
 
 	case "dataSource", "singleMindServer", "mergingMeta":
 		var opts []func(*adp.ListEntitiesConfiguration)
@@ -199,7 +336,7 @@ func (h *Handler) getEntity(c echo.Context) error {
 		//	opts = append(opts, adp.WithListEntitiesUserHasAccess(userName))
 		// }
 
-		entities, err := adpService.ListEntities(opts...)
+		entities, err := service.Call(ctx, "ListEntities", service.BindV(adpService.ListEntities, opts...))
 		if err != nil {
 			return h.handleADPError(c, err)
 		}
@@ -218,7 +355,7 @@ func (h *Handler) getEntity(c echo.Context) error {
 			return c.JSON(http.StatusNotFound, echo.Map{"error": service.ErrEntityNotFound.Error()})
 		}
 
-		return c.JSON(http.StatusOK, entities)
+		return h.listJSON(c, entities, "workspace", "security", "globalTemplate")
 
 	default:
 		return h.handleValidationError(c, service.ErrValidEntityTypeRequired)
@@ -226,198 +363,108 @@ func (h *Handler) getEntity(c echo.Context) error {
 
 }
 
-func createDataSourceOptions(params DataIngestionParams) []func(*adp.CreateDataSourceConfiguration) {
-	opts := []func(*adp.CreateDataSourceConfiguration){
-		adp.WithCreateDatasourceDatasourceIdentifier(params.Datasource),
-		adp.WithCreateDatasourceDatasourceTemplate(params.Template),
-	}
-
-	if params.Engine != "" {
-		opts = append(opts, adp.WithCreateDatasourceEngineIdentifier(params.Engine))
-	} else if params.Application != "" {
-		opts = append(opts, adp.WithCreateDatasourceApplicationIdentifier(params.Application))
-	}
-
-	return opts
-}
-
-func configDataSourceOptions(params DataIngestionParams) []func(*adp.ConfigureDataSourceConfiguration) {
-	configs := []adp.ConfigTableMapsArg{
-		// Update crawl seed URI with the provided path
-		{
-			Action:       "Update",
-			Column:       "0",
-			Row:          0,
-			Substitution: "",
-			TableName:    "crawlSeedURIs",
-			Value:        params.Path,
-		},
-		// Remove any auto-created entries to start with clean mapping
-		{
-			Action:       "Remove",
-			Column:       "0",
-			Row:          0,
-			Substitution: "",
-			TableName:    "crawlLocationClassifierRules",
-			Value:        "*",
-		},
-	}
-
-	// Helper function to create classifier rule entries
-	addClassifierRule := func(row int, pattern, value, field string) {
-		configs = append(configs,
-			adp.ConfigTableMapsArg{
-				Action:       "Append",
-				Column:       "0",
-				Substitution: "",
-				TableName:    "crawlLocationClassifierRules",
-				Value:        pattern,
-			},
-			adp.ConfigTableMapsArg{
-				Action:       "Update",
-				Column:       "1",
-				Row:          row,
-				Substitution: "",
-				TableName:    "crawlLocationClassifierRules",
-				Value:        value,
-			},
-			adp.ConfigTableMapsArg{
-				Action:       "Update",
-				Column:       "2",
-				Row:          row,
-				Substitution: "",
-				TableName:    "crawlLocationClassifierRules",
-				Value:        field,
-			},
-		)
-	}
-
-	type customField struct {
-		name  string
-		value string
-	}
-	var customFields = []customField{}
-
-	// Handle custom fields if present
-	if len(params.Source) == 0 {
-		params.Source = params.Datasource
-	}
-	customFields = append(customFields, customField{name: "rm_source", value: params.Source})
-
-	if len(params.Custodian) != 0 {
-		customFields = append(customFields, customField{name: "rm_custodian", value: params.Custodian})
-	}
-
-	if len(params.Batch) != 0 {
-		customFields = append(customFields, customField{name: "rm_loadbatch", value: params.Batch})
-	}
-
-	for i, field := range customFields {
-		addClassifierRule(i, "*", field.value, field.name)
-	}
-
-	log.Debug().Msgf("configTableMaps: %+v", configs)
-
-	return []func(*adp.ConfigureDataSourceConfiguration){
-		adp.WithConfigureDataSourceNames(params.Datasource),
-		adp.WithConfigureDataSourceMetaDataMappingToConfigTables(configs),
-	}
-}
-
-func startDataSourceOptions(params DataIngestionParams) []func(*adp.StartDataSourceConfiguration) {
-	opts := []func(*adp.StartDataSourceConfiguration){
-		adp.WithStartDataSourceDataSourceName(params.Datasource),
-		adp.WithStartDataSourceSynchronous(false),
-	}
-	return opts
-}
-
-func (h *Handler) submitIngestionData(c echo.Context, params DataIngestionParams) error {
+// submitIngestionData submits the data source and responds with its classifier
+// rules and the changes made to its config tables, so they can be reviewed.
+func (h *Handler) submitIngestionData(c echo.Context, params service.DataIngestionParams) error {
 	adpService := h.service.ResetADPServiceWithContextCredential(c)
-
-	dataSource := params.Datasource
-	if dataSource != "" && !strings.HasPrefix(dataSource, "dataSource.") {
-		dataSource = "dataSource." + dataSource
-	}
-
-	opts := []func(*adp.ListEntitiesConfiguration){
-		adp.WithListEntitiesID(dataSource),
-	}
-
-	dataSources, err := adpService.ListEntities(opts...)
-	if err != nil {
-		log.Error().Err(err).Msg("failed to check datasource exists")
-		return h.handleADPError(c, err)
-	}
-
-	if len(dataSources) > 0 {
-		log.Error().Msgf("datasource %s already exist", dataSource)
-		return h.handleValidationError(c, fmt.Errorf("datasource %s already exist", dataSource))
-	}
-
-	createDataSourceOpts := createDataSourceOptions(params)
-	if err := adpService.CreateDataSource(createDataSourceOpts...); err != nil {
-		log.Error().Err(err).Msg("failed to create datasource")
-		return h.handleADPError(c, err)
-	}
-
-	configDataSourceOpts := configDataSourceOptions(params)
-	if err := adpService.ConfigureDataSource(configDataSourceOpts...); err != nil {
-		log.Error().Err(err).Msg("failed to configure datasource")
-		return h.handleADPError(c, err)
-	}
-
-	startDataSourceOpts := startDataSourceOptions(params)
-	if err := adpService.StartDataSource(startDataSourceOpts...); err != nil {
-		log.Error().Err(err).Msg("failed to start datasource")
+	ctx := c.Request().Context()
+
+	if err := h.service.SubmitIngestionData(ctx, adpService, params); err != nil {
+		if errors.Is(err, service.ErrDataSourceExists) ||
+			errors.Is(err, service.ErrClassifierRuleInvalid) ||
+			errors.Is(err, service.ErrUnknownField) ||
+			errors.Is(err, service.ErrApplicationRequired) {
+			return h.handleValidationError(c, err)
+		}
+		if errors.Is(err, service.ErrOperationInProgress) || errors.Is(err, service.ErrCheckpointMismatch) {
+			return c.JSON(http.StatusConflict, errorBody(c, err))
+		}
 		return h.handleADPError(c, err)
 	}
 
-	return c.JSON(http.StatusOK, nil)
+	return c.JSON(http.StatusOK, echo.Map{
+		"dataSource":      service.DataSourceID(params.Datasource),
+		"classifierRules": service.ClassifierRules(params),
+		"configTableMaps": service.ConfigTableMaps(params),
+	})
 }
 
 func (h *Handler) submitFtpIngestionData(c echo.Context) error {
-	params := geFtpParams(c)
+	req, err := h.bindIngestionRequest(c)
+	if err != nil {
+		return h.handleValidationError(c, err)
+	}
+
+	params := geFtpParams(c, req)
 	return h.submitIngestionData(c, params)
 
 }
 
 func (h *Handler) submitFileIngestionData(c echo.Context) error {
-	params := geFileParams(c)
+	req, err := h.bindIngestionRequest(c)
+	if err != nil {
+		return h.handleValidationError(c, err)
+	}
+
+	params := geFileParams(c, req)
 	return h.submitIngestionData(c, params)
 }
 
 // getDocumentHolds returns all document holds the user has access to.
 //
 // This endpoint first extracts the user name from the echo context and then uses it to query the ADP server for all document holds the user has access to.
+// With "ADP-Backend: all" the document holds of every ADP backend are merged, each tagged with its backend.
 // The result is then returned as JSON.
 func (h *Handler) getDocumentHolds(c echo.Context) error {
 	userName := c.Get("user").(string)
 
+	if fanOut(c) {
+		res, err := h.service.FanOut(c, func(ctx context.Context, adpService *adp.Service) (interface{}, error) {
+			return service.Call(ctx, "ListDocumentHoldsByUser", service.Bind(adpService.ListDocumentHoldsByUser, userName))
+		})
+		if err != nil {
+			return h.handleADPError(c, err)
+		}
+		return h.listJSON(c, res)
+	}
+
 	// Use streamlined ADP service access with automatic credential handling
 	adpService := h.service.ResetADPServiceWithContextCredential(c)
-	res, err := adpService.ListDocumentHoldsByUser(userName)
+	ctx := c.Request().Context()
+	res, err := service.Call(ctx, "ListDocumentHoldsByUser", service.Bind(adpService.ListDocumentHoldsByUser, userName))
 	if err != nil {
 		return h.handleADPError(c, err)
 	}
 
-	return c.JSON(http.StatusOK, res)
+	return h.listJSON(c, res)
 }
 
 // getAxcelerates returns all axcelerates the user has access to.
 //
 // This endpoint first extracts the user name from the echo context and then uses it to query the ADP server for all axcelerates the user has access to.
+// With "ADP-Backend: all" the axcelerates of every ADP backend are merged, each tagged with its backend.
 // The result is then returned as JSON.
 func (h *Handler) getAxcelerates(c echo.Context) error {
 	userName := c.Get("user").(string)
 
+	if fanOut(c) {
+		res, err := h.service.FanOut(c, func(ctx context.Context, adpService *adp.Service) (interface{}, error) {
+			return service.Call(ctx, "ListAxceleratesByUser", service.Bind(adpService.ListAxceleratesByUser, userName))
+		})
+		if err != nil {
+			return h.handleADPError(c, err)
+		}
+		return h.listJSON(c, res)
+	}
+
 	adpService := h.service.ResetADPServiceWithContextCredential(c)
-	res, err := adpService.ListAxceleratesByUser(userName)
+	ctx := c.Request().Context()
+	res, err := service.Call(ctx, "ListAxceleratesByUser", service.Bind(adpService.ListAxceleratesByUser, userName))
 	if err != nil {
 		return h.handleADPError(c, err)
 	}
 
-	return c.JSON(http.StatusOK, res)
+	return h.listJSON(c, res)
 }
 
 // getEngines returns all engines that are associated with the given application and that the user has access to.
@@ -440,7 +487,8 @@ func (h *Handler) getEngines(c echo.Context) error {
 	}
 
 	adpService := h.service.ResetADPServiceWithContextCredential(c)
-	res, err := adpService.ListEntities(opts...)
+	ctx := c.Request().Context()
+	res, err := service.Call(ctx, "ListEntities", service.BindV(adpService.ListEntities, opts...))
 	if err != nil {
 		return h.handleADPError(c, err)
 	}
@@ -460,7 +508,8 @@ func (h *Handler) getCustodians(c echo.Context) error {
 	}
 
 	adpService := h.service.ResetADPServiceWithContextCredential(c)
-	res, err := adpService.GetCustodiansByApplicationID(app)
+	ctx := c.Request().Context()
+	res, err := service.Call(ctx, "GetCustodiansByApplicationID", service.Bind(adpService.GetCustodiansByApplicationID, app))
 	if err != nil {
 		return h.handleADPError(c, err)
 	}
@@ -477,7 +526,8 @@ func (h *Handler) getDataSourceTemplates(c echo.Context) error {
 	userName := c.Get("user").(string)
 
 	adpService := h.service.ResetADPServiceWithContextCredential(c)
-	res, err := adpService.ListDatasourcesByUser(userName)
+	ctx := c.Request().Context()
+	res, err := service.Call(ctx, "ListDatasourcesByUser", service.Bind(adpService.ListDatasourcesByUser, userName))
 	if err != nil {
 		return h.handleADPError(c, err)
 	}
@@ -506,11 +556,16 @@ func saveToTempFile(r *multipart.FileHeader) (string, error) {
 	}
 	defer src.Close()
 
-	// Create a temporary file to store the uploaded Excel file
-	tempFile, err := os.CreateTemp("", "upload-*.xlsx")
+	// Create a temporary file to store the uploaded file, keeping its extension
+	ext := filepath.Ext(r.Filename)
+	if ext == "" {
+		ext = ".xlsx"
+	}
+	tempFile, err := os.CreateTemp("", "upload-*"+ext)
 	if err != nil {
 		return "", fmt.Errorf("failed to create temp file: %v", err)
 	}
+	defer tempFile.Close()
 
 	if _, err = io.Copy(tempFile, src); err != nil {
 		return "", fmt.Errorf("failed to copy the uploaded to temp file: %v", err)
@@ -533,64 +588,106 @@ func (h *Handler) importUsersAndGroups(c echo.Context) error {
 	}
 	defer os.Remove(tempFile)
 
-	userGroupInput, err := service.GetUsersGroupsRoles(tempFile)
+	ctx := c.Request().Context()
+
+	var userGroupInput *service.UserGroupInput
+	err = tracing.Step(ctx, "import.parse", func(context.Context) (err error) {
+		userGroupInput, err = service.GetUsersGroupsRoles(tempFile)
+		return err
+	})
 	if err != nil {
 		return c.JSON(http.StatusBadRequest, err)
 	}
+	metrics.ObserveImportRows("usersAndGroups", "user", len(userGroupInput.Users))
+	metrics.ObserveImportRows("usersAndGroups", "group", len(userGroupInput.Groups))
+	metrics.ObserveImportRows("usersAndGroups", "userToGroup", len(userGroupInput.UserToGroups))
+	metrics.ObserveImportRows("usersAndGroups", "applicationRole", len(userGroupInput.ApplicationRoles))
 
 	adpService := h.service.ResetADPServiceWithContextCredential(c)
 
-	users, groups, err := adpService.GetAllUsersAndGroups()
+	documentHolds, err := service.Call(ctx, "ListDocumentHoldsByUser", service.Bind(adpService.ListDocumentHoldsByUser, userName))
 	if err != nil {
 		return c.JSON(http.StatusBadRequest, err)
 	}
+	logging.From(c).Debug().Msgf("user [%s] has access to documentHolds: %+v", userName, documentHolds)
 
-	if err := service.VerifyUsers(userGroupInput.Users, users); err != nil {
-		return c.JSON(http.StatusBadRequest, err)
-	}
-
-	if err := service.VerifyGroups(userGroupInput.Groups, groups); err != nil {
-		return c.JSON(http.StatusBadRequest, err)
-	}
-
-	documentHolds, err := adpService.ListDocumentHoldsByUser(userName)
+	// the same user importing the same sheet again continues a failed or
+	// interrupted import
+	key, err := fileDigest(tempFile)
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, err)
-	}
-	log.Debug().Msgf("user [%s] has access to documentHolds: %+v", userName, documentHolds)
-
-	if err := service.VerifyApplications(documentHolds, userGroupInput.ApplicationRoles); err != nil {
-		return c.JSON(http.StatusBadRequest, err)
+		return c.String(http.StatusInternalServerError, fmt.Sprintf("%v", err))
 	}
-	log.Debug().Msgf("user [%s] has access to all applications in the sheet", userName)
 
-	var opts []func(*adp.ManageUsersAndGroupsConfiguration) = []func(*adp.ManageUsersAndGroupsConfiguration){}
+	var resp interface{}
+	err = h.service.RunSteps(ctx, "usersAndGroups", userName+":"+key, userGroupInput, []service.OperationStep{
+		{Name: "verify", Fn: func(ctx context.Context) error {
+			users, groups, err := service.Call2(ctx, "GetAllUsersAndGroups", adpService.GetAllUsersAndGroups)
+			if err != nil {
+				return err
+			}
+			if err := service.VerifyUsers(userGroupInput.Users, users); err != nil {
+				return err
+			}
+			if err := service.VerifyGroups(userGroupInput.Groups, groups); err != nil {
+				return err
+			}
+			if err := service.VerifyApplications(documentHolds, userGroupInput.ApplicationRoles); err != nil {
+				return err
+			}
+			logging.Ctx(ctx).Debug().Msgf("user [%s] has access to all applications in the sheet", userName)
+			return nil
+		}},
+		{Name: "manageUsersAndGroups", Fn: func(ctx context.Context) error {
+			opts := service.SetupManageUsersAndGroupsOptions(userGroupInput)
+			resp, err := service.Call(ctx, "ManageUsersAndGroups", service.BindV(adpService.ManageUsersAndGroups, opts...))
+			if err != nil {
+				return err
+			}
+			logging.Ctx(ctx).Debug().Msgf("Setup Users and Groups Response: %+v", resp)
+			return nil
+		}},
+		{Name: "loadApplicationSecurity", Fn: func(ctx context.Context) (err error) {
+			ids := make([]string, 0)
+			for _, documentHold := range documentHolds {
+				ids = append(ids, documentHold.ID)
+			}
+			appIDs := strings.Join(ids, ",")
+			logging.Ctx(ctx).Debug().Msgf("ids: %+v", ids)
 
-	opts = service.SetupManageUsersAndGroupsOptions(userGroupInput)
-	resp, err := adpService.ManageUsersAndGroups(opts...)
-	if err != nil {
+			opts := []func(*adp.ManageUsersAndGroupsConfiguration){
+				adp.WithManageUsersAndGroupsAppIdsToFilterFor(appIDs),
+				adp.WithManageUsersAndGroupsReturnAllUsersUnderGroup("true"),
+			}
+			resp, err = service.Call(ctx, "ManageUsersAndGroups", service.BindV(adpService.ManageUsersAndGroups, opts...))
+			logging.Ctx(ctx).Debug().Msgf("Load Application Security Setting Response: %+v", resp)
+			return err
+		}},
+	})
+	switch {
+	case errors.Is(err, service.ErrShuttingDown):
+		return c.JSON(http.StatusServiceUnavailable, errorBody(c, err))
+	case errors.Is(err, service.ErrOperationInProgress), errors.Is(err, service.ErrCheckpointMismatch):
+		return c.JSON(http.StatusConflict, errorBody(c, err))
+	case err != nil:
 		return c.JSON(http.StatusBadRequest, err)
 	}
-	log.Debug().Msgf("Setup Users and Groups Response: %+v", resp)
 
-	ids := make([]string, 0)
-	for _, documentHold := range documentHolds {
-		ids = append(ids, documentHold.ID)
-	}
-	appIDs := strings.Join(ids, ",")
-	log.Debug().Msgf("ids: %+v", ids)
+	return c.JSON(http.StatusOK, resp)
+}
 
-	opts = []func(*adp.ManageUsersAndGroupsConfiguration){
-		adp.WithManageUsersAndGroupsAppIdsToFilterFor(appIDs),
-		adp.WithManageUsersAndGroupsReturnAllUsersUnderGroup("true"),
-	}
-	resp, err = adpService.ManageUsersAndGroups(opts...)
-	log.Debug().Msgf("Load Application Security Setting Response: %+v", resp)
+// fileDigest returns the hex SHA-256 of the file content.
+func fileDigest(fn string) (string, error) {
+	f, err := os.Open(fn)
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, err)
+		return "", err
 	}
+	defer f.Close()
 
-	return c.JSON(http.StatusOK, resp)
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
 }
 
 func (h *Handler) submitTagger(c echo.Context) error {
@@ -601,9 +698,6 @@ func (h *Handler) submitTagger(c echo.Context) error {
 		return h.handleValidationError(c, service.ErrApplicationRequired)
 	}
 
-	parts := strings.Split(application, ".")
-	applicationType := parts[0]
-
 	tags := []adp.TaggerInfo{
 		{
 			ID:             c.QueryParam("id"),
@@ -614,18 +708,21 @@ func (h *Handler) submitTagger(c echo.Context) error {
 		},
 	}
 
-	log.Debug().Msgf("tags: %+v", tags)
-	js, _ := json.Marshal(tags)
-	log.Debug().Msgf("js: %+v", string(js))
+	logging.From(c).Debug().Msgf("tags: %+v", tags)
 
 	adpService := h.service.ResetADPServiceWithContextCredential(c)
-	err = adpService.ManageTaggers(
-		adp.WithAdpManTagsApplicationIdentifier(application),
-		adp.WithAdpManTagsApplicationType(applicationType),
-		adp.WithAdpManTagsJSONInstall(string(js)),
-		adp.WithAdpManTagsWait4Completion("true"),
-	)
+	ctx := c.Request().Context()
+
+	taxonomies, err := h.service.ApplicationTaxonomies(c, adpService, application)
+	if err != nil {
+		return h.handleADPError(c, err)
+	}
+
+	if err := service.VerifyTaggers(tags, taxonomies); err != nil {
+		return h.handleValidationError(c, err)
+	}
 
+	err = h.service.InstallTaggers(ctx, adpService, application, tags)
 	if err != nil {
 		return h.handleADPError(c, err)
 	}
@@ -640,25 +737,11 @@ func (h *Handler) getTaxonomies(c echo.Context) error {
 	}
 
 	adpService := h.service.ResetADPServiceWithContextCredential(c)
-	entities, err := adpService.ListEntitiesByRelatedEntity("dataModel", app)
+	taxonomies, err := h.service.ApplicationTaxonomies(c, adpService, app)
 	if err != nil {
 		return h.handleADPError(c, err)
 	}
 
-	dataModel := entities[0].ID
-	log.Debug().Msgf("get dataModel: %s", dataModel)
-
-	props, err := adpService.GetIndexConfigurationTable(dataModel)
-	if err != nil {
-		return h.handleADPError(c, err)
-	}
-
-	taxonomies := []string{}
-	for key, prop := range props {
-		if prop.StructuredView {
-			taxonomies = append(taxonomies, key)
-		}
-	}
 	return c.JSON(http.StatusOK, taxonomies)
 }
 
@@ -668,19 +751,17 @@ func (h *Handler) getFieldProperties(c echo.Context) error {
 		return h.handleValidationError(c, service.ErrApplicationRequired)
 	}
 
-	log.Debug().Msgf("application: %s", app)
+	logging.From(c).Debug().Msgf("application: %s", app)
 
 	adpService := h.service.ResetADPServiceWithContextCredential(c)
 
-	entities, err := adpService.ListEntitiesByRelatedEntity("dataModel", app)
+	dataModel, err := h.service.DataModel(c, adpService, app)
 	if err != nil {
 		return h.handleADPError(c, err)
 	}
 
-	dataModel := entities[0].ID
-	log.Debug().Msgf("get dataModel: %s", dataModel)
-
-	props, err := adpService.GetFieldProperties(dataModel)
+	props, err := service.Cached(h.service, c, service.CacheFieldProperties,
+		service.Observed("GetFieldProperties", service.Bind(adpService.GetFieldProperties, dataModel)), dataModel)
 	if err != nil {
 		return h.handleADPError(c, err)
 	}
@@ -697,31 +778,41 @@ func (h *Handler) importGlobalSearchesAndTaggers(c echo.Context) error {
 
 	r, err := c.FormFile("globalSearchesAndTaggers")
 	if err != nil {
-		log.Error().Err(err).Msg("failed to retrieve the uploaded file from form")
+		logging.From(c).Error().Err(err).Msg("failed to retrieve the uploaded file from form")
 		return c.String(http.StatusBadRequest, fmt.Sprintf("failed to retrieve the uploaded file from form %v", err))
 	}
 
 	tempFile, err := saveToTempFile(r)
 	if err != nil {
-		log.Error().Err(err).Msg("failed to save to temp file")
+		logging.From(c).Error().Err(err).Msg("failed to save to temp file")
 		return c.String(http.StatusInternalServerError, fmt.Sprintf("%v", err))
 	}
 	defer os.Remove(tempFile)
 
-	settings, err := service.GetGloalSearchesAndTaggers(tempFile)
+	ctx := c.Request().Context()
+
+	var settings *service.GlobalSearchesAndTaggersInput
+	err = tracing.Step(ctx, "import.parse", func(context.Context) (err error) {
+		settings, err = service.GetGloalSearchesAndTaggers(tempFile)
+		return err
+	})
 	if err != nil {
-		log.Error().Err(err).Msg("failed to get global searches and taggers")
+		logging.From(c).Error().Err(err).Msg("failed to get global searches and taggers")
 		return c.JSON(http.StatusBadRequest, err)
 	}
+	metrics.ObserveImportRows("globalSearchesAndTaggers", "globalSearch", len(settings.GlobalSearchSettings))
+	for _, taggerSetting := range settings.TaggerSettings {
+		metrics.ObserveImportRows("globalSearchesAndTaggers", "tagger", len(taggerSetting.TaggerInfos))
+	}
 
 	js, _ := json.Marshal(settings.GlobalSearchSettings)
 	fmt.Println("js: ", adp.Prettify(string(js)))
 
 	adpService := h.service.ResetADPServiceWithContextCredential(c)
 
-	_, err = adpService.GlobalSearches(
+	_, err = service.Call(ctx, "GlobalSearches", service.BindV(adpService.GlobalSearches,
 		adp.WithGlobalSearchesCreateUpdateGlobalSearches(string(js)),
-	)
+	))
 
 	if err != nil {
 		return c.JSON(http.StatusBadRequest, err)
@@ -730,18 +821,7 @@ func (h *Handler) importGlobalSearchesAndTaggers(c echo.Context) error {
 	settings.TaggerSettings = []service.TaggerSetting{}
 
 	for _, taggerSetting := range settings.TaggerSettings {
-		js, _ := json.Marshal(taggerSetting.TaggerInfos)
-		log.Debug().Msgf("js: %+v", string(js))
-
-		parts := strings.Split(taggerSetting.Application, ".")
-		applicationType := parts[0]
-
-		err = adpService.ManageTaggers(
-			adp.WithAdpManTagsApplicationIdentifier(taggerSetting.Application),
-			adp.WithAdpManTagsApplicationType(applicationType),
-			adp.WithAdpManTagsJSONInstall(string(js)),
-			adp.WithAdpManTagsWait4Completion("true"),
-		)
+		err = h.service.InstallTaggers(ctx, adpService, taggerSetting.Application, taggerSetting.TaggerInfos)
 		if err != nil {
 			return c.JSON(http.StatusBadRequest, err)
 		}
@@ -756,8 +836,14 @@ func (h *Handler) getRedactionReasons(c echo.Context) error {
 		return h.handleValidationError(c, service.ErrApplicationRequired)
 	}
 
+	category, err := h.service.Category("redactionReason")
+	if err != nil {
+		return h.handleValidationError(c, err)
+	}
+
 	adpService := h.service.ResetADPServiceWithContextCredential(c)
-	res, err := adpService.GetCategories(app, "rmRedactReason")
+	ctx := c.Request().Context()
+	res, err := listCategoryValues(ctx, adpService, app, "redactionReason", category)
 	if err != nil {
 		return h.handleADPError(c, err)
 	}
@@ -776,13 +862,7 @@ func (h *Handler) addRedactionReason(c echo.Context) error {
 		return h.handleValidationError(c, service.ErrRedactionReasonRequired)
 	}
 
-	adpService := h.service.ResetADPServiceWithContextCredential(c)
-	res, err := adpService.CreateOrUpdateCategory(app, "Redaction Reason", redactionReason, redactionReason)
-	if err != nil {
-		return h.handleADPError(c, err)
-	}
-
-	return c.JSON(http.StatusOK, res)
+	return h.addLegacyCategoryValue(c, app, "redactionReason", redactionReason)
 }
 
 func (h *Handler) addCustodian(c echo.Context) error {
@@ -796,8 +876,24 @@ func (h *Handler) addCustodian(c echo.Context) error {
 		return h.handleValidationError(c, service.ErrCustodianRequired)
 	}
 
+	return h.addLegacyCategoryValue(c, app, "custodian", custodian)
+}
+
+// addLegacyCategoryValue backs the query parameter based add endpoints, which
+// use the value as both its ID and display name.
+func (h *Handler) addLegacyCategoryValue(c echo.Context, app string, categoryType string, value string) error {
+	category, err := h.service.Category(categoryType)
+	if err != nil {
+		return h.handleValidationError(c, err)
+	}
+
 	adpService := h.service.ResetADPServiceWithContextCredential(c)
-	res, err := adpService.CreateOrUpdateCategory(app, "Custodian", custodian, custodian)
+	ctx := c.Request().Context()
+	var res interface{}
+	err = service.Exec(ctx, "CreateOrUpdateCategory", func() (err error) {
+		res, err = adpService.CreateOrUpdateCategory(app, category.Name, value, value)
+		return err
+	})
 	if err != nil {
 		return h.handleADPError(c, err)
 	}
@@ -808,7 +904,7 @@ func (h *Handler) addCustodian(c echo.Context) error {
 func (h *Handler) getWorkspaces(c echo.Context) error {
 
 	adpService := h.service.ResetADPServiceWithContextCredential(c)
-	res, err := adpService.ListWorkspaces()
+	res, err := service.Cached(h.service, c, service.CacheWorkspaces, service.Observed("ListWorkspaces", adpService.ListWorkspaces))
 	if err != nil {
 		return h.handleADPError(c, err)
 	}
@@ -819,7 +915,7 @@ func (h *Handler) getWorkspaces(c echo.Context) error {
 func (h *Handler) getHosts(c echo.Context) error {
 
 	adpService := h.service.ResetADPServiceWithContextCredential(c)
-	res, err := adpService.ListHosts()
+	res, err := service.Cached(h.service, c, service.CacheHosts, service.Observed("ListHosts", adpService.ListHosts))
 	if err != nil {
 		return h.handleADPError(c, err)
 	}
@@ -840,36 +936,44 @@ func (h *Handler) createApplication(c echo.Context) error {
 	opts, err := checkCreateApplicationParams(c)
 
 	if err != nil {
-		log.Debug().Msgf("check create application params: %+v", err)
+		logging.From(c).Debug().Msgf("check create application params: %+v", err)
+		return h.handleValidationError(c, err)
+	}
+
+	// route to the backend of the application to create
+	application := c.QueryParam("applicationType") + "." + c.QueryParam("applicationName")
+	if err := h.service.RouteApplication(c, application, c.QueryParam("workspace")); err != nil {
 		return h.handleValidationError(c, err)
 	}
 
 	adpService := h.service.ResetADPServiceWithContextCredential(c)
+	ctx := c.Request().Context()
 
-	res, err := adpService.CreateApplication(opts...)
+	res, err := service.Call(ctx, "CreateApplication", service.BindV(adpService.CreateApplication, opts...))
 	if err != nil {
 		return h.handleADPError(c, err)
 	}
 
 	// newAppID := res.ApplicationIdentifier
 	if c.QueryParam("dropTemplate") == "true" {
-		log.Debug().Msgf("dropping template: %s", res.ApplicationIdentifier)
-		err = adpService.DropTemplate(res.ApplicationIdentifier)
+		logging.From(c).Debug().Msgf("dropping template: %s", res.ApplicationIdentifier)
+		err = service.Exec(ctx, "DropTemplate", func() error { return adpService.DropTemplate(res.ApplicationIdentifier) })
 		if err != nil {
 			return h.handleADPError(c, err)
 		}
 	}
 
+	var executionID string
 	if c.QueryParam("startApplication") == "true" {
-		log.Debug().Msgf("starting application: %s", res.ApplicationIdentifier)
-		executionID, err := adpService.StartApplicationAsync(res.ApplicationIdentifier)
+		logging.From(c).Debug().Msgf("starting application: %s", res.ApplicationIdentifier)
+		executionID, err = service.Call(ctx, "StartApplicationAsync", service.Bind(adpService.StartApplicationAsync, res.ApplicationIdentifier))
 		if err != nil {
 			return h.handleADPError(c, err)
 		}
-		log.Debug().Msgf("executionID: %s", executionID)
+		logging.From(c).Debug().Msgf("executionID: %s", executionID)
 	}
 
-	return nil
+	return c.JSON(http.StatusOK, echo.Map{"applicationID": res.ApplicationIdentifier, "executionID": executionID})
 }
 
 func checkCreateApplicationParams(c echo.Context) ([]func(*adp.CreateApplicationConfiguration), error) {
@@ -924,7 +1028,8 @@ func (h *Handler) getTemplates(c echo.Context) error {
 
 	switch entityType {
 	case "documentHold", "axcelerate", "dataSource", "singleMindServer", "mergingMeta":
-		availableTemplates, err = adpService.ListAvailableTemplates(entityType, userName)
+		availableTemplates, err = service.Cached(h.service, c, service.CacheTemplates,
+			service.Observed("ListAvailableTemplates", service.Bind2(adpService.ListAvailableTemplates, entityType, userName)), entityType, userName)
 		if err != nil {
 			return h.handleADPError(c, err)
 		}
@@ -941,7 +1046,8 @@ func (h *Handler) getTemplates(c echo.Context) error {
 func (h *Handler) getUsers(c echo.Context) error {
 
 	adpService := h.service.ResetADPServiceWithContextCredential(c)
-	users, _, err := adpService.GetAllUsersAndGroups()
+	ctx := c.Request().Context()
+	users, _, err := service.Call2(ctx, "GetAllUsersAndGroups", adpService.GetAllUsersAndGroups)
 	if err != nil {
 		return h.handleADPError(c, err)
 	}
@@ -949,14 +1055,15 @@ func (h *Handler) getUsers(c echo.Context) error {
 	if len(users) == 0 {
 		return c.JSON(http.StatusNotFound, echo.Map{"error": service.ErrUserNotFound.Error()})
 	}
-	return c.JSON(http.StatusOK, users)
+	return h.listJSON(c, users)
 }
 
 func (h *Handler) getUserByID(c echo.Context) error {
 	id := c.Param("userID")
 
 	adpService := h.service.ResetADPServiceWithContextCredential(c)
-	user, err := adpService.GetUserByID(id)
+	ctx := c.Request().Context()
+	user, err := service.Call(ctx, "GetUserByID", service.Bind(adpService.GetUserByID, id))
 	if err != nil {
 		return h.handleADPError(c, err)
 	}
@@ -967,7 +1074,8 @@ func (h *Handler) getUserByID(c echo.Context) error {
 func (h *Handler) getGroups(c echo.Context) error {
 
 	adpService := h.service.ResetADPServiceWithContextCredential(c)
-	_, groups, rec := adpService.GetAllUsersAndGroups()
+	ctx := c.Request().Context()
+	_, groups, rec := service.Call2(ctx, "GetAllUsersAndGroups", adpService.GetAllUsersAndGroups)
 	if rec != nil {
 		return h.handleADPError(c, rec)
 	}
@@ -975,14 +1083,15 @@ func (h *Handler) getGroups(c echo.Context) error {
 	if len(groups) == 0 {
 		return c.JSON(http.StatusNotFound, echo.Map{"error": service.ErrGroupNotFound.Error()})
 	}
-	return c.JSON(http.StatusOK, groups)
+	return h.listJSON(c, groups)
 }
 
 func (h *Handler) getGroupByID(c echo.Context) error {
 	id := c.Param("groupID")
 
 	adpService := h.service.ResetADPServiceWithContextCredential(c)
-	group, err := adpService.GetGroupByID(id)
+	ctx := c.Request().Context()
+	group, err := service.Call(ctx, "GetGroupByID", service.Bind(adpService.GetGroupByID, id))
 	if err != nil {
 		return h.handleADPError(c, err)
 	}
@@ -994,7 +1103,8 @@ func (h *Handler) getUsersByGroupID(c echo.Context) error {
 	id := c.Param("groupID")
 
 	adpService := h.service.ResetADPServiceWithContextCredential(c)
-	groups, err := adpService.GetUsersByGroupID(id)
+	ctx := c.Request().Context()
+	groups, err := service.Call(ctx, "GetUsersByGroupID", service.Bind(adpService.GetUsersByGroupID, id))
 	if err != nil {
 		return h.handleADPError(c, err)
 	}
@@ -1009,7 +1119,8 @@ func (h *Handler) getGroupsByUserID(c echo.Context) error {
 	id := c.Param("userID")
 
 	adpService := h.service.ResetADPServiceWithContextCredential(c)
-	groups, err := adpService.GetGroupsByUserID(id)
+	ctx := c.Request().Context()
+	groups, err := service.Call(ctx, "GetGroupsByUserID", service.Bind(adpService.GetGroupsByUserID, id))
 	if err != nil {
 		return h.handleADPError(c, err)
 	}
@@ -1025,10 +1136,11 @@ func (h *Handler) createUsers(c echo.Context) error {
 		return h.handleValidationError(c, err)
 	}
 
-	log.Debug().Msgf("users: %+v", users)
+	logging.From(c).Debug().Msgf("users: %+v", users)
 
 	adpService := h.service.ResetADPServiceWithContextCredential(c)
-	if err := adpService.AddUsers(users); err != nil {
+	ctx := c.Request().Context()
+	if err := service.Exec(ctx, "AddUsers", func() error { return adpService.AddUsers(users) }); err != nil {
 		return h.handleADPError(c, err)
 	}
 
@@ -1043,10 +1155,11 @@ func (h *Handler) createGroups(c echo.Context) error {
 		return h.handleValidationError(c, err)
 	}
 
-	log.Debug().Msgf("groups: %+v", groups)
+	logging.From(c).Debug().Msgf("groups: %+v", groups)
 
 	adpService := h.service.ResetADPServiceWithContextCredential(c)
-	if err := adpService.AddGroups(groups); err != nil {
+	ctx := c.Request().Context()
+	if err := service.Exec(ctx, "AddGroups", func() error { return adpService.AddGroups(groups) }); err != nil {
 		return h.handleADPError(c, err)
 	}
 
@@ -1063,7 +1176,8 @@ func (h *Handler) addUsersToGroup(c echo.Context) error {
 	}
 
 	adpService := h.service.ResetADPServiceWithContextCredential(c)
-	if err := adpService.AddUsersToGroup(users, groupID); err != nil {
+	ctx := c.Request().Context()
+	if err := service.Exec(ctx, "AddUsersToGroup", func() error { return adpService.AddUsersToGroup(users, groupID) }); err != nil {
 		return h.handleADPError(c, err)
 	}
 
@@ -1090,10 +1204,11 @@ func (h *Handler) addUsersOrGroupsToApplication(c echo.Context) error {
 		})
 	}
 
-	log.Debug().Msgf("%s : converted roles: %+v", applicationID, appRoles)
+	logging.From(c).Debug().Msgf("%s : converted roles: %+v", applicationID, appRoles)
 
 	adpService := h.service.ResetADPServiceWithContextCredential(c)
-	if err := adpService.AssignUsersOrGroupsToApplication(appRoles); err != nil {
+	ctx := c.Request().Context()
+	if err := service.Exec(ctx, "AssignUsersOrGroupsToApplication", func() error { return adpService.AssignUsersOrGroupsToApplication(appRoles) }); err != nil {
 		return h.handleADPError(c, err)
 	}
 
@@ -1104,7 +1219,8 @@ func (h *Handler) getUsersAndGroupsByApplicationID(c echo.Context) error {
 	applicationID := c.Param("applicationID")
 
 	adpService := h.service.ResetADPServiceWithContextCredential(c)
-	users, groups, err := adpService.GetUsersAndGroupsByApplicationID(applicationID)
+	ctx := c.Request().Context()
+	users, groups, err := service.Call2(ctx, "GetUsersAndGroupsByApplicationID", service.BindPair(adpService.GetUsersAndGroupsByApplicationID, applicationID))
 	if err != nil {
 		return h.handleADPError(c, err)
 	}
@@ -1115,12 +1231,12 @@ func (h *Handler) getUsersAndGroupsByApplicationID(c echo.Context) error {
 func (h *Handler) getGlobalSearches(c echo.Context) error {
 
 	adpService := h.service.ResetADPServiceWithContextCredential(c)
-	res, err := adpService.ListGlobalSearches()
+	res, err := service.Cached(h.service, c, service.CacheGlobalSearches, service.Observed("ListGlobalSearches", adpService.ListGlobalSearches))
 	if err != nil {
 		return h.handleADPError(c, err)
 	}
 
-	return c.JSON(http.StatusOK, res)
+	return h.listJSON(c, res)
 }
 
 func (h *Handler) createGlobalSearches(c echo.Context) error {
@@ -1131,10 +1247,11 @@ func (h *Handler) createGlobalSearches(c echo.Context) error {
 		return h.handleValidationError(c, err)
 	}
 
-	log.Debug().Msgf("[New] Global Search Definition: %+v", gsdef)
+	logging.From(c).Debug().Msgf("[New] Global Search Definition: %+v", gsdef)
 
 	adpService := h.service.ResetADPServiceWithContextCredential(c)
-	res, err := adpService.CreateGlobalSearches(gsdef)
+	ctx := c.Request().Context()
+	res, err := service.Call(ctx, "CreateGlobalSearches", service.Bind(adpService.CreateGlobalSearches, gsdef))
 	if err != nil {
 		return h.handleADPError(c, err)
 	}
@@ -1149,10 +1266,27 @@ func (h *Handler) updateGlobalSearches(c echo.Context) error {
 	if err != nil {
 		return h.handleValidationError(c, err)
 	}
-	log.Debug().Msgf("[Update] Global Search Definition: %+v", gsdef)
+	logging.From(c).Debug().Msgf("[Update] Global Search Definition: %+v", gsdef)
 
 	adpService := h.service.ResetADPServiceWithContextCredential(c)
-	res, err := adpService.UpdateGlobalSearches(gsdef)
+	ctx := c.Request().Context()
+
+	// If-Match is checked against the ETag of /getGlobalSearches
+	h.globalSearchesMu.Lock()
+	defer h.globalSearchesMu.Unlock()
+
+	ok, err := h.checkIfMatch(c, func() (string, error) {
+		current, err := service.Call(ctx, "ListGlobalSearches", adpService.ListGlobalSearches)
+		if err != nil {
+			return "", err
+		}
+		return listETag(current)
+	})
+	if !ok {
+		return err
+	}
+
+	res, err := service.Call(ctx, "UpdateGlobalSearches", service.Bind(adpService.UpdateGlobalSearches, gsdef))
 	if err != nil {
 		return h.handleADPError(c, err)
 	}
@@ -0,0 +1,28 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// getHealth answers as long as the service is running.
+func (h *Handler) getHealth(c echo.Context) error {
+	return c.JSON(http.StatusOK, echo.Map{"status": "ok"})
+}
+
+// getReadiness answers 503 until the config is valid, the log file is
+// writable and ADP answers.
+func (h *Handler) getReadiness(c echo.Context) error {
+	ready, checks := h.service.Readiness(c.Request().Context())
+
+	status := http.StatusOK
+	if !ready {
+		status = http.StatusServiceUnavailable
+	}
+	return c.JSON(status, echo.Map{"ready": ready, "checks": checks})
+}
+
+func (h *Handler) getDiagnostics(c echo.Context) error {
+	return c.JSON(http.StatusOK, h.service.Diagnostics(c.Request().Context()))
+}
@@ -0,0 +1,146 @@
+package handler
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/xifanyan/ediscovery-data-service/logging"
+	"github.com/xifanyan/ediscovery-data-service/service"
+)
+
+const (
+	idempotencyKeyHeader     = "Idempotency-Key"
+	idempotentReplayedHeader = "Idempotent-Replayed"
+	maxIdempotencyKeyLength  = 255
+)
+
+// idempotentRoutes are the mutating requests whose responses are stored for
+// their Idempotency-Key, so a client retrying after a timeout does not create
+// or import the same things twice.
+var idempotentRoutes = map[string]struct{}{
+	"/createApplication":                 {},
+	"/users":                             {},
+	"/submitFileIngestionData":           {},
+	"/application/:applicationID/users":  {},
+	"/application/:applicationID/groups": {},
+}
+
+// resumableRoutes are the idempotentRoutes that checkpoint their steps, so a
+// retry of one that failed with a server error continues it instead of
+// replaying the error.
+var resumableRoutes = map[string]struct{}{
+	"/submitFileIngestionData": {},
+}
+
+func validIdempotencyKey(key string) bool {
+	if len(key) > maxIdempotencyKeyLength {
+		return false
+	}
+	for _, r := range key {
+		if r < 0x20 || r > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// idempotent replays the stored response of a request whose Idempotency-Key
+// was used before by the same user within idempotency.window, and stores the
+// response of a new one. Reusing a key for a different request is rejected
+// with 422. Server errors are stored as well, as the request may have done
+// part of its work, and replayed unless the route is resumable. A request
+// that writes no response, e.g. one that panicked, ends without storing one.
+func (h *Handler) idempotent(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := c.Request()
+		key := req.Header.Get(idempotencyKeyHeader)
+		if key == "" || req.Method == http.MethodGet {
+			return next(c)
+		}
+		if _, ok := idempotentRoutes[c.Path()]; !ok {
+			return next(c)
+		}
+		if !validIdempotencyKey(key) {
+			return h.handleValidationError(c, service.ErrIdempotencyKeyInvalid)
+		}
+
+		body, err := io.ReadAll(req.Body)
+		if err != nil {
+			return h.handleValidationError(c, err)
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+
+		sum := sha256.New()
+		sum.Write([]byte(req.Method + "\n" + req.URL.RequestURI() + "\n"))
+		sum.Write(body)
+		fingerprint := hex.EncodeToString(sum.Sum(nil))
+
+		user, _ := c.Get("user").(string)
+
+		_, resumable := resumableRoutes[c.Path()]
+		stored, err := h.service.BeginIdempotent(user, key, fingerprint, resumable)
+		switch {
+		case errors.Is(err, service.ErrIdempotencyKeyReused):
+			return c.JSON(http.StatusUnprocessableEntity, errorBody(c, err))
+		case errors.Is(err, service.ErrIdempotencyKeyInFlight):
+			return c.JSON(http.StatusConflict, errorBody(c, err))
+		case err != nil:
+			return h.handleADPError(c, err)
+		}
+
+		if stored != nil {
+			logging.From(c).Info().Msgf("replaying response of %s %s", idempotencyKeyHeader, key)
+			c.Response().Header().Set(idempotentReplayedHeader, "true")
+			return c.Blob(stored.Status, stored.ContentType, stored.Body)
+		}
+
+		res := c.Response()
+		orig := res.Writer
+		w := &bufferedWriter{ResponseWriter: orig, status: http.StatusOK}
+		res.Writer = w
+
+		// a panic leaves the request to the recover middleware, which answers
+		// on the original writer, and the key to a retry
+		completed := false
+		defer func() {
+			res.Writer = orig
+			if !completed {
+				h.service.AbandonIdempotent(user, key)
+			}
+		}()
+
+		err = next(c)
+		res.Writer = orig
+
+		if res.Committed {
+			completed = true
+			if storeErr := h.service.CompleteIdempotent(service.IdempotentResponse{
+				Key:         key,
+				User:        user,
+				Fingerprint: fingerprint,
+				Status:      w.status,
+				ContentType: orig.Header().Get(echo.HeaderContentType),
+				Body:        w.body.Bytes(),
+			}); storeErr != nil {
+				logging.From(c).Error().Err(storeErr).Msgf("failed to store response of %s %s", idempotencyKeyHeader, key)
+			}
+		}
+
+		if !res.Committed {
+			// nothing written yet, e.g. an error left to the error handler
+			return err
+		}
+
+		orig.WriteHeader(w.status)
+		if _, werr := orig.Write(w.body.Bytes()); werr != nil && err == nil {
+			err = werr
+		}
+		return err
+	}
+}
@@ -0,0 +1,96 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/xifanyan/ediscovery-data-service/config"
+	"github.com/xifanyan/ediscovery-data-service/service"
+)
+
+func newIdempotencyTestHandler(t *testing.T) *Handler {
+	t.Helper()
+
+	var cfg config.Config
+	cfg.Idempotency.Store = t.TempDir()
+	cfg.Shutdown.Checkpoints = t.TempDir()
+	return &Handler{service: service.NewService(cfg)}
+}
+
+// serveIdempotent runs handler behind the idempotent middleware as the route
+// path with the Idempotency-Key "k1".
+func serveIdempotent(h *Handler, path string, handler echo.HandlerFunc) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(`{"name":"a"}`))
+	req.Header.Set(idempotencyKeyHeader, "k1")
+	rec := httptest.NewRecorder()
+
+	c := echo.New().NewContext(req, rec)
+	c.SetPath(path)
+	c.Set("user", "jane")
+	h.idempotent(handler)(c)
+	return rec
+}
+
+func TestIdempotentServerErrors(t *testing.T) {
+	tests := []struct {
+		path     string
+		wantRuns int
+	}{
+		// not resumable: the failed attempt may have done part of its work
+		{"/users", 1},
+		// resumable: the retry continues after the checkpoint
+		{"/submitFileIngestionData", 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			h := newIdempotencyTestHandler(t)
+
+			runs := 0
+			handler := func(c echo.Context) error {
+				runs++
+				return c.JSON(http.StatusGatewayTimeout, echo.Map{"error": "ADP did not answer in time"})
+			}
+
+			first := serveIdempotent(h, tt.path, handler)
+			retry := serveIdempotent(h, tt.path, handler)
+
+			if first.Code != http.StatusGatewayTimeout || retry.Code != http.StatusGatewayTimeout {
+				t.Fatalf("status = %d, %d", first.Code, retry.Code)
+			}
+			if runs != tt.wantRuns {
+				t.Errorf("handler ran %d times, want %d", runs, tt.wantRuns)
+			}
+			if replayed := retry.Header().Get(idempotentReplayedHeader) == "true"; replayed != (tt.wantRuns == 1) {
+				t.Errorf("%s = %v", idempotentReplayedHeader, replayed)
+			}
+		})
+	}
+}
+
+func TestIdempotentPanic(t *testing.T) {
+	h := newIdempotencyTestHandler(t)
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("the panic did not reach the caller")
+			}
+		}()
+		serveIdempotent(h, "/users", func(c echo.Context) error {
+			panic(errors.New("nil map"))
+		})
+	}()
+
+	rec := serveIdempotent(h, "/users", func(c echo.Context) error {
+		return c.JSON(http.StatusOK, echo.Map{"created": 1})
+	})
+	if rec.Code != http.StatusOK {
+		t.Errorf("retry after a panic = %d %s", rec.Code, rec.Body)
+	}
+}
@@ -0,0 +1,146 @@
+package handler
+
+import (
+	"bytes"
+	"errors"
+	"html/template"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/xifanyan/ediscovery-data-service/legalhold"
+	"github.com/xifanyan/ediscovery-data-service/logging"
+)
+
+type SendHoldNoticesRequest struct {
+	TemplateID string                `json:"templateID"`
+	Matter     string                `json:"matter"`
+	Custodians []legalhold.Recipient `json:"custodians"`
+}
+
+func (h *Handler) getHoldNoticeTemplates(c echo.Context) error {
+	return c.JSON(http.StatusOK, h.legalHold.Templates())
+}
+
+func (h *Handler) putHoldNoticeTemplate(c echo.Context) error {
+	var t legalhold.Template
+	if err := c.Bind(&t); err != nil {
+		return h.handleValidationError(c, err)
+	}
+	t.ID = c.Param("templateID")
+
+	if err := h.legalHold.PutTemplate(t); err != nil {
+		if errors.Is(err, legalhold.ErrTemplateIDRequired) {
+			return h.handleValidationError(c, err)
+		}
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, t)
+}
+
+// sendHoldNotices sends the hold notice to the given custodians of an application.
+//
+// Delivery failures are recorded on the returned notices rather than failing
+// the request, so the caller can see which custodians were reached.
+func (h *Handler) sendHoldNotices(c echo.Context) error {
+	applicationID := c.Param("applicationID")
+
+	var req SendHoldNoticesRequest
+	if err := c.Bind(&req); err != nil {
+		return h.handleValidationError(c, err)
+	}
+
+	logging.From(c).Debug().Msgf("%s : send hold notices: %+v", applicationID, req)
+
+	notices, err := h.legalHold.SendNotices(applicationID, req.Matter, req.TemplateID, req.Custodians)
+	if err != nil {
+		switch {
+		case errors.Is(err, legalhold.ErrTemplateNotFound):
+			return c.JSON(http.StatusNotFound, echo.Map{"error": err.Error()})
+		case len(notices) == 0:
+			return h.handleValidationError(c, err)
+		default:
+			return c.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error(), "notices": notices})
+		}
+	}
+
+	return c.JSON(http.StatusOK, notices)
+}
+
+// getHoldStatus returns the acknowledgement status of the hold notices of an
+// application, listing the custodians who have not acknowledged yet.
+func (h *Handler) getHoldStatus(c echo.Context) error {
+	return c.JSON(http.StatusOK, h.legalHold.Status(c.Param("applicationID")))
+}
+
+// acknowledgePage is shown for the link in a hold notice. Opening the link
+// only shows the notice, the acknowledgement is recorded by the form, so a
+// mail scanner following the link does not acknowledge for the custodian.
+var acknowledgePage = template.Must(template.New("acknowledge").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><meta name="robots" content="noindex"><title>Legal hold notice: {{.Matter}}</title></head>
+<body>
+<h1>Legal hold notice: {{.Matter}}</h1>
+{{if .AcknowledgedAt}}
+<p>{{.Custodian}}, your acknowledgement was recorded on {{.AcknowledgedAt.Format "2006-01-02 15:04 MST"}}.</p>
+{{else}}
+<p>{{.Custodian}}, please confirm that you have received and read the legal hold notice for {{.Matter}} and will preserve the information it describes.</p>
+<form method="post">
+<input type="hidden" name="exp" value="{{.Exp}}">
+<input type="hidden" name="sig" value="{{.Sig}}">
+<button type="submit">I acknowledge the legal hold notice</button>
+</form>
+{{end}}
+</body>
+</html>
+`))
+
+// holdNoticeError answers a failed check of an acknowledgement link.
+func holdNoticeError(c echo.Context, err error) error {
+	switch {
+	case errors.Is(err, legalhold.ErrInvalidSignature):
+		return c.String(http.StatusForbidden, err.Error())
+	case errors.Is(err, legalhold.ErrLinkExpired):
+		return c.String(http.StatusGone, err.Error()+", please ask for the notice to be sent again")
+	case errors.Is(err, legalhold.ErrNoticeNotFound):
+		return c.String(http.StatusNotFound, err.Error())
+	default:
+		logging.From(c).Error().Err(err).Msg("failed to record acknowledgement")
+		return c.String(http.StatusInternalServerError, "failed to record acknowledgement")
+	}
+}
+
+// showHoldNotice is the target of the link in a hold notice. It is a public
+// route, the signature in the link authenticates the custodian.
+func (h *Handler) showHoldNotice(c echo.Context) error {
+	exp, sig := c.QueryParam("exp"), c.QueryParam("sig")
+
+	notice, err := h.legalHold.Verify(c.Param("noticeID"), exp, sig)
+	if err != nil {
+		return holdNoticeError(c, err)
+	}
+
+	var page bytes.Buffer
+	if err := acknowledgePage.Execute(&page, struct {
+		legalhold.Notice
+		Exp string
+		Sig string
+	}{notice, exp, sig}); err != nil {
+		return err
+	}
+
+	c.Response().Header().Set("Cache-Control", "no-store")
+	return c.HTMLBlob(http.StatusOK, page.Bytes())
+}
+
+// acknowledgeHoldNotice records the acknowledgement posted by the form of
+// showHoldNotice.
+func (h *Handler) acknowledgeHoldNotice(c echo.Context) error {
+	notice, err := h.legalHold.Acknowledge(c.Param("noticeID"), c.FormValue("exp"), c.FormValue("sig"))
+	if err != nil {
+		return holdNoticeError(c, err)
+	}
+
+	return c.String(http.StatusOK, "Thank you, your acknowledgement of the legal hold notice for "+notice.Matter+" has been recorded.")
+}
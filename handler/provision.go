@@ -0,0 +1,111 @@
+package handler
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/xifanyan/ediscovery-data-service/logging"
+	"github.com/xifanyan/ediscovery-data-service/provision"
+	"github.com/xifanyan/ediscovery-data-service/service"
+)
+
+// provisionRunResponse answers with the run, using 500 when a step failed and
+// 503 when the shutdown stopped it so callers notice, and pointing them to the
+// resume endpoint.
+func (h *Handler) provisionRunResponse(c echo.Context, run provision.Run, err error) error {
+	if err != nil {
+		switch {
+		case errors.Is(err, provision.ErrRunNotFound):
+			return c.JSON(http.StatusNotFound, echo.Map{"error": err.Error()})
+		case errors.Is(err, provision.ErrRunInProgress), errors.Is(err, provision.ErrRunCompleted):
+			return c.JSON(http.StatusConflict, echo.Map{"error": err.Error()})
+		case errors.Is(err, service.ErrShuttingDown):
+			return c.JSON(http.StatusServiceUnavailable, echo.Map{"error": err.Error()})
+		default:
+			return c.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error(), "run": run})
+		}
+	}
+
+	switch run.Status {
+	case provision.StatusFailed:
+		return c.JSON(http.StatusInternalServerError, run)
+	case provision.StatusInterrupted:
+		return c.JSON(http.StatusServiceUnavailable, run)
+	}
+	return c.JSON(http.StatusOK, run)
+}
+
+// provisionMatter applies the matter blueprint in the request body.
+//
+// The body is a YAML or JSON blueprint. Query parameters fill in its ${name}
+// placeholders, so one blueprint can serve many matters.
+func (h *Handler) provisionMatter(c echo.Context) error {
+	userName := c.Get("user").(string)
+
+	doc, err := io.ReadAll(c.Request().Body)
+	if err != nil {
+		return h.handleValidationError(c, err)
+	}
+
+	params := make(map[string]string)
+	for name, values := range c.QueryParams() {
+		if len(values) > 0 {
+			params[name] = values[0]
+		}
+	}
+
+	doc, err = provision.Substitute(doc, params)
+	if err != nil {
+		return h.handleValidationError(c, err)
+	}
+
+	bp, err := provision.Parse(doc)
+	if err != nil {
+		return h.handleValidationError(c, err)
+	}
+
+	logging.From(c).Debug().Msgf("blueprint: %+v", bp)
+
+	if err := h.routeBlueprint(c, bp); err != nil {
+		return h.handleValidationError(c, err)
+	}
+
+	adpService := h.service.ResetADPServiceWithContextCredential(c)
+	ctx := c.Request().Context()
+	run, err := h.provisioner.Start(ctx, adpService, bp, params, userName)
+	return h.provisionRunResponse(c, run, err)
+}
+
+func (h *Handler) getProvisionRun(c echo.Context) error {
+	run, err := h.provisioner.Get(c.Param("runID"))
+	if err != nil {
+		return h.provisionRunResponse(c, run, err)
+	}
+	return c.JSON(http.StatusOK, run)
+}
+
+// resumeProvisionRun continues a failed run with the step that failed.
+func (h *Handler) resumeProvisionRun(c echo.Context) error {
+	run, err := h.provisioner.Get(c.Param("runID"))
+	if err != nil {
+		return h.provisionRunResponse(c, run, err)
+	}
+	if err := h.routeBlueprint(c, run.Blueprint); err != nil {
+		return h.handleValidationError(c, err)
+	}
+
+	adpService := h.service.ResetADPServiceWithContextCredential(c)
+	ctx := c.Request().Context()
+	run, err = h.provisioner.Resume(ctx, adpService, c.Param("runID"))
+	return h.provisionRunResponse(c, run, err)
+}
+
+// routeBlueprint routes the request to the ADP backend of the application of
+// the blueprint.
+func (h *Handler) routeBlueprint(c echo.Context, bp provision.Blueprint) error {
+	app := bp.Application
+	return h.service.RouteApplication(c, app.Type+"."+app.Name, app.Workspace)
+}
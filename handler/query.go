@@ -0,0 +1,38 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/xifanyan/ediscovery-data-service/service"
+)
+
+// listJSON writes items as the page selected by the limit, cursor, sort,
+// fields and filter query parameters. The number of matching items is
+// returned in X-Total-Count and the cursor of the next page, if any, in
+// X-Next-Cursor. Query parameters in reserved are handled by the endpoint, a
+// filter on a field the items do not have is answered with 400.
+func (h *Handler) listJSON(c echo.Context, items interface{}, reserved ...string) error {
+	q, err := service.ParseListQuery(c.QueryParams(), reserved...)
+	if err != nil {
+		return h.handleValidationError(c, err)
+	}
+
+	page, err := q.Apply(items)
+	if errors.Is(err, service.ErrUnknownField) {
+		return h.handleValidationError(c, err)
+	}
+	if err != nil {
+		return h.handleADPError(c, err)
+	}
+
+	c.Response().Header().Set("X-Total-Count", strconv.Itoa(page.Total))
+	if page.NextCursor != "" {
+		c.Response().Header().Set("X-Next-Cursor", page.NextCursor)
+	}
+
+	return c.JSON(http.StatusOK, page.Items)
+}
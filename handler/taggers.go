@@ -0,0 +1,128 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/xifanyan/adp"
+
+	"github.com/xifanyan/ediscovery-data-service/logging"
+	"github.com/xifanyan/ediscovery-data-service/service"
+)
+
+// getTaggers lists the taggers the service installed into the application.
+//
+// ADP has no call that lists the taggers of an application, so taggers
+// installed by other means than this service are not listed.
+func (h *Handler) getTaggers(c echo.Context) error {
+	taggers, err := h.service.Taggers(c.Request().Context(), c.Param("applicationID"))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, errorBody(c, err))
+	}
+
+	return h.listJSON(c, taggers)
+}
+
+// getTaggerByID returns a tagger the service installed into the application.
+func (h *Handler) getTaggerByID(c echo.Context) error {
+	tagger, err := h.service.Tagger(c.Request().Context(), c.Param("applicationID"), c.Param("taggerID"))
+	if errors.Is(err, service.ErrTaggerNotFound) {
+		return c.JSON(http.StatusNotFound, errorBody(c, err))
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, errorBody(c, err))
+	}
+
+	return c.JSON(http.StatusOK, tagger)
+}
+
+// installApplicationTaggers installs the taggers given as JSON array in the request body.
+//
+// Every tagger is validated against the taxonomies of the application before
+// anything is sent to ADP, so a single invalid tagger rejects the whole batch.
+func (h *Handler) installApplicationTaggers(c echo.Context) error {
+	applicationID := c.Param("applicationID")
+
+	var taggers []adp.TaggerInfo
+	if err := c.Bind(&taggers); err != nil {
+		return h.handleValidationError(c, err)
+	}
+
+	logging.From(c).Debug().Msgf("%s : taggers: %+v", applicationID, taggers)
+
+	adpService := h.service.ResetADPServiceWithContextCredential(c)
+	ctx := c.Request().Context()
+
+	taxonomies, err := h.service.ApplicationTaxonomies(c, adpService, applicationID)
+	if err != nil {
+		return h.handleADPError(c, err)
+	}
+
+	if err := service.VerifyTaggers(taggers, taxonomies); err != nil {
+		return h.handleValidationError(c, err)
+	}
+
+	if err := h.service.InstallTaggers(ctx, adpService, applicationID, taggers); err != nil {
+		return h.handleADPError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, taggers)
+}
+
+// updateApplicationTagger replaces the tagger identified by the path with the one in the request body.
+func (h *Handler) updateApplicationTagger(c echo.Context) error {
+	applicationID := c.Param("applicationID")
+	taggerID := c.Param("taggerID")
+
+	var tagger adp.TaggerInfo
+	if err := c.Bind(&tagger); err != nil {
+		return h.handleValidationError(c, err)
+	}
+
+	// the ID in the path always wins over the one in the body
+	tagger.ID = taggerID
+	taggers := []adp.TaggerInfo{tagger}
+
+	logging.From(c).Debug().Msgf("%s : update tagger: %+v", applicationID, tagger)
+
+	adpService := h.service.ResetADPServiceWithContextCredential(c)
+	ctx := c.Request().Context()
+
+	taxonomies, err := h.service.ApplicationTaxonomies(c, adpService, applicationID)
+	if err != nil {
+		return h.handleADPError(c, err)
+	}
+
+	if err := service.VerifyTaggers(taggers, taxonomies); err != nil {
+		return h.handleValidationError(c, err)
+	}
+
+	if err := h.service.InstallTaggers(ctx, adpService, applicationID, taggers); err != nil {
+		return h.handleADPError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, tagger)
+}
+
+// removeApplicationTagger would uninstall a tagger from an application.
+//
+// The ADP manage taggers task only installs taggers and the ADP client has no
+// other call that removes one, so removal is blocked on ADP: the route answers
+// 404 for a tagger the service does not know and 501 otherwise, leaving the
+// tagger and its record as they are.
+func (h *Handler) removeApplicationTagger(c echo.Context) error {
+	applicationID := c.Param("applicationID")
+
+	tagger, err := h.service.Tagger(c.Request().Context(), applicationID, c.Param("taggerID"))
+	if errors.Is(err, service.ErrTaggerNotFound) {
+		return c.JSON(http.StatusNotFound, errorBody(c, err))
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, errorBody(c, err))
+	}
+
+	err = fmt.Errorf("%w: ADP cannot uninstall tagger %s from %s", service.ErrNotImplemented, tagger.ID, applicationID)
+	return c.JSON(http.StatusNotImplemented, errorBody(c, err))
+}
@@ -0,0 +1,16 @@
+package legalhold
+
+import "errors"
+
+var (
+	ErrTemplateIDRequired  = errors.New("template id is required")
+	ErrRecipientRequired   = errors.New("at least one custodian is required")
+	ErrSMTPNotConfigured   = errors.New("smtp relay is not configured")
+	ErrInvalidSignature    = errors.New("invalid acknowledgement signature")
+	ErrLinkExpired         = errors.New("acknowledgement link has expired")
+	ErrInvalidAddress      = errors.New("invalid mail address")
+	ErrInvalidHeader       = errors.New("mail header value contains a line break")
+	ErrTemplateNotFound    = errors.New("notice template not found")
+	ErrNoticeNotFound      = errors.New("notice not found")
+	ErrApplicationRequired = errors.New("application is required")
+)
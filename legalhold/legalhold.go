@@ -0,0 +1,410 @@
+// Package legalhold sends legal hold notices to custodians and tracks their
+// delivery and acknowledgement.
+package legalhold
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/xifanyan/ediscovery-data-service/config"
+)
+
+const (
+	KindNotice     = "notice"
+	KindReminder   = "reminder"
+	KindEscalation = "escalation"
+)
+
+// TemplateData holds the values available to notice templates.
+type TemplateData struct {
+	Matter         string
+	Application    string
+	Custodian      string
+	Email          string
+	AcknowledgeURL string
+	SentAt         time.Time
+}
+
+// Recipient is a custodian a notice is sent to.
+type Recipient struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+// HoldStatus summarizes the acknowledgements of an application.
+type HoldStatus struct {
+	Application  string   `json:"application"`
+	Total        int      `json:"total"`
+	Acknowledged int      `json:"acknowledged"`
+	Pending      []Notice `json:"pending"`
+}
+
+const escalationSubject = "Legal hold not acknowledged: {{.Custodian}} ({{.Matter}})"
+
+const escalationBody = `{{.Custodian}} <{{.Email}}> has not acknowledged the legal hold notice for matter {{.Matter}} sent on {{.SentAt.Format "2006-01-02 15:04 MST"}}.
+`
+
+type Manager struct {
+	store  *store
+	sender Sender
+
+	baseURL    string
+	key        []byte
+	escalateTo string
+
+	checkInterval time.Duration
+	reminderAfter time.Duration
+	escalateAfter time.Duration
+	linkValidity  time.Duration
+}
+
+// NewManager opens the notice store and sets up the SMTP sender from the
+// legalHold section of the config.
+//
+// Without a signing key a random one is generated, which invalidates all
+// acknowledgement links sent before the next restart.
+func NewManager(cfg config.Config) (*Manager, error) {
+	lh := cfg.LegalHold
+
+	path := lh.Store
+	if path == "" {
+		path = "data/legalhold.json"
+	}
+
+	s, err := openStore(path)
+	if err != nil {
+		return nil, err
+	}
+
+	key := []byte(lh.SigningKey)
+	if len(key) == 0 {
+		log.Warn().Msg("legalHold.signingKey is not set, acknowledgement links will not survive a restart")
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+	}
+
+	baseURL := lh.BaseURL
+	if baseURL == "" {
+		baseURL = "http://" + cfg.EchoAddress()
+	}
+
+	m := &Manager{
+		store: s,
+		sender: SMTPSender{
+			Host:     lh.SMTP.Host,
+			Port:     lh.SMTP.Port,
+			User:     lh.SMTP.User,
+			Password: lh.SMTP.Password,
+			From:     lh.SMTP.From,
+		},
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		key:        key,
+		escalateTo: lh.EscalateTo,
+	}
+
+	if m.checkInterval, err = parseDuration(lh.CheckInterval, time.Hour); err != nil {
+		return nil, fmt.Errorf("invalid legalHold.checkInterval: %v", err)
+	}
+	if m.reminderAfter, err = parseDuration(lh.ReminderAfter, 72*time.Hour); err != nil {
+		return nil, fmt.Errorf("invalid legalHold.reminderAfter: %v", err)
+	}
+	if m.escalateAfter, err = parseDuration(lh.EscalateAfter, 7*24*time.Hour); err != nil {
+		return nil, fmt.Errorf("invalid legalHold.escalateAfter: %v", err)
+	}
+	if m.linkValidity, err = parseDuration(lh.LinkValidity, 30*24*time.Hour); err != nil {
+		return nil, fmt.Errorf("invalid legalHold.linkValidity: %v", err)
+	}
+
+	return m, nil
+}
+
+func parseDuration(s string, def time.Duration) (time.Duration, error) {
+	if s == "" {
+		return def, nil
+	}
+	return time.ParseDuration(s)
+}
+
+// Templates returns all notice templates.
+func (m *Manager) Templates() []Template {
+	return m.store.templates()
+}
+
+// PutTemplate creates or replaces a notice template after checking that its
+// subject and body parse.
+func (m *Manager) PutTemplate(t Template) error {
+	if t.ID == "" {
+		return ErrTemplateIDRequired
+	}
+	if _, err := template.New("subject").Parse(t.Subject); err != nil {
+		return fmt.Errorf("invalid subject template: %v", err)
+	}
+	if _, err := template.New("body").Parse(t.Body); err != nil {
+		return fmt.Errorf("invalid body template: %v", err)
+	}
+	return m.store.putTemplate(t)
+}
+
+// SendNotices sends the notice rendered from the template to every recipient
+// and records the delivery. Sending again to a custodian who already has a
+// notice in the application resends it without resetting an acknowledgement.
+//
+// A failed delivery is recorded on the notice and does not stop the others.
+func (m *Manager) SendNotices(application string, matter string, templateID string, recipients []Recipient) ([]Notice, error) {
+	if application == "" {
+		return nil, ErrApplicationRequired
+	}
+	if len(recipients) == 0 {
+		return nil, ErrRecipientRequired
+	}
+
+	t, ok := m.store.template(templateID)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrTemplateNotFound, templateID)
+	}
+
+	for _, r := range recipients {
+		if strings.TrimSpace(r.Name) == "" {
+			return nil, fmt.Errorf("custodian name is required")
+		}
+		if _, err := mail.ParseAddress(r.Email); err != nil {
+			return nil, fmt.Errorf("invalid email %q for custodian %s", r.Email, r.Name)
+		}
+	}
+
+	if matter == "" {
+		matter = application
+	}
+
+	notices := make([]Notice, 0, len(recipients))
+	for _, r := range recipients {
+		id := noticeID(application, r.Email)
+		now := time.Now()
+
+		n, err := m.store.updateNotice(id, func(n *Notice) {
+			n.ID = id
+			n.Application = application
+			n.Matter = matter
+			n.Custodian = r.Name
+			n.Email = r.Email
+			n.TemplateID = templateID
+			n.SentAt = now
+			n.Escalated = false
+		})
+		if err != nil {
+			return notices, err
+		}
+
+		n, err = m.deliver(n, t, KindNotice, n.Email)
+		if err != nil {
+			return notices, err
+		}
+		notices = append(notices, n)
+	}
+
+	return notices, nil
+}
+
+// deliver renders the template for the notice, sends it and records the
+// outcome. Only a failure to record the delivery is returned as error.
+func (m *Manager) deliver(n Notice, t Template, kind string, to string) (Notice, error) {
+	data := TemplateData{
+		Matter:         n.Matter,
+		Application:    n.Application,
+		Custodian:      n.Custodian,
+		Email:          n.Email,
+		AcknowledgeURL: m.AcknowledgeURL(n.ID),
+		SentAt:         n.SentAt,
+	}
+
+	subject, body, err := render(t, data)
+	if err == nil {
+		if kind == KindReminder {
+			subject = "Reminder: " + subject
+		}
+		err = m.sender.Send(to, subject, body)
+	}
+
+	delivery := Delivery{Kind: kind, To: to, At: time.Now()}
+	if err != nil {
+		log.Error().Err(err).Msgf("failed to send legal hold %s for %s to %s", kind, n.ID, to)
+		delivery.Error = err.Error()
+	} else {
+		log.Info().Msgf("sent legal hold %s for %s to %s", kind, n.ID, to)
+	}
+
+	return m.store.updateNotice(n.ID, func(n *Notice) {
+		n.Deliveries = append(n.Deliveries, delivery)
+		if kind == KindEscalation && delivery.Error == "" {
+			n.Escalated = true
+		}
+	})
+}
+
+func render(t Template, data TemplateData) (string, string, error) {
+	var subject, body bytes.Buffer
+
+	st, err := template.New("subject").Parse(t.Subject)
+	if err != nil {
+		return "", "", err
+	}
+	if err := st.Execute(&subject, data); err != nil {
+		return "", "", err
+	}
+
+	bt, err := template.New("body").Parse(t.Body)
+	if err != nil {
+		return "", "", err
+	}
+	if err := bt.Execute(&body, data); err != nil {
+		return "", "", err
+	}
+
+	return subject.String(), body.String(), nil
+}
+
+// noticeID identifies the notice of a custodian in an application.
+func noticeID(application string, email string) string {
+	sum := sha256.Sum256([]byte(application + "\x00" + strings.ToLower(strings.TrimSpace(email))))
+	return hex.EncodeToString(sum[:12])
+}
+
+// sign returns the signature of the link to the notice that expires at the
+// Unix time expires.
+func (m *Manager) sign(id string, expires int64) string {
+	mac := hmac.New(sha256.New, m.key)
+	mac.Write([]byte(id + "\x00" + strconv.FormatInt(expires, 10)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// AcknowledgeURL returns the signed link a custodian follows to acknowledge a
+// notice. It expires after legalHold.linkValidity; every reminder carries a
+// new one.
+func (m *Manager) AcknowledgeURL(id string) string {
+	expires := time.Now().Add(m.linkValidity).Unix()
+	return fmt.Sprintf("%s/holdNotices/%s/acknowledge?exp=%d&sig=%s", m.baseURL, url.PathEscape(id), expires, m.sign(id, expires))
+}
+
+// Verify checks the expiry and signature of an acknowledgement link and
+// returns its notice.
+func (m *Manager) Verify(id string, exp string, sig string) (Notice, error) {
+	expires, err := strconv.ParseInt(exp, 10, 64)
+	if err != nil || !hmac.Equal([]byte(sig), []byte(m.sign(id, expires))) {
+		return Notice{}, ErrInvalidSignature
+	}
+	if time.Now().Unix() > expires {
+		return Notice{}, ErrLinkExpired
+	}
+
+	n, ok := m.store.notice(id)
+	if !ok {
+		return Notice{}, ErrNoticeNotFound
+	}
+	return n, nil
+}
+
+// Acknowledge records the acknowledgement of a notice after checking the
+// link like Verify. Acknowledging twice keeps the first time.
+func (m *Manager) Acknowledge(id string, exp string, sig string) (Notice, error) {
+	if _, err := m.Verify(id, exp, sig); err != nil {
+		return Notice{}, err
+	}
+
+	return m.store.updateNotice(id, func(n *Notice) {
+		if n.AcknowledgedAt == nil {
+			now := time.Now()
+			n.AcknowledgedAt = &now
+		}
+	})
+}
+
+// Status returns the acknowledgement status of the notices of an application.
+func (m *Manager) Status(application string) HoldStatus {
+	status := HoldStatus{
+		Application: application,
+		Pending:     []Notice{},
+	}
+
+	for _, n := range m.store.notices(application) {
+		status.Total++
+		if n.AcknowledgedAt != nil {
+			status.Acknowledged++
+		} else {
+			status.Pending = append(status.Pending, n)
+		}
+	}
+
+	return status
+}
+
+// Run sends reminders and escalations for unacknowledged notices every check
+// interval until the context is done.
+func (m *Manager) Run(ctx context.Context) {
+	ticker := time.NewTicker(m.checkInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			m.checkOverdue(now)
+		}
+	}
+}
+
+// checkOverdue escalates notices that stayed unacknowledged for longer than
+// escalateAfter and reminds custodians who have not heard from us for longer
+// than reminderAfter. An escalated notice is in the hands of escalateTo and
+// gets no more reminders, until it is sent again.
+func (m *Manager) checkOverdue(now time.Time) {
+	for _, n := range m.store.notices("") {
+		if n.AcknowledgedAt != nil {
+			continue
+		}
+
+		t, ok := m.store.template(n.TemplateID)
+		if !ok {
+			log.Warn().Msgf("legal hold notice %s uses unknown template %s", n.ID, n.TemplateID)
+			continue
+		}
+
+		if !n.Escalated && m.escalateTo != "" && m.escalateAfter > 0 && now.Sub(n.SentAt) >= m.escalateAfter {
+			escalation := Template{ID: KindEscalation, Subject: escalationSubject, Body: escalationBody}
+			if _, err := m.deliver(n, escalation, KindEscalation, m.escalateTo); err != nil {
+				log.Error().Err(err).Msgf("failed to record legal hold escalation for %s", n.ID)
+			}
+			continue
+		}
+
+		if n.Escalated {
+			continue
+		}
+
+		last := n.lastDelivery()
+		if last.IsZero() {
+			last = n.SentAt
+		}
+
+		if m.reminderAfter > 0 && now.Sub(last) >= m.reminderAfter {
+			if _, err := m.deliver(n, t, KindReminder, n.Email); err != nil {
+				log.Error().Err(err).Msgf("failed to record legal hold reminder for %s", n.ID)
+			}
+		}
+	}
+}
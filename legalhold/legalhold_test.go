@@ -0,0 +1,208 @@
+package legalhold
+
+import (
+	"errors"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+type sentMail struct {
+	to      string
+	subject string
+}
+
+type fakeSender struct {
+	sent []sentMail
+}
+
+func (f *fakeSender) Send(to string, subject string, body string) error {
+	f.sent = append(f.sent, sentMail{to: to, subject: subject})
+	return nil
+}
+
+func newTestManager(t *testing.T) (*Manager, *fakeSender) {
+	t.Helper()
+
+	s, err := openStore(filepath.Join(t.TempDir(), "legalhold.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sender := &fakeSender{}
+	m := &Manager{
+		store:         s,
+		sender:        sender,
+		baseURL:       "http://localhost:8080",
+		key:           []byte("test-key"),
+		escalateTo:    "legal-ops@example.com",
+		reminderAfter: 72 * time.Hour,
+		escalateAfter: 7 * 24 * time.Hour,
+		linkValidity:  time.Hour,
+	}
+
+	if err := m.PutTemplate(Template{ID: "standard", Subject: "Legal hold: {{.Matter}}", Body: "{{.AcknowledgeURL}}"}); err != nil {
+		t.Fatal(err)
+	}
+	return m, sender
+}
+
+func linkParams(t *testing.T, link string) (string, string) {
+	t.Helper()
+
+	u, err := url.Parse(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u.Query().Get("exp"), u.Query().Get("sig")
+}
+
+func TestVerify(t *testing.T) {
+	m, _ := newTestManager(t)
+
+	notices, err := m.SendNotices("documentHold.demo", "Demo", "standard", []Recipient{{Name: "Jane", Email: "jane@example.com"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := notices[0].ID
+	exp, sig := linkParams(t, m.AcknowledgeURL(id))
+
+	expired := time.Now().Add(-time.Minute).Unix()
+
+	tests := []struct {
+		name string
+		id   string
+		exp  string
+		sig  string
+		want error
+	}{
+		{"valid", id, exp, sig, nil},
+		{"tampered signature", id, exp, strings.Repeat("0", len(sig)), ErrInvalidSignature},
+		{"extended expiry", id, strconv.FormatInt(time.Now().Add(48*time.Hour).Unix(), 10), sig, ErrInvalidSignature},
+		{"missing expiry", id, "", sig, ErrInvalidSignature},
+		{"expired", id, strconv.FormatInt(expired, 10), m.sign(id, expired), ErrLinkExpired},
+		{"other notice", "unknown", exp, m.sign("unknown", mustParse(t, exp)), ErrNoticeNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := m.Verify(tt.id, tt.exp, tt.sig)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("Verify() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func mustParse(t *testing.T, s string) int64 {
+	t.Helper()
+
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestVerifyDoesNotAcknowledge(t *testing.T) {
+	m, _ := newTestManager(t)
+
+	notices, err := m.SendNotices("documentHold.demo", "Demo", "standard", []Recipient{{Name: "Jane", Email: "jane@example.com"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := notices[0].ID
+	exp, sig := linkParams(t, m.AcknowledgeURL(id))
+
+	if _, err := m.Verify(id, exp, sig); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := m.store.notice(id); n.AcknowledgedAt != nil {
+		t.Fatal("Verify acknowledged the notice")
+	}
+
+	n, err := m.Acknowledge(id, exp, sig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n.AcknowledgedAt == nil {
+		t.Fatal("Acknowledge did not record the acknowledgement")
+	}
+}
+
+func TestCheckOverdue(t *testing.T) {
+	tests := []struct {
+		name      string
+		age       time.Duration
+		escalated bool
+		want      []string
+	}{
+		{"recent", time.Hour, false, nil},
+		{"reminder due", 80 * time.Hour, false, []string{KindReminder}},
+		{"escalation due", 8 * 24 * time.Hour, false, []string{KindEscalation}},
+		{"escalated", 9 * 24 * time.Hour, true, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, sender := newTestManager(t)
+
+			sentAt := time.Now().Add(-tt.age)
+			if _, err := m.store.updateNotice("n1", func(n *Notice) {
+				n.ID = "n1"
+				n.Application = "documentHold.demo"
+				n.Matter = "Demo"
+				n.Custodian = "Jane"
+				n.Email = "jane@example.com"
+				n.TemplateID = "standard"
+				n.SentAt = sentAt
+				n.Deliveries = []Delivery{{Kind: KindNotice, To: "jane@example.com", At: sentAt}}
+				n.Escalated = tt.escalated
+			}); err != nil {
+				t.Fatal(err)
+			}
+
+			m.checkOverdue(time.Now())
+
+			n, _ := m.store.notice("n1")
+			var kinds []string
+			for _, d := range n.Deliveries[1:] {
+				kinds = append(kinds, d.Kind)
+			}
+			if strings.Join(kinds, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("deliveries = %v, want %v", kinds, tt.want)
+			}
+			if len(sender.sent) != len(tt.want) {
+				t.Errorf("sent %d mails, want %d", len(sender.sent), len(tt.want))
+			}
+		})
+	}
+}
+
+func TestSMTPSenderRejectsHeaderInjection(t *testing.T) {
+	s := SMTPSender{Host: "localhost", Port: 25, From: "legal-hold@example.com"}
+
+	tests := []struct {
+		name    string
+		to      string
+		subject string
+		want    error
+	}{
+		{"recipient with header", "jane@example.com\r\nBcc: eve@example.com", "Legal hold", ErrInvalidAddress},
+		{"recipient list", "jane@example.com, eve@example.com", "Legal hold", ErrInvalidAddress},
+		{"not an address", "jane", "Legal hold", ErrInvalidAddress},
+		{"subject with header", "jane@example.com", "Legal hold\r\nBcc: eve@example.com", ErrInvalidHeader},
+		{"subject with newline", "jane@example.com", "Legal hold\nDemo", ErrInvalidHeader},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := s.Send(tt.to, tt.subject, "body"); !errors.Is(err, tt.want) {
+				t.Errorf("Send() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
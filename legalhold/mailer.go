@@ -0,0 +1,65 @@
+package legalhold
+
+import (
+	"fmt"
+	"mime"
+	"net/mail"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// Sender delivers a single plain text mail.
+type Sender interface {
+	Send(to string, subject string, body string) error
+}
+
+// SMTPSender sends mails through an SMTP relay. Authentication is only used
+// when a user is configured, so a local SMTP stand-in works without one.
+type SMTPSender struct {
+	Host     string
+	Port     int
+	User     string
+	Password string
+	From     string
+}
+
+// Send rejects addresses that do not parse and a subject with a line break,
+// so no value can add headers or recipients to the mail.
+func (s SMTPSender) Send(to string, subject string, body string) error {
+	if s.Host == "" {
+		return ErrSMTPNotConfigured
+	}
+
+	rcpt, err := mail.ParseAddress(to)
+	if err != nil {
+		return fmt.Errorf("%w: recipient %q", ErrInvalidAddress, to)
+	}
+	from, err := mail.ParseAddress(s.From)
+	if err != nil {
+		return fmt.Errorf("%w: sender %q", ErrInvalidAddress, s.From)
+	}
+
+	// header values must not break out of their line
+	if strings.ContainsAny(subject, "\r\n") {
+		return fmt.Errorf("%w: subject %q", ErrInvalidHeader, subject)
+	}
+
+	var auth smtp.Auth
+	if s.User != "" {
+		auth = smtp.PlainAuth("", s.User, s.Password, s.Host)
+	}
+
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "From: %s\r\n", from.String())
+	fmt.Fprintf(&msg, "To: %s\r\n", rcpt.String())
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("UTF-8", subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	msg.WriteString("\r\n")
+	msg.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+
+	addr := fmt.Sprintf("%s:%d", s.Host, s.Port)
+	return smtp.SendMail(addr, auth, from.Address, []string{rcpt.Address}, []byte(msg.String()))
+}
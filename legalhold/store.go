@@ -0,0 +1,175 @@
+package legalhold
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Template is a hold notice template. Subject and Body are Go text templates
+// that can use the fields of TemplateData, e.g. {{.Matter}} or {{.Custodian}}.
+type Template struct {
+	ID      string `json:"id"`
+	Subject string `json:"subject"`
+	Body    string `json:"body"`
+}
+
+// Delivery records one attempt to send a notice, reminder or escalation.
+type Delivery struct {
+	Kind  string    `json:"kind"`
+	To    string    `json:"to"`
+	At    time.Time `json:"at"`
+	Error string    `json:"error,omitempty"`
+}
+
+// Notice is the hold notice of one custodian in one application.
+type Notice struct {
+	ID             string     `json:"id"`
+	Application    string     `json:"application"`
+	Matter         string     `json:"matter"`
+	Custodian      string     `json:"custodian"`
+	Email          string     `json:"email"`
+	TemplateID     string     `json:"templateID"`
+	SentAt         time.Time  `json:"sentAt"`
+	Deliveries     []Delivery `json:"deliveries"`
+	AcknowledgedAt *time.Time `json:"acknowledgedAt,omitempty"`
+	Escalated      bool       `json:"escalated"`
+}
+
+// lastDelivery returns the time of the last successful delivery.
+func (n Notice) lastDelivery() time.Time {
+	var last time.Time
+	for _, d := range n.Deliveries {
+		if d.Error == "" && d.At.After(last) {
+			last = d.At
+		}
+	}
+	return last
+}
+
+type storeData struct {
+	Templates map[string]Template `json:"templates"`
+	Notices   map[string]Notice   `json:"notices"`
+}
+
+// store keeps templates and notices in a JSON file. Every change is written
+// through to the file, which is small enough to rewrite as a whole.
+type store struct {
+	mu   sync.RWMutex
+	path string
+	data storeData
+}
+
+func openStore(path string) (*store, error) {
+	s := &store{
+		path: path,
+		data: storeData{
+			Templates: make(map[string]Template),
+			Notices:   make(map[string]Notice),
+		},
+	}
+
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read legal hold store: %v", err)
+	}
+
+	if err := json.Unmarshal(b, &s.data); err != nil {
+		return nil, fmt.Errorf("failed to parse legal hold store: %v", err)
+	}
+	if s.data.Templates == nil {
+		s.data.Templates = make(map[string]Template)
+	}
+	if s.data.Notices == nil {
+		s.data.Notices = make(map[string]Notice)
+	}
+
+	return s, nil
+}
+
+// save writes the store to a temporary file and renames it over the old one,
+// so a crash never leaves a half written store behind. Callers hold s.mu.
+func (s *store) save() error {
+	if err := os.MkdirAll(filepath.Dir(s.path), os.ModePerm); err != nil {
+		return fmt.Errorf("failed to create legal hold store directory: %v", err)
+	}
+
+	b, err := json.MarshalIndent(s.data, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0664); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+func (s *store) templates() []Template {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	res := make([]Template, 0, len(s.data.Templates))
+	for _, t := range s.data.Templates {
+		res = append(res, t)
+	}
+	return res
+}
+
+func (s *store) template(id string) (Template, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	t, ok := s.data.Templates[id]
+	return t, ok
+}
+
+func (s *store) putTemplate(t Template) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.data.Templates[t.ID] = t
+	return s.save()
+}
+
+func (s *store) notices(application string) []Notice {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var res []Notice
+	for _, n := range s.data.Notices {
+		if application == "" || n.Application == application {
+			res = append(res, n)
+		}
+	}
+	return res
+}
+
+func (s *store) notice(id string) (Notice, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	n, ok := s.data.Notices[id]
+	return n, ok
+}
+
+// updateNotice applies fn to the stored notice with the given ID, or to a new
+// one when it does not exist, and saves the store.
+func (s *store) updateNotice(id string, fn func(*Notice)) (Notice, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := s.data.Notices[id]
+	fn(&n)
+	s.data.Notices[id] = n
+
+	return n, s.save()
+}
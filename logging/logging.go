@@ -0,0 +1,122 @@
+// Package logging gives every request an X-Request-ID and a zerolog logger
+// carrying it, and writes the access log.
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// maxRequestIDLength bounds the request IDs accepted from clients
+const maxRequestIDLength = 128
+
+// Middleware takes the X-Request-ID of the request, or generates one, returns
+// it in the response and puts a logger with the request ID in the request
+// context for From and Ctx. When the request is done, it writes the access
+// log line, so it is registered before the authentication middlewares to log
+// the requests they reject too.
+func Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			res := c.Response()
+
+			id := req.Header.Get(echo.HeaderXRequestID)
+			if !validRequestID(id) {
+				id = newRequestID()
+			}
+			req.Header.Set(echo.HeaderXRequestID, id)
+			res.Header().Set(echo.HeaderXRequestID, id)
+
+			logger := log.Logger.With().Ctx(req.Context()).Str("request_id", id).Logger()
+			c.SetRequest(req.WithContext(logger.WithContext(req.Context())))
+
+			start := time.Now()
+			err := next(c)
+			if err != nil {
+				// write the error response now, so its status and size are logged
+				c.Error(err)
+			}
+
+			event := logger.Info()
+			if res.Status >= http.StatusInternalServerError {
+				event = logger.Error().Err(err)
+			}
+
+			event.
+				Str("method", req.Method).
+				Str("uri", req.RequestURI).
+				Str("route", c.Path()).
+				Int("status", res.Status).
+				Dur("latency", time.Since(start)).
+				Int64("bytes_in", contentLength(req)).
+				Int64("bytes_out", res.Size).
+				Str("ip", c.RealIP()).
+				Str("user", stringOf(c.Get("user"))).
+				Str("adp_user", stringOf(c.Get("adp_user"))).
+				Str("adp_backend", stringOf(c.Get("adp_backend"))).
+				Msg("request")
+
+			return err
+		}
+	}
+}
+
+// From returns the logger of the request.
+func From(c echo.Context) *zerolog.Logger {
+	return Ctx(c.Request().Context())
+}
+
+// Ctx returns the logger of the request of ctx, or the global logger outside
+// of a request.
+func Ctx(ctx context.Context) *zerolog.Logger {
+	if logger := zerolog.Ctx(ctx); logger.GetLevel() != zerolog.Disabled {
+		return logger
+	}
+	return &log.Logger
+}
+
+// RequestID returns the X-Request-ID of the request.
+func RequestID(c echo.Context) string {
+	return c.Response().Header().Get(echo.HeaderXRequestID)
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, r := range id {
+		if r < 0x21 || r > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	return hex.EncodeToString(b)
+}
+
+func contentLength(req *http.Request) int64 {
+	if req.ContentLength < 0 {
+		return 0
+	}
+	return req.ContentLength
+}
+
+func stringOf(v interface{}) string {
+	s, _ := v.(string)
+	return s
+}
@@ -1,26 +1,105 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
+	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/labstack/echo/v4"
-	"github.com/labstack/echo/v4/middleware"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 
 	"github.com/xifanyan/ediscovery-data-service/auth"
 	"github.com/xifanyan/ediscovery-data-service/config"
 	"github.com/xifanyan/ediscovery-data-service/handler"
+	"github.com/xifanyan/ediscovery-data-service/legalhold"
+	"github.com/xifanyan/ediscovery-data-service/logging"
+	"github.com/xifanyan/ediscovery-data-service/metrics"
+	"github.com/xifanyan/ediscovery-data-service/provision"
+	"github.com/xifanyan/ediscovery-data-service/ratelimit"
 	"github.com/xifanyan/ediscovery-data-service/service"
+	"github.com/xifanyan/ediscovery-data-service/tlsconfig"
+	"github.com/xifanyan/ediscovery-data-service/tracing"
 )
 
 var (
-	configFile = flag.String("config", "config.json", "config file")
+	configFile  = flag.String("config", "config.json", "config file, JSON or YAML")
+	printConfig = flag.Bool("print-config", false, "print the effective config with secrets redacted and exit")
+	overrides   settingsFlag
+)
+
+func init() {
+	flag.Var(&overrides, "set", "override a config setting, e.g. -set adp.port=443 (repeatable)")
+
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage of %s:\n", os.Args[0])
+		flag.PrintDefaults()
+		fmt.Fprintf(flag.CommandLine.Output(), "\nSettings are read from the config file, then from these environment variables,\n"+
+			"with a _FILE suffix to read the value from a file, then from -set:\n  %s\n",
+			strings.Join(config.EnvNames(), "\n  "))
+	}
+}
+
+// settingsFlag collects the path=value overrides of -set.
+type settingsFlag []string
+
+func (f *settingsFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *settingsFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+// loadConfig loads and validates the config, printing every problem and
+// exiting when it is not usable. With -print-config it prints the effective
+// config and exits.
+func loadConfig() config.Config {
+	cfg, err := config.LoadConfig(*configFile, overrides...)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to load config: %v\n", err)
+		os.Exit(1)
+	}
+
+	if *printConfig {
+		js, err := json.MarshalIndent(cfg.Redacted(), "", "  ")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to print config: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(string(js))
+	}
+
+	var invalid config.ValidationError
+	if err := cfg.Validate(); errors.As(err, &invalid) {
+		fmt.Fprintf(os.Stderr, "invalid config:\n")
+		for _, fe := range invalid {
+			fmt.Fprintf(os.Stderr, "  %s\n", fe)
+		}
+		os.Exit(1)
+	}
+
+	if *printConfig {
+		os.Exit(0)
+	}
+
+	return cfg
+}
+
+const (
+	defaultShutdownTimeout = 30 * time.Second
+	defaultStopTimeout     = 10 * time.Second
 )
 
 // setupLogWriter sets up the log writer with the provided configuration.
@@ -38,23 +117,24 @@ var (
 //
 // Returns:
 //   io.Writer - The writer to use for logging.
+//   *os.File - The log file, to flush and close on exit.
 //   error - An error if the log file cannot be opened.
 
-func setupLogWriter(cfg config.Config) (io.Writer, error) {
+func setupLogWriter(cfg config.Config) (io.Writer, *os.File, error) {
 
 	if err := os.MkdirAll(filepath.Dir(cfg.Log.Path), os.ModePerm); err != nil {
-		return nil, fmt.Errorf("failed to create logs directory: %v", err)
+		return nil, nil, fmt.Errorf("failed to create logs directory: %v", err)
 	}
 
 	logFile, err := os.OpenFile(cfg.Log.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0664)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	if cfg.Log.Console {
-		return io.MultiWriter(logFile, os.Stdout), nil
+		return io.MultiWriter(logFile, os.Stdout), logFile, nil
 	}
-	return logFile, nil
+	return logFile, logFile, nil
 }
 
 // setupGlobalLogger sets up the global logger with the provided configuration.
@@ -67,81 +147,201 @@ func setupLogWriter(cfg config.Config) (io.Writer, error) {
 //	cfg (config.Config) - The configuration containing log settings.
 //
 // Returns:
-func setupGlobalLogger(cfg config.Config) {
+//
+//	func() - Flushes and closes the log file.
+func setupGlobalLogger(cfg config.Config) func() {
 	zerolog.TimeFieldFormat = time.RFC3339
 
-	w, err := setupLogWriter(cfg)
+	w, logFile, err := setupLogWriter(cfg)
 	if err != nil {
 		log.Logger.Fatal().Err(err).Msg("failed to setup log writer")
 	}
 
-	switch cfg.Log.Level {
+	zerolog.SetGlobalLevel(logLevel(cfg.Log.Level))
+
+	// log lines of traced requests carry the trace and span IDs
+	log.Logger = zerolog.New(w).With().Timestamp().Logger().Hook(tracing.LogHook{})
+
+	return func() {
+		logFile.Sync()
+		logFile.Close()
+	}
+}
+
+// logLevel maps log.level to the zerolog level, info when not set.
+func logLevel(level string) zerolog.Level {
+	switch level {
 	case "debug":
-		zerolog.SetGlobalLevel(zerolog.DebugLevel)
+		return zerolog.DebugLevel
 	case "trace":
-		zerolog.SetGlobalLevel(zerolog.TraceLevel)
+		return zerolog.TraceLevel
+	case "warn":
+		return zerolog.WarnLevel
+	case "error":
+		return zerolog.ErrorLevel
 	default:
-		zerolog.SetGlobalLevel(zerolog.InfoLevel)
+		return zerolog.InfoLevel
 	}
-
-	log.Logger = zerolog.New(w).With().Timestamp().Logger()
 }
 
 // setupMiddleware configures middleware for the Echo instance.
 //
-// This function adds middleware for user authentication and request logging.
-// The user authentication middleware ensures that requests are authenticated
-// based on the provided configuration. The request logging middleware logs
-// the URI and status of each request using the zerolog logger.
+// This function adds middleware for tracing, metrics, request IDs and access
+// logging, user authentication and the rate limits and caps of the users. The
+// access log is set up before the
+// authentication middlewares, so the requests they reject are logged too, and
+// records the method, URI, status, latency, sizes, client IP and the user and
+// ADP user of each request.
 //
 // Parameters:
 //   e (echo.Echo) - The Echo instance to configure middleware for.
-//   cfg (config.Config) - The configuration containing settings for authentication.
+//   live (config.Live) - The live configuration containing settings for authentication and limits.
+//   caps (ratelimit.Caps) - The caps of the concurrent requests.
+
+func setupMiddleware(e *echo.Echo, live *config.Live, caps *ratelimit.Caps) {
+	cfg := live.Config()
+
+	// trace, count and log every request, including the ones rejected by authentication
+	e.Use(tracing.Middleware())
+	e.Use(metrics.Middleware())
+	e.Use(logging.Middleware())
 
-func setupMiddleware(e *echo.Echo, cfg config.Config) {
-	e.Use(auth.UserAuthMiddleware(cfg))
+	e.Use(auth.UserAuthMiddleware(live))
 	e.Use(auth.ADPAuthMiddleware(cfg))
 
-	e.Use(middleware.RequestLoggerWithConfig(middleware.RequestLoggerConfig{
-		LogURI:    true,
-		LogStatus: true,
-		LogValuesFunc: func(c echo.Context, v middleware.RequestLoggerValues) error {
-			log.Logger.Info().
-				Str("URI", v.URI).
-				Int("status", v.Status).
-				Msg("request")
-
-			return nil
-		},
-	}))
+	// limit the authenticated users, so one client cannot overload ADP
+	e.Use(ratelimit.Middleware(live, caps))
+}
+
+// shutdown stops accepting requests and waits for the requests in flight
+// until shutdown.timeout. Multi-step operations still running then are stopped
+// before their next step, with their finished steps checkpointed so they can
+// be resumed, waiting for them until shutdown.stopTimeout.
+func shutdown(e *echo.Echo, svc *service.Service, cfg config.Config) {
+	timeout := durationOr(cfg.Shutdown.Timeout, defaultShutdownTimeout)
+	log.Logger.Info().Msgf("shutting down, draining requests for up to %s", timeout)
+
+	// report not ready, so load balancers stop sending requests
+	svc.Drain()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := e.Shutdown(ctx); err != nil {
+		log.Logger.Warn().Err(err).Msg("requests still in flight at the shutdown deadline, stopping their operations")
+	}
+
+	stopCtx, stopCancel := context.WithTimeout(context.Background(), durationOr(cfg.Shutdown.StopTimeout, defaultStopTimeout))
+	defer stopCancel()
+
+	if err := svc.StopOperations(stopCtx); err != nil {
+		log.Logger.Error().Err(err).Msg("operations still running at exit, resume them from their checkpoints")
+		return
+	}
+
+	log.Logger.Info().Msg("shutdown complete")
+}
+
+func durationOr(s string, def time.Duration) time.Duration {
+	if d, err := time.ParseDuration(s); err == nil && d > 0 {
+		return d
+	}
+	return def
 }
 
 func main() {
-	// Load the configuration from the specified file
-	var cfg config.Config
-	var err error
-	if cfg, err = config.LoadConfig(*configFile); err != nil {
-		// If the configuration file can't be loaded, panic
-		panic("failed to load config file")
+	flag.Parse()
+
+	// Load the configuration from the config file, the environment and the
+	// command line
+	cfg := loadConfig()
+
+	closeLog := setupGlobalLogger(cfg)
+
+	// Set up tracing and flush the pending spans on exit
+	shutdownTracing, err := tracing.Setup(cfg)
+	if err != nil {
+		log.Logger.Fatal().Err(err).Msg("failed to setup tracing")
 	}
 
-	setupGlobalLogger(cfg)
+	// Stop the background jobs and the server on SIGINT and SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
 	// Create the service object, passing the loaded configuration
 	svc := service.NewService(cfg)
 
+	// Check the configured applications for drift from their baselines
+	go svc.RunDriftChecks(ctx)
+	go svc.RunIdempotencyPurge(ctx)
+
+	// Set up legal hold notices and start sending reminders and escalations
+	legalHold, err := legalhold.NewManager(cfg)
+	if err != nil {
+		log.Logger.Fatal().Err(err).Msg("failed to setup legal hold notices")
+	}
+	go legalHold.Run(ctx)
+
+	// Apply the roles, log level and cache TTLs of a reloaded config file,
+	// watching the file for changes when reload.watch is set
+	live := config.NewLive(*configFile, overrides, cfg)
+	live.OnReload(func(cfg config.Config) {
+		zerolog.SetGlobalLevel(logLevel(cfg.Log.Level))
+		svc.SetCacheTTLs(cfg.Cache.TTL)
+		svc.Caps().Configure(cfg)
+	})
+	if cfg.Reload.Watch {
+		go live.Watch(ctx, durationOr(cfg.Reload.Interval, 0))
+	}
+
 	// Create the handler object, passing the created service object
-	h := handler.NewHandler(svc)
+	h := handler.NewHandler(svc, legalHold, provision.New(svc, cfg.Provisioning.Runs), live)
 
 	// Create a new Echo instance
 	e := echo.New()
 
-	setupMiddleware(e, cfg)
+	setupMiddleware(e, live, svc.Caps())
 
 	// Set up the routes for the Echo instance using the handler object
 	h.SetupRouter(e)
 
-	// Start the Echo server, using the address specified in the configuration
-	// Any errors will be logged
-	e.Logger.Fatal(e.Start(cfg.EchoAddress()))
+	// Start the Echo server, using the address specified in the configuration,
+	// over HTTPS when echo.tls is set
+	serverErr := make(chan error, 1)
+	if cfg.Echo.TLS.Enabled() {
+		tlsConfig, reloader, err := tlsconfig.New(cfg.Echo.TLS)
+		if err != nil {
+			log.Logger.Fatal().Err(err).Msg("failed to setup TLS")
+		}
+		go reloader.Run(ctx)
+
+		e.TLSServer.Addr = cfg.EchoAddress()
+		e.TLSServer.TLSConfig = tlsConfig
+		go func() {
+			serverErr <- e.StartServer(e.TLSServer)
+		}()
+	} else {
+		go func() {
+			serverErr <- e.Start(cfg.EchoAddress())
+		}()
+	}
+
+	exitCode := 0
+	select {
+	case err := <-serverErr:
+		if !errors.Is(err, http.ErrServerClosed) {
+			log.Logger.Error().Err(err).Msg("server failed")
+			exitCode = 1
+		}
+	case <-ctx.Done():
+		stop()
+		shutdown(e, svc, cfg)
+	}
+
+	if err := shutdownTracing(context.Background()); err != nil {
+		log.Logger.Error().Err(err).Msg("failed to flush traces")
+	}
+	closeLog()
+
+	os.Exit(exitCode)
 }
@@ -0,0 +1,192 @@
+// Package metrics exposes the Prometheus metrics of the service: HTTP
+// requests, ADP calls, imports, ingestion jobs, the ADP read cache and the
+// requests rejected by the limits.
+package metrics
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "eds"
+
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by method, route and status.",
+	}, []string{"method", "route", "status"})
+
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by method, route and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	httpInFlight = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "http_requests_in_flight",
+		Help:      "HTTP requests being served.",
+	})
+
+	adpCalls = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "adp_calls_total",
+		Help:      "ADP calls by operation and outcome.",
+	}, []string{"operation", "outcome"})
+
+	adpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "adp_call_duration_seconds",
+		Help:      "ADP call latency by operation.",
+		Buckets:   []float64{.05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60, 120},
+	}, []string{"operation"})
+
+	adpErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "adp_call_errors_total",
+		Help:      "Failed ADP calls by operation.",
+	}, []string{"operation"})
+
+	adpRetries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "adp_call_retries_total",
+		Help:      "Retries of ADP calls after transient failures by operation.",
+	}, []string{"operation"})
+
+	adpCircuitOpen = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "adp_circuit_open",
+		Help:      "1 while the circuit breaker of an ADP backend is open.",
+	}, []string{"backend"})
+
+	rejectedRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rejected_requests_total",
+		Help:      "Requests rejected by route and limit (user_rate, route_rate or concurrency).",
+	}, []string{"route", "limit"})
+
+	importRows = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "import_rows_total",
+		Help:      "Rows read from imported files by import and kind of row.",
+	}, []string{"import", "kind"})
+
+	ingestionJobs = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "ingestion_jobs_total",
+		Help:      "Data ingestion submissions by outcome.",
+	}, []string{"outcome"})
+
+	cacheRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cache_requests_total",
+		Help:      "ADP read cache lookups by resource and result (hit, miss or bypass).",
+	}, []string{"resource", "result"})
+)
+
+// Handler serves the metrics in the Prometheus text format.
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// Middleware records the count, latency and status of the requests, labeled
+// with the route path rather than the URL so IDs do not create new series.
+func Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			httpInFlight.Inc()
+			defer httpInFlight.Dec()
+
+			start := time.Now()
+			err := next(c)
+
+			status := c.Response().Status
+			if err != nil {
+				// the error handler writes the response after the middlewares return
+				var he *echo.HTTPError
+				if errors.As(err, &he) {
+					status = he.Code
+				} else {
+					status = http.StatusInternalServerError
+				}
+			}
+
+			route := c.Path()
+			if route == "" {
+				route = "unmatched"
+			}
+
+			labels := prometheus.Labels{
+				"method": c.Request().Method,
+				"route":  route,
+				"status": strconv.Itoa(status),
+			}
+			httpRequests.With(labels).Inc()
+			httpDuration.With(labels).Observe(time.Since(start).Seconds())
+
+			return err
+		}
+	}
+}
+
+// ObserveADPCall records one ADP call.
+func ObserveADPCall(operation string, duration time.Duration, err error) {
+	outcome := "success"
+	if err != nil {
+		outcome = "error"
+		adpErrors.WithLabelValues(operation).Inc()
+	}
+	adpCalls.WithLabelValues(operation, outcome).Inc()
+	adpDuration.WithLabelValues(operation).Observe(duration.Seconds())
+}
+
+// ObserveADPRejected records an ADP call failed fast by an open circuit
+// breaker.
+func ObserveADPRejected(operation string) {
+	adpCalls.WithLabelValues(operation, "rejected").Inc()
+}
+
+// ObserveADPRetry records the retry of an ADP call.
+func ObserveADPRetry(operation string) {
+	adpRetries.WithLabelValues(operation).Inc()
+}
+
+// SetADPCircuitOpen records whether the circuit breaker of an ADP backend is
+// open.
+func SetADPCircuitOpen(backend string, open bool) {
+	v := 0.0
+	if open {
+		v = 1
+	}
+	adpCircuitOpen.WithLabelValues(backend).Set(v)
+}
+
+// ObserveRejected records a request rejected by a rate limit or a cap.
+func ObserveRejected(route string, limit string) {
+	rejectedRequests.WithLabelValues(route, limit).Inc()
+}
+
+// ObserveImportRows records n rows of the given kind read by an import.
+func ObserveImportRows(importName string, kind string, n int) {
+	importRows.WithLabelValues(importName, kind).Add(float64(n))
+}
+
+// ObserveIngestion records the outcome of a data ingestion submission:
+// submitted, exists or failed.
+func ObserveIngestion(outcome string) {
+	ingestionJobs.WithLabelValues(outcome).Inc()
+}
+
+// ObserveCache records a cache lookup: hit, miss or bypass.
+func ObserveCache(resource string, result string) {
+	cacheRequests.WithLabelValues(resource, result).Inc()
+}
@@ -0,0 +1,189 @@
+package provision
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/xifanyan/adp"
+	"gopkg.in/yaml.v3"
+
+	"github.com/xifanyan/ediscovery-data-service/service"
+)
+
+// Blueprint describes everything needed to set up a matter. Every section but
+// the application is optional.
+type Blueprint struct {
+	Application      ApplicationBlueprint         `json:"application"`
+	Groups           []GroupBlueprint             `json:"groups"`
+	Custodians       []string                     `json:"custodians"`
+	RedactionReasons []string                     `json:"redactionReasons"`
+	GlobalSearches   []adp.GlobalSearchDefinition `json:"globalSearches"`
+	Taggers          []adp.TaggerInfo             `json:"taggers"`
+	DataSources      []DataSourceBlueprint        `json:"dataSources"`
+}
+
+type ApplicationBlueprint struct {
+	Type         string `json:"type"`
+	Name         string `json:"name"`
+	Template     string `json:"template"`
+	Workspace    string `json:"workspace"`
+	Host         string `json:"host"`
+	DropTemplate bool   `json:"dropTemplate"`
+	Start        bool   `json:"start"`
+}
+
+// GroupBlueprint is a group to create when missing and, when Roles is set,
+// to assign to the application with these comma separated roles.
+type GroupBlueprint struct {
+	Name  string `json:"name"`
+	Roles string `json:"roles"`
+}
+
+type DataSourceBlueprint struct {
+	Name      string `json:"name"`
+	Template  string `json:"template"`
+	Engine    string `json:"engine"`
+	Path      string `json:"path"`
+	Custodian string `json:"custodian"`
+	Source    string `json:"source"`
+	Batch     string `json:"batch"`
+	// ClassifierRules map further fields of the application by path.
+	ClassifierRules []service.ClassifierRule `json:"classifierRules"`
+}
+
+var paramPattern = regexp.MustCompile(`\$\{([A-Za-z0-9_.-]+)\}`)
+
+// Substitute replaces ${name} placeholders in the scalar values of the
+// blueprint document with the given parameters. A placeholder without a
+// parameter is an error, so a blueprint is never applied half filled in.
+//
+// The document is parsed before the placeholders are replaced, so a value can
+// only ever fill in the scalar it stands in and never add keys or entries to
+// the blueprint. A value that is a single unquoted placeholder takes the type
+// of the parameter, e.g. "start: ${start}" becomes a boolean, all others stay
+// strings.
+func Substitute(doc []byte, params map[string]string) ([]byte, error) {
+	var root yaml.Node
+	if err := yaml.Unmarshal(doc, &root); err != nil {
+		return nil, fmt.Errorf("invalid blueprint: %v", err)
+	}
+	if root.Kind == 0 {
+		return doc, nil
+	}
+
+	missing := make(map[string]struct{})
+	substituteNode(&root, params, missing)
+
+	if len(missing) > 0 {
+		names := make([]string, 0, len(missing))
+		for name := range missing {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("missing blueprint parameters: %s", strings.Join(names, ", "))
+	}
+
+	return yaml.Marshal(&root)
+}
+
+// substituteNode replaces the placeholders in the scalar values below the
+// node. Mapping keys are left alone.
+func substituteNode(node *yaml.Node, params map[string]string, missing map[string]struct{}) {
+	switch node.Kind {
+	case yaml.DocumentNode, yaml.SequenceNode:
+		for _, child := range node.Content {
+			substituteNode(child, params, missing)
+		}
+	case yaml.MappingNode:
+		for i := 1; i < len(node.Content); i += 2 {
+			substituteNode(node.Content[i], params, missing)
+		}
+	case yaml.ScalarNode:
+		if !paramPattern.MatchString(node.Value) {
+			return
+		}
+
+		whole := node.Style == 0 && paramPattern.FindString(node.Value) == node.Value
+		node.Value = paramPattern.ReplaceAllStringFunc(node.Value, func(m string) string {
+			name := paramPattern.FindStringSubmatch(m)[1]
+			v, ok := params[name]
+			if !ok {
+				missing[name] = struct{}{}
+				return m
+			}
+			return v
+		})
+
+		if whole {
+			// resolved again from the value when the node is encoded
+			node.Tag = ""
+		} else {
+			node.Tag = "!!str"
+		}
+	}
+}
+
+// Parse reads a blueprint from a YAML or JSON document.
+//
+// The document is decoded as YAML, which JSON is a subset of, and then mapped
+// onto the blueprint through JSON so both formats share the same field names.
+func Parse(doc []byte) (Blueprint, error) {
+	var raw interface{}
+	if err := yaml.Unmarshal(doc, &raw); err != nil {
+		return Blueprint{}, fmt.Errorf("invalid blueprint: %v", err)
+	}
+
+	js, err := json.Marshal(raw)
+	if err != nil {
+		return Blueprint{}, fmt.Errorf("invalid blueprint: %v", err)
+	}
+
+	var bp Blueprint
+	dec := json.NewDecoder(bytes.NewReader(js))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&bp); err != nil {
+		return Blueprint{}, fmt.Errorf("invalid blueprint: %v", err)
+	}
+
+	return bp, bp.Validate()
+}
+
+// Validate checks the parts of the blueprint that can be checked before
+// anything is created.
+func (bp Blueprint) Validate() error {
+	app := bp.Application
+
+	if app.Type != "documentHold" && app.Type != "axcelerateStandalone" {
+		return fmt.Errorf("application.type %q is not supported", app.Type)
+	}
+	if app.Name == "" {
+		return fmt.Errorf("application.name is required")
+	}
+	if app.Template == "" {
+		return fmt.Errorf("application.template is required")
+	}
+
+	for i, g := range bp.Groups {
+		if g.Name == "" {
+			return fmt.Errorf("groups[%d].name is required", i)
+		}
+	}
+
+	for i, t := range bp.Taggers {
+		if t.ID == "" {
+			return fmt.Errorf("taggers[%d].id is required", i)
+		}
+	}
+
+	for i, ds := range bp.DataSources {
+		if ds.Name == "" || ds.Template == "" || ds.Path == "" {
+			return fmt.Errorf("dataSources[%d] requires name, template and path", i)
+		}
+	}
+
+	return nil
+}
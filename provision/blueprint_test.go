@@ -0,0 +1,130 @@
+package provision
+
+import (
+	"strings"
+	"testing"
+)
+
+const testBlueprint = `
+application:
+  type: documentHold
+  name: Matter_${matter}
+  template: documentHold._Demo_Template
+  start: ${start}
+groups:
+  - name: "${group}"
+dataSources:
+  - name: file_${matter}_01
+    template: _Demo_File_v1
+    path: E:\Datasource\${matter}
+    custodian: ${custodian}
+`
+
+func TestSubstitute(t *testing.T) {
+	tests := []struct {
+		name    string
+		params  map[string]string
+		wantErr string
+		check   func(t *testing.T, bp Blueprint)
+	}{
+		{
+			name:   "plain values",
+			params: map[string]string{"matter": "00042", "start": "true", "group": "reviewers", "custodian": "Jane Doe"},
+			check: func(t *testing.T, bp Blueprint) {
+				if bp.Application.Name != "Matter_00042" {
+					t.Errorf("application.name = %q", bp.Application.Name)
+				}
+				if !bp.Application.Start {
+					t.Error("application.start is not true")
+				}
+				if bp.DataSources[0].Path != `E:\Datasource\00042` {
+					t.Errorf("dataSources[0].path = %q", bp.DataSources[0].Path)
+				}
+			},
+		},
+		{
+			name:   "quoted placeholder stays a string",
+			params: map[string]string{"matter": "1", "start": "false", "group": "true", "custodian": "Jane"},
+			check: func(t *testing.T, bp Blueprint) {
+				if bp.Groups[0].Name != "true" {
+					t.Errorf("groups[0].name = %q", bp.Groups[0].Name)
+				}
+			},
+		},
+		{
+			name: "value cannot add keys",
+			params: map[string]string{
+				"matter":    "1",
+				"start":     "false",
+				"group":     "reviewers",
+				"custodian": "Jane\n  - name: injected\n    template: t\n    path: p",
+			},
+			check: func(t *testing.T, bp Blueprint) {
+				if len(bp.DataSources) != 1 {
+					t.Fatalf("got %d data sources, want 1", len(bp.DataSources))
+				}
+				if !strings.HasPrefix(bp.DataSources[0].Custodian, "Jane\n") {
+					t.Errorf("dataSources[0].custodian = %q", bp.DataSources[0].Custodian)
+				}
+			},
+		},
+		{
+			name:   "value cannot close a flow mapping",
+			params: map[string]string{"matter": "1}, groups: [{name: admins", "start": "false", "group": "reviewers", "custodian": "Jane"},
+			check: func(t *testing.T, bp Blueprint) {
+				if len(bp.Groups) != 1 || bp.Groups[0].Name != "reviewers" {
+					t.Errorf("groups = %+v", bp.Groups)
+				}
+				if bp.Application.Name != "Matter_1}, groups: [{name: admins" {
+					t.Errorf("application.name = %q", bp.Application.Name)
+				}
+			},
+		},
+		{
+			name:    "missing parameters",
+			params:  map[string]string{"matter": "1"},
+			wantErr: "missing blueprint parameters: custodian, group, start",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := Substitute([]byte(testBlueprint), tt.params)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("Substitute() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Substitute() error = %v", err)
+			}
+
+			bp, err := Parse(doc)
+			if err != nil {
+				t.Fatalf("Parse() error = %v\n%s", err, doc)
+			}
+			tt.check(t, bp)
+		})
+	}
+}
+
+func TestSubstituteJSON(t *testing.T) {
+	doc := `{"application": {"type": "documentHold", "name": "Matter_${matter}", "template": "t"}}`
+
+	res, err := Substitute([]byte(doc), map[string]string{"matter": `1", "start": true, "x": "`})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bp, err := Parse(res)
+	if err != nil {
+		t.Fatalf("Parse() error = %v\n%s", err, res)
+	}
+	if bp.Application.Start {
+		t.Error("the parameter set application.start")
+	}
+	if bp.Application.Name != `Matter_1", "start": true, "x": "` {
+		t.Errorf("application.name = %q", bp.Application.Name)
+	}
+}
@@ -0,0 +1,275 @@
+// Package provision applies matter blueprints as an ordered, resumable
+// sequence of steps.
+package provision
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/xifanyan/adp"
+
+	"github.com/xifanyan/ediscovery-data-service/logging"
+	"github.com/xifanyan/ediscovery-data-service/service"
+	"github.com/xifanyan/ediscovery-data-service/tracing"
+)
+
+const (
+	StatusPending   = "pending"
+	StatusRunning   = "running"
+	StatusDone      = "done"
+	StatusFailed    = "failed"
+	StatusSkipped   = "skipped"
+	StatusCompleted = "completed"
+
+	// StatusInterrupted is a run stopped between two steps by the shutdown
+	StatusInterrupted = "interrupted"
+)
+
+var (
+	ErrRunNotFound   = errors.New("provisioning run not found")
+	ErrRunInProgress = errors.New("provisioning run is in progress")
+	ErrRunCompleted  = errors.New("provisioning run is completed already")
+)
+
+// Step is the state of one step of a run.
+type Step struct {
+	Name       string      `json:"name"`
+	Status     string      `json:"status"`
+	StartedAt  *time.Time  `json:"startedAt,omitempty"`
+	FinishedAt *time.Time  `json:"finishedAt,omitempty"`
+	Error      string      `json:"error,omitempty"`
+	Output     interface{} `json:"output,omitempty"`
+}
+
+// Run is one application of a blueprint. It is saved after every step, so a
+// failed run can be resumed from the step that failed.
+type Run struct {
+	ID            string            `json:"id"`
+	Status        string            `json:"status"`
+	CreatedAt     time.Time         `json:"createdAt"`
+	CreatedBy     string            `json:"createdBy"`
+	UpdatedAt     time.Time         `json:"updatedAt"`
+	Params        map[string]string `json:"params"`
+	Blueprint     Blueprint         `json:"blueprint"`
+	ApplicationID string            `json:"applicationID"`
+	Steps         []Step            `json:"steps"`
+}
+
+type stepFunc func(ctx context.Context, p *Provisioner, adpService *adp.Service, run *Run) (interface{}, error)
+
+// steps are executed in this order; later steps need the application created
+// by the first one.
+var steps = []struct {
+	name    string
+	fn      stepFunc
+	enabled func(bp Blueprint) bool
+}{
+	{"createApplication", createApplication, func(bp Blueprint) bool { return true }},
+	{"groups", setupGroups, func(bp Blueprint) bool { return len(bp.Groups) > 0 }},
+	{"custodians", addCustodians, func(bp Blueprint) bool { return len(bp.Custodians) > 0 }},
+	{"redactionReasons", addRedactionReasons, func(bp Blueprint) bool { return len(bp.RedactionReasons) > 0 }},
+	{"globalSearches", createGlobalSearches, func(bp Blueprint) bool { return len(bp.GlobalSearches) > 0 }},
+	{"taggers", installTaggers, func(bp Blueprint) bool { return len(bp.Taggers) > 0 }},
+	{"dataSources", submitDataSources, func(bp Blueprint) bool { return len(bp.DataSources) > 0 }},
+}
+
+type Provisioner struct {
+	svc *service.Service
+	dir string
+
+	mu      sync.Mutex
+	running map[string]struct{}
+}
+
+// New returns a provisioner keeping its runs as JSON files in dir.
+func New(svc *service.Service, dir string) *Provisioner {
+	if dir == "" {
+		dir = "provisioning"
+	}
+	return &Provisioner{
+		svc:     svc,
+		dir:     dir,
+		running: make(map[string]struct{}),
+	}
+}
+
+// Start creates a run for the blueprint and executes it.
+func (p *Provisioner) Start(ctx context.Context, adpService *adp.Service, bp Blueprint, params map[string]string, user string) (Run, error) {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return Run{}, err
+	}
+
+	now := time.Now()
+	run := Run{
+		ID:        now.Format("20060102T150405") + "-" + hex.EncodeToString(id),
+		Status:    StatusPending,
+		CreatedAt: now,
+		CreatedBy: user,
+		UpdatedAt: now,
+		Params:    params,
+		Blueprint: bp,
+	}
+
+	for _, s := range steps {
+		status := StatusPending
+		if !s.enabled(bp) {
+			status = StatusSkipped
+		}
+		run.Steps = append(run.Steps, Step{Name: s.name, Status: status})
+	}
+
+	if err := p.save(&run); err != nil {
+		return run, err
+	}
+
+	return p.execute(ctx, adpService, run)
+}
+
+// Resume continues a failed or interrupted run with the first step that is
+// not done.
+func (p *Provisioner) Resume(ctx context.Context, adpService *adp.Service, id string) (Run, error) {
+	run, err := p.Get(id)
+	if err != nil {
+		return run, err
+	}
+
+	if run.Status == StatusCompleted {
+		return run, ErrRunCompleted
+	}
+
+	return p.execute(ctx, adpService, run)
+}
+
+// Get returns a saved run.
+func (p *Provisioner) Get(id string) (Run, error) {
+	var run Run
+
+	b, err := os.ReadFile(p.path(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return run, ErrRunNotFound
+	}
+	if err != nil {
+		return run, err
+	}
+
+	err = json.Unmarshal(b, &run)
+	return run, err
+}
+
+func (p *Provisioner) path(id string) string {
+	return filepath.Join(p.dir, filepath.Base(id)+".json")
+}
+
+func (p *Provisioner) save(run *Run) error {
+	run.UpdatedAt = time.Now()
+
+	if err := os.MkdirAll(p.dir, os.ModePerm); err != nil {
+		return fmt.Errorf("failed to create provisioning directory: %v", err)
+	}
+
+	b, err := json.MarshalIndent(run, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := p.path(run.ID) + ".tmp"
+	if err := os.WriteFile(tmp, b, 0664); err != nil {
+		return err
+	}
+	return os.Rename(tmp, p.path(run.ID))
+}
+
+// execute runs the pending and failed steps of the run in order and stops at
+// the first failure, or before the next step once the service shuts down. A
+// run is executed by one request at a time.
+func (p *Provisioner) execute(ctx context.Context, adpService *adp.Service, run Run) (Run, error) {
+	p.mu.Lock()
+	if _, ok := p.running[run.ID]; ok {
+		p.mu.Unlock()
+		return run, ErrRunInProgress
+	}
+	p.running[run.ID] = struct{}{}
+	p.mu.Unlock()
+
+	defer func() {
+		p.mu.Lock()
+		delete(p.running, run.ID)
+		p.mu.Unlock()
+	}()
+
+	// the shutdown waits for the run to finish its current step
+	end, err := p.svc.BeginOperation()
+	if err != nil {
+		return run, err
+	}
+	defer end()
+
+	run.Status = StatusRunning
+
+	for i, s := range steps {
+		step := &run.Steps[i]
+		if step.Status == StatusDone || step.Status == StatusSkipped {
+			continue
+		}
+
+		if p.svc.Stopping() {
+			logging.Ctx(ctx).Warn().Msgf("provisioning %s: stopped before %s for shutdown", run.ID, s.name)
+			run.Status = StatusInterrupted
+			return run, p.save(&run)
+		}
+
+		started := time.Now()
+		step.Status = StatusRunning
+		step.StartedAt = &started
+		step.FinishedAt = nil
+		step.Error = ""
+		if err := p.save(&run); err != nil {
+			return run, err
+		}
+
+		logging.Ctx(ctx).Info().Msgf("provisioning %s: %s", run.ID, s.name)
+		stepCtx, span := tracing.Start(ctx, "provision."+s.name)
+		output, err := s.fn(stepCtx, p, adpService, &run)
+		tracing.End(span, err)
+
+		finished := time.Now()
+		step.FinishedAt = &finished
+		step.Output = output
+
+		if errors.Is(err, service.ErrShuttingDown) {
+			logging.Ctx(ctx).Warn().Msgf("provisioning %s: %s stopped for shutdown", run.ID, s.name)
+			step.Status = StatusPending
+			step.Error = err.Error()
+			run.Status = StatusInterrupted
+			return run, p.save(&run)
+		}
+
+		if err != nil {
+			logging.Ctx(ctx).Error().Err(err).Msgf("provisioning %s: %s failed", run.ID, s.name)
+			step.Status = StatusFailed
+			step.Error = err.Error()
+			run.Status = StatusFailed
+			if saveErr := p.save(&run); saveErr != nil {
+				return run, saveErr
+			}
+			return run, nil
+		}
+
+		step.Status = StatusDone
+		if err := p.save(&run); err != nil {
+			return run, err
+		}
+	}
+
+	run.Status = StatusCompleted
+	return run, p.save(&run)
+}
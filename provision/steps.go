@@ -0,0 +1,172 @@
+package provision
+
+import (
+	"context"
+	"errors"
+
+	"github.com/xifanyan/adp"
+
+	"github.com/xifanyan/ediscovery-data-service/logging"
+	"github.com/xifanyan/ediscovery-data-service/service"
+)
+
+func createApplication(ctx context.Context, p *Provisioner, adpService *adp.Service, run *Run) (interface{}, error) {
+	app := run.Blueprint.Application
+
+	opts := []func(*adp.CreateApplicationConfiguration){
+		adp.WithCreateApplicationApplicationType(app.Type),
+		adp.WithCreateApplicationApplicationName(app.Name),
+		adp.WithCreateApplicationApplicationTemplate(app.Template),
+	}
+	if app.Workspace != "" {
+		opts = append(opts, adp.WithCreateApplicationApplicationWorkspace(app.Workspace))
+	}
+	if app.Host != "" {
+		opts = append(opts, adp.WithCreateApplicationApplicationHost(app.Host))
+	}
+
+	// a previous attempt may have created the application before failing
+	if run.ApplicationID == "" {
+		res, err := service.Call(ctx, "CreateApplication", service.BindV(adpService.CreateApplication, opts...))
+		if err != nil {
+			return nil, err
+		}
+		run.ApplicationID = res.ApplicationIdentifier
+	}
+
+	if app.DropTemplate {
+		if err := service.Exec(ctx, "DropTemplate", func() error { return adpService.DropTemplate(run.ApplicationID) }); err != nil {
+			return nil, err
+		}
+	}
+
+	var executionID string
+	if app.Start {
+		var err error
+		executionID, err = service.Call(ctx, "StartApplicationAsync", service.Bind(adpService.StartApplicationAsync, run.ApplicationID))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return map[string]string{"applicationID": run.ApplicationID, "executionID": executionID}, nil
+}
+
+// setupGroups creates the groups that do not exist yet and assigns the ones
+// with roles to the application.
+func setupGroups(ctx context.Context, p *Provisioner, adpService *adp.Service, run *Run) (interface{}, error) {
+	_, groups, err := service.Call2(ctx, "GetAllUsersAndGroups", adpService.GetAllUsersAndGroups)
+	if err != nil {
+		return nil, err
+	}
+
+	var missing []adp.GroupDefinition
+	var roles []adp.ApplicationRoles
+	for _, g := range run.Blueprint.Groups {
+		if _, ok := groups[g.Name]; !ok {
+			missing = append(missing, adp.GroupDefinition{GroupName: g.Name, Enabled: true})
+		}
+		if g.Roles != "" {
+			roles = append(roles, adp.ApplicationRoles{
+				Enabled:               true,
+				GroupOrUserName:       g.Name,
+				ApplicationIdentifier: run.ApplicationID,
+				Roles:                 g.Roles,
+			})
+		}
+	}
+
+	if len(missing) > 0 {
+		if err := service.Exec(ctx, "AddGroups", func() error { return adpService.AddGroups(missing) }); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(roles) > 0 {
+		if err := service.Exec(ctx, "AssignUsersOrGroupsToApplication", func() error { return adpService.AssignUsersOrGroupsToApplication(roles) }); err != nil {
+			return nil, err
+		}
+	}
+
+	return map[string]int{"created": len(missing), "assigned": len(roles)}, nil
+}
+
+func addCategoryValues(ctx context.Context, p *Provisioner, adpService *adp.Service, run *Run, categoryType string, values []string) (interface{}, error) {
+	category, err := p.svc.Category(categoryType)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, v := range values {
+		if err := service.Exec(ctx, "CreateOrUpdateCategory", func() error {
+			_, err := adpService.CreateOrUpdateCategory(run.ApplicationID, category.Name, v, v)
+			return err
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	return map[string]int{"added": len(values)}, nil
+}
+
+func addCustodians(ctx context.Context, p *Provisioner, adpService *adp.Service, run *Run) (interface{}, error) {
+	return addCategoryValues(ctx, p, adpService, run, "custodian", run.Blueprint.Custodians)
+}
+
+func addRedactionReasons(ctx context.Context, p *Provisioner, adpService *adp.Service, run *Run) (interface{}, error) {
+	return addCategoryValues(ctx, p, adpService, run, "redactionReason", run.Blueprint.RedactionReasons)
+}
+
+func createGlobalSearches(ctx context.Context, p *Provisioner, adpService *adp.Service, run *Run) (interface{}, error) {
+	return service.Call(ctx, "CreateGlobalSearches", service.Bind(adpService.CreateGlobalSearches, run.Blueprint.GlobalSearches))
+}
+
+func installTaggers(ctx context.Context, p *Provisioner, adpService *adp.Service, run *Run) (interface{}, error) {
+	taxonomies, err := service.GetApplicationTaxonomies(ctx, adpService, run.ApplicationID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := service.VerifyTaggers(run.Blueprint.Taggers, taxonomies); err != nil {
+		return nil, err
+	}
+
+	if err := p.svc.InstallTaggers(ctx, adpService, run.ApplicationID, run.Blueprint.Taggers); err != nil {
+		return nil, err
+	}
+
+	return map[string]int{"installed": len(run.Blueprint.Taggers)}, nil
+}
+
+// submitDataSources creates and starts the data sources. Data sources that
+// exist already were submitted by a previous attempt and are left alone.
+func submitDataSources(ctx context.Context, p *Provisioner, adpService *adp.Service, run *Run) (interface{}, error) {
+	submitted, existing := 0, 0
+
+	for _, ds := range run.Blueprint.DataSources {
+		params := service.DataIngestionParams{
+			Application: run.ApplicationID,
+			Engine:      ds.Engine,
+			Datasource:  ds.Name,
+			Template:    ds.Template,
+			Path:        ds.Path,
+			Source:      ds.Source,
+			Custodian:   ds.Custodian,
+			Batch:       ds.Batch,
+			Rules:       ds.ClassifierRules,
+		}
+
+		err := p.svc.SubmitIngestionData(ctx, adpService, params)
+		if errors.Is(err, service.ErrDataSourceExists) {
+			logging.Ctx(ctx).Info().Msgf("provisioning %s: datasource %s exists, skipping", run.ID, ds.Name)
+			existing++
+			continue
+		}
+		if err != nil {
+			return map[string]int{"submitted": submitted, "existing": existing}, err
+		}
+		submitted++
+	}
+
+	return map[string]int{"submitted": submitted, "existing": existing}, nil
+}
@@ -0,0 +1,281 @@
+// Package ratelimit protects ADP from single clients: token buckets limit
+// the requests of every user, overall and per route, and caps limit the
+// concurrent heavy requests and ADP operations, queueing the ones over the
+// cap for a while.
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"golang.org/x/sync/semaphore"
+	"golang.org/x/time/rate"
+
+	"github.com/xifanyan/ediscovery-data-service/config"
+	"github.com/xifanyan/ediscovery-data-service/metrics"
+)
+
+const (
+	// idleLimiter is how long the bucket of a user or route is kept unused
+	idleLimiter   = 10 * time.Minute
+	sweepInterval = time.Minute
+)
+
+var (
+	ErrRateLimited = errors.New("rate limit exceeded")
+	ErrBusy        = errors.New("too many concurrent requests")
+)
+
+// BusyError is returned when a capped route or ADP operation had no free slot
+// within limits.queueTimeout.
+type BusyError struct {
+	Name       string
+	Limit      int
+	RetryAfter time.Duration
+}
+
+func (e *BusyError) Error() string {
+	return fmt.Sprintf("%v: at most %d %s at a time", ErrBusy, e.Limit, e.Name)
+}
+
+func (e *BusyError) Unwrap() error {
+	return ErrBusy
+}
+
+// RetryAfterSeconds is the value of the Retry-After header for a wait of d,
+// at least one second.
+func RetryAfterSeconds(d time.Duration) string {
+	return strconv.Itoa(max(int(math.Ceil(d.Seconds())), 1))
+}
+
+type capSlots struct {
+	limit int
+	sem   *semaphore.Weighted
+}
+
+// Caps limits the concurrent requests of routes, named by their path, and the
+// concurrent calls of ADP operations, named by the operation.
+type Caps struct {
+	mu           sync.Mutex
+	slots        map[string]*capSlots
+	queueTimeout time.Duration
+}
+
+// NewCaps returns the caps of limits.concurrency.
+func NewCaps(cfg config.Config) *Caps {
+	c := &Caps{slots: make(map[string]*capSlots)}
+	c.Configure(cfg)
+	return c
+}
+
+// Configure applies changed caps, e.g. after the config was reloaded. The
+// requests holding a slot of a changed cap finish against the old one.
+func (c *Caps) Configure(cfg config.Config) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	slots := make(map[string]*capSlots, len(cfg.Limits.Concurrency))
+	for name, limit := range cfg.Limits.Concurrency {
+		if old, ok := c.slots[name]; ok && old.limit == limit {
+			slots[name] = old
+			continue
+		}
+		slots[name] = &capSlots{limit: limit, sem: semaphore.NewWeighted(int64(limit))}
+	}
+	c.slots = slots
+
+	c.queueTimeout = 0
+	if d, err := time.ParseDuration(cfg.Limits.QueueTimeout); err == nil && d > 0 {
+		c.queueTimeout = d
+	}
+}
+
+// Acquire takes a slot of the cap of name, waiting for one for up to
+// limits.queueTimeout, and returns the func releasing it. Names without a
+// cap are not limited.
+func (c *Caps) Acquire(ctx context.Context, name string) (func(), error) {
+	if c == nil {
+		return func() {}, nil
+	}
+
+	c.mu.Lock()
+	slots, ok := c.slots[name]
+	queueTimeout := c.queueTimeout
+	c.mu.Unlock()
+
+	if !ok {
+		return func() {}, nil
+	}
+
+	if slots.sem.TryAcquire(1) {
+		return func() { slots.sem.Release(1) }, nil
+	}
+
+	busy := &BusyError{Name: name, Limit: slots.limit, RetryAfter: max(queueTimeout, time.Second)}
+	if queueTimeout == 0 {
+		return nil, busy
+	}
+
+	waitCtx, cancel := context.WithTimeout(ctx, queueTimeout)
+	defer cancel()
+
+	if err := slots.sem.Acquire(waitCtx, 1); err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, busy
+	}
+	return func() { slots.sem.Release(1) }, nil
+}
+
+type bucket struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// limiters are the token buckets of the users and of their routes.
+type limiters struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+// reserve takes a token from the bucket of key, adjusted to limit, and
+// returns how long to wait for it if it is not there yet.
+func (l *limiters) reserve(key string, limit config.RateLimit) time.Duration {
+	perSecond, err := limit.PerSecond()
+	if err != nil || perSecond == 0 {
+		return 0
+	}
+	burst := limit.Burst
+	if burst == 0 {
+		burst = max(int(math.Ceil(perSecond)), 1)
+	}
+
+	now := time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastSweep) > sweepInterval {
+		for k, b := range l.buckets {
+			if now.Sub(b.lastSeen) > idleLimiter {
+				delete(l.buckets, k)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{limiter: rate.NewLimiter(rate.Limit(perSecond), burst)}
+		l.buckets[key] = b
+	}
+	b.lastSeen = now
+
+	// the limits of the config can change with a reload
+	if b.limiter.Limit() != rate.Limit(perSecond) {
+		b.limiter.SetLimitAt(now, rate.Limit(perSecond))
+	}
+	if b.limiter.Burst() != burst {
+		b.limiter.SetBurstAt(now, burst)
+	}
+
+	r := b.limiter.ReserveN(now, 1)
+	if delay := r.DelayFrom(now); delay > 0 {
+		r.CancelAt(now)
+		return delay
+	}
+	return 0
+}
+
+// userLimit is the limit of a user: the most generous limit of the roles of
+// limits.roles the user has, or limits.user.
+func userLimit(cfg config.Config, roles map[string]struct{}) config.RateLimit {
+	limit := cfg.Limits.User
+	best := -1.0
+
+	for alias, l := range cfg.Limits.Roles {
+		has := false
+		for role := range roles {
+			if _, ok := cfg.RoleMap[alias][role]; ok {
+				has = true
+				break
+			}
+		}
+		if !has {
+			continue
+		}
+
+		perSecond, err := l.PerSecond()
+		if err != nil {
+			continue
+		}
+		if perSecond == 0 {
+			// a role without rate is not limited
+			return l
+		}
+		if perSecond > best {
+			limit, best = l, perSecond
+		}
+	}
+
+	return limit
+}
+
+// Middleware limits the authenticated requests to the token buckets of
+// limits.user, or of the user's role under limits.roles, and of the route
+// under limits.routes, rejecting them with 429 and a Retry-After. Routes
+// capped under limits.concurrency wait for a slot like ADP operations do.
+func Middleware(live *config.Live, caps *Caps) echo.MiddlewareFunc {
+	l := &limiters{buckets: make(map[string]*bucket)}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			user, _ := c.Get("user").(string)
+			if user == "" {
+				// public routes are not limited
+				return next(c)
+			}
+
+			cfg := live.Config()
+			route := c.Path()
+			roles, _ := c.Get("roles").(map[string]struct{})
+
+			if wait := l.reserve("user\x00"+user, userLimit(cfg, roles)); wait > 0 {
+				metrics.ObserveRejected(route, "user_rate")
+				c.Response().Header().Set("Retry-After", RetryAfterSeconds(wait))
+				return echo.NewHTTPError(http.StatusTooManyRequests, fmt.Sprintf("%v for user %s", ErrRateLimited, user))
+			}
+
+			if limit, ok := cfg.Limits.Routes[route]; ok {
+				if wait := l.reserve("route\x00"+route+"\x00"+user, limit); wait > 0 {
+					metrics.ObserveRejected(route, "route_rate")
+					c.Response().Header().Set("Retry-After", RetryAfterSeconds(wait))
+					return echo.NewHTTPError(http.StatusTooManyRequests, fmt.Sprintf("%v for %s", ErrRateLimited, route))
+				}
+			}
+
+			release, err := caps.Acquire(c.Request().Context(), route)
+			if err != nil {
+				var busy *BusyError
+				if errors.As(err, &busy) {
+					metrics.ObserveRejected(route, "concurrency")
+					c.Response().Header().Set("Retry-After", RetryAfterSeconds(busy.RetryAfter))
+					return echo.NewHTTPError(http.StatusTooManyRequests, busy.Error())
+				}
+				return err
+			}
+			defer release()
+
+			return next(c)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package ratelimit
+
+import (
+	"testing"
+
+	"github.com/xifanyan/ediscovery-data-service/config"
+)
+
+func TestReserve(t *testing.T) {
+	tests := []struct {
+		name     string
+		limit    config.RateLimit
+		requests int
+		// admitted is how many of the requests get a token at once
+		admitted int
+	}{
+		{"no rate", config.RateLimit{}, 50, 50},
+		{"invalid rate", config.RateLimit{Rate: "fast"}, 50, 50},
+		{"burst of the rate", config.RateLimit{Rate: "3/s"}, 5, 3},
+		{"burst of at least one", config.RateLimit{Rate: "10/m"}, 3, 1},
+		{"configured burst", config.RateLimit{Rate: "1/s", Burst: 4}, 6, 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := &limiters{buckets: make(map[string]*bucket)}
+
+			admitted := 0
+			for i := 0; i < tt.requests; i++ {
+				if l.reserve("user\x00jane", tt.limit) == 0 {
+					admitted++
+				}
+			}
+			if admitted != tt.admitted {
+				t.Errorf("admitted %d of %d requests, want %d", admitted, tt.requests, tt.admitted)
+			}
+		})
+	}
+}
+
+func TestReserveKeysAndReload(t *testing.T) {
+	l := &limiters{buckets: make(map[string]*bucket)}
+	limit := config.RateLimit{Rate: "1/m", Burst: 1}
+
+	if l.reserve("user\x00jane", limit) != 0 {
+		t.Fatal("first request of jane was rejected")
+	}
+	wait := l.reserve("user\x00jane", limit)
+	if wait <= 0 {
+		t.Fatal("second request of jane was admitted")
+	}
+	if RetryAfterSeconds(wait) == "0" {
+		t.Errorf("Retry-After of %v is 0", wait)
+	}
+	if l.reserve("user\x00bob", limit) != 0 {
+		t.Error("bob shares the bucket of jane")
+	}
+
+	// a reloaded lower burst applies to the bucket in use
+	if l.reserve("user\x00ann", config.RateLimit{Rate: "1/m", Burst: 3}) != 0 {
+		t.Fatal("first request of ann was rejected")
+	}
+	lowered := config.RateLimit{Rate: "1/m", Burst: 1}
+	if l.reserve("user\x00ann", lowered) != 0 {
+		t.Error("request within the lowered burst was rejected")
+	}
+	if l.reserve("user\x00ann", lowered) == 0 {
+		t.Error("request over the lowered burst was admitted")
+	}
+}
+
+func TestUserLimit(t *testing.T) {
+	cfg := config.Config{
+		RoleMap: map[string]map[string]struct{}{
+			"Reviewer": {"Reviewer": {}},
+			"Admin":    {"Administrator": {}},
+			"Support":  {"Support": {}},
+		},
+	}
+	cfg.Limits.User = config.RateLimit{Rate: "1/s"}
+	cfg.Limits.Roles = map[string]config.RateLimit{
+		"Reviewer": {Rate: "5/s"},
+		"Admin":    {Rate: "600/m"},
+		"Support":  {},
+	}
+
+	tests := []struct {
+		name  string
+		roles []string
+		want  string
+	}{
+		{"no role", nil, "1/s"},
+		{"role without limit", []string{"Guest"}, "1/s"},
+		{"role with limit", []string{"Reviewer"}, "5/s"},
+		{"most generous role", []string{"Reviewer", "Administrator"}, "600/m"},
+		{"role without rate is not limited", []string{"Reviewer", "Support"}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			roles := make(map[string]struct{})
+			for _, role := range tt.roles {
+				roles[role] = struct{}{}
+			}
+			if got := userLimit(cfg, roles); got.Rate != tt.want {
+				t.Errorf("userLimit() = %q, want %q", got.Rate, tt.want)
+			}
+		})
+	}
+}
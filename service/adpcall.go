@@ -0,0 +1,184 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/xifanyan/ediscovery-data-service/logging"
+	"github.com/xifanyan/ediscovery-data-service/metrics"
+	"github.com/xifanyan/ediscovery-data-service/tracing"
+)
+
+// observe records one ADP call in a span and in the metrics.
+func observe(ctx context.Context, operation string, fn func() error) error {
+	_, span := tracing.Start(ctx, "adp."+operation, attribute.String("adp.operation", operation))
+
+	start := time.Now()
+	err := fn()
+	metrics.ObserveADPCall(operation, time.Since(start), err)
+
+	tracing.End(span, err)
+	return err
+}
+
+// call runs the ADP operation fn through the circuit breaker of the backend
+// of ctx, within the timeout of the operation, and retries it after transient
+// failures if it is a read or an idempotent write. An operation capped under
+// limits.concurrency first waits for a free slot. A write with an applied
+// guard is retried too, unless applied reports the failed attempt took effect.
+func call[T any](ctx context.Context, operation string, fn func() (T, error), applied func() (bool, error)) (T, error) {
+	var zero T
+
+	b := policy.breaker(backendOf(ctx))
+	retries := policy.retriesOf(operation, applied != nil)
+
+	for attempt := 0; ; attempt++ {
+		release, err := policy.capsOf().Acquire(ctx, operation)
+		if err != nil {
+			return zero, err
+		}
+		if err := b.allow(); err != nil {
+			release()
+			metrics.ObserveADPRejected(operation)
+			return zero, err
+		}
+
+		v, err := callOnce(ctx, operation, fn, release)
+		if err != nil && ctx.Err() != nil {
+			// the request went away, ADP is not to blame
+			b.abort()
+			return zero, err
+		}
+		b.record(err)
+
+		if err == nil || attempt >= retries || !transient(err) {
+			return v, err
+		}
+
+		if applied != nil {
+			done, checkErr := applied()
+			if checkErr == nil && done {
+				logging.Ctx(ctx).Info().Msgf("%s failed with %v but took effect", operation, err)
+				return zero, nil
+			}
+		}
+
+		logging.Ctx(ctx).Warn().Err(err).Msgf("%s failed, retry %d of %d", operation, attempt+1, retries)
+		metrics.ObserveADPRetry(operation)
+		if err := policy.wait(ctx, attempt); err != nil {
+			return zero, err
+		}
+	}
+}
+
+// callOnce runs fn once and gives up waiting for it after the timeout of the
+// operation. The ADP client has no context, so a call given up on finishes in
+// the background and its result is dropped. release frees the cap slot of the
+// call once fn returns, not when callOnce gives up, so a cap counts the calls
+// ADP is still working on.
+func callOnce[T any](ctx context.Context, operation string, fn func() (T, error), release func()) (T, error) {
+	timeout := policy.timeoutOf(operation)
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	type result struct {
+		v   T
+		err error
+	}
+	done := make(chan result, 1)
+
+	var res result
+	err := observe(ctx, operation, func() error {
+		go func() {
+			defer release()
+			v, err := fn()
+			done <- result{v, err}
+		}()
+
+		select {
+		case res = <-done:
+			return res.err
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return fmt.Errorf("%w: %s within %s", ErrADPTimeout, operation, timeout)
+			}
+			return ctx.Err()
+		}
+	})
+	return res.v, err
+}
+
+// Call runs the ADP operation fn in a span of ctx and records its count,
+// latency and errors. fn is usually a method value of adp.Service or one
+// bound to its arguments with Bind, Bind2 or BindV:
+//
+//	entities, err := service.Call(ctx, "ListEntities", service.BindV(adpService.ListEntities, opts...))
+//
+// The call times out after resilience.timeout, or the timeout of the
+// operation under resilience.timeouts. Reads, whose operations start with
+// List, Get or Find, are retried after transient failures, and every call
+// fails fast with ErrADPUnavailable while the circuit breaker of its ADP
+// backend is open.
+func Call[T any](ctx context.Context, operation string, fn func() (T, error)) (T, error) {
+	return call(ctx, operation, fn, nil)
+}
+
+// Call2 is Call for operations with two results.
+func Call2[T, U any](ctx context.Context, operation string, fn func() (T, U, error)) (T, U, error) {
+	type pair struct {
+		v T
+		w U
+	}
+	p, err := call(ctx, operation, func() (pair, error) {
+		v, w, err := fn()
+		return pair{v, w}, err
+	}, nil)
+	return p.v, p.w, err
+}
+
+// Exec is Call for operations whose only result is the error, or whose
+// results fn keeps itself.
+func Exec(ctx context.Context, operation string, fn func() error) error {
+	_, err := call(ctx, operation, func() (struct{}, error) { return struct{}{}, fn() }, nil)
+	return err
+}
+
+// ExecGuarded is Exec for a write that is retried after transient failures.
+// Before every retry applied checks whether the failed attempt took effect
+// anyway, e.g. that the entity it creates exists, and if so the write counts
+// as done.
+func ExecGuarded(ctx context.Context, operation string, fn func() error, applied func() (bool, error)) error {
+	_, err := call(ctx, operation, func() (struct{}, error) { return struct{}{}, fn() }, applied)
+	return err
+}
+
+// Observed returns fn recording its calls like Call on the context Cached
+// gives it, for use with Cached.
+func Observed[T any](operation string, fn func() (T, error)) func(context.Context) (T, error) {
+	return func(ctx context.Context) (T, error) { return Call(ctx, operation, fn) }
+}
+
+// Bind returns fn with its argument bound, for use with Call and Observed.
+func Bind[A, T any](fn func(A) (T, error), a A) func() (T, error) {
+	return func() (T, error) { return fn(a) }
+}
+
+// Bind2 returns fn with its arguments bound, for use with Call and Observed.
+func Bind2[A, B, T any](fn func(A, B) (T, error), a A, b B) func() (T, error) {
+	return func() (T, error) { return fn(a, b) }
+}
+
+// BindV returns the variadic fn with its arguments bound, for use with Call
+// and Observed.
+func BindV[A, T any](fn func(...A) (T, error), args ...A) func() (T, error) {
+	return func() (T, error) { return fn(args...) }
+}
+
+// BindPair returns fn with its argument bound, for use with Call2.
+func BindPair[A, T, U any](fn func(A) (T, U, error), a A) func() (T, U, error) {
+	return func() (T, U, error) { return fn(a) }
+}
@@ -0,0 +1,168 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xifanyan/adp"
+)
+
+// decommissionTokenTTL is how long a decommission confirmation token stays valid.
+const decommissionTokenTTL = 5 * time.Minute
+
+// ApplicationSnapshot is the state of an application recorded right before it
+// is decommissioned, with the outcome of the removal.
+type ApplicationSnapshot struct {
+	Application string      `json:"application"`
+	RecordedAt  time.Time   `json:"recordedAt"`
+	RecordedBy  string      `json:"recordedBy"`
+	Entity      interface{} `json:"entity"`
+	Users       interface{} `json:"users"`
+	Groups      interface{} `json:"groups"`
+	Removed     bool        `json:"removed"`
+	Error       string      `json:"error,omitempty"`
+}
+
+// decommissions signs the confirmation tokens of decommissioning and remembers
+// the used ones until they expire, so every token confirms a single request.
+type decommissions struct {
+	key []byte
+
+	mu   sync.Mutex
+	used map[string]time.Time
+}
+
+func newDecommissions() (*decommissions, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return &decommissions{key: key, used: make(map[string]time.Time)}, nil
+}
+
+func (d *decommissions) sign(user string, application string, exp string) string {
+	mac := hmac.New(sha256.New, d.key)
+	mac.Write([]byte("decommission\x00" + user + "\x00" + application + "\x00" + exp))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// DecommissionToken returns a confirmation token for the user to decommission
+// the application. The token is bound to both and expires after a few minutes.
+func (s *Service) DecommissionToken(user string, application string) (string, time.Time) {
+	expires := time.Now().Add(decommissionTokenTTL).Truncate(time.Second)
+	exp := strconv.FormatInt(expires.Unix(), 10)
+	return exp + "." + s.decommissions.sign(user, application, exp), expires
+}
+
+// VerifyDecommissionToken checks a token returned by DecommissionToken and
+// consumes it.
+func (s *Service) VerifyDecommissionToken(user string, application string, token string) error {
+	if token == "" {
+		return ErrConfirmationRequired
+	}
+
+	exp, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return ErrInvalidConfirmation
+	}
+
+	unix, err := strconv.ParseInt(exp, 10, 64)
+	if err != nil {
+		return ErrInvalidConfirmation
+	}
+	expires := time.Unix(unix, 0)
+
+	now := time.Now()
+	if now.After(expires) {
+		return ErrInvalidConfirmation
+	}
+
+	d := s.decommissions
+	if !hmac.Equal([]byte(sig), []byte(d.sign(user, application, exp))) {
+		return ErrInvalidConfirmation
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for used, until := range d.used {
+		if now.After(until) {
+			delete(d.used, used)
+		}
+	}
+	if _, ok := d.used[sig]; ok {
+		return ErrInvalidConfirmation
+	}
+	d.used[sig] = expires
+
+	return nil
+}
+
+// DecommissionApplication records the snapshot to the decommission records
+// directory, removes the application and records the outcome of the removal.
+// It returns the name of the record file.
+//
+// The ADP client has no call that removes an application, so the removal
+// fails with ErrNotImplemented and the record says the application is still
+// there.
+func (s *Service) DecommissionApplication(ctx context.Context, adpService *adp.Service, snapshot ApplicationSnapshot) (string, error) {
+	record, err := s.recordApplicationSnapshot(snapshot, "")
+	if err != nil {
+		return "", err
+	}
+
+	removeErr := removeApplication(ctx, adpService, snapshot.Application)
+	snapshot.Removed = removeErr == nil
+	if removeErr != nil {
+		snapshot.Error = removeErr.Error()
+	}
+
+	if _, err := s.recordApplicationSnapshot(snapshot, record); err != nil {
+		return record, err
+	}
+	return record, removeErr
+}
+
+// removeApplication is where the application would be removed from ADP.
+func removeApplication(ctx context.Context, adpService *adp.Service, application string) error {
+	return fmt.Errorf("%w: ADP cannot remove application %s", ErrNotImplemented, application)
+}
+
+// recordApplicationSnapshot writes the snapshot as JSON file into the
+// configured decommission records directory, to the given file or a new one
+// named after the application and time, and returns the file name.
+func (s *Service) recordApplicationSnapshot(snapshot ApplicationSnapshot, fn string) (string, error) {
+	dir := s.cfg.Applications.DecommissionRecords
+	if dir == "" {
+		dir = "decommissioned"
+	}
+
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return "", fmt.Errorf("failed to create decommission records directory: %v", err)
+	}
+
+	b, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return "", err
+	}
+
+	if fn == "" {
+		fn = filepath.Join(dir, fmt.Sprintf("%s_%s.json", filepath.Base(snapshot.Application), snapshot.RecordedAt.Format("20060102T150405")))
+	}
+	if err := os.WriteFile(fn, b, 0664); err != nil {
+		return "", fmt.Errorf("failed to write decommission record: %v", err)
+	}
+
+	return fn, nil
+}
@@ -0,0 +1,62 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestDecommissionToken(t *testing.T) {
+	decommissions, err := newDecommissions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Service{decommissions: decommissions}
+
+	token, _ := s.DecommissionToken("jane", "documentHold.1")
+
+	if err := s.VerifyDecommissionToken("bob", "documentHold.1", token); !errors.Is(err, ErrInvalidConfirmation) {
+		t.Errorf("token of another user: error = %v", err)
+	}
+	if err := s.VerifyDecommissionToken("jane", "documentHold.2", token); !errors.Is(err, ErrInvalidConfirmation) {
+		t.Errorf("token of another application: error = %v", err)
+	}
+	if err := s.VerifyDecommissionToken("jane", "documentHold.1", ""); !errors.Is(err, ErrConfirmationRequired) {
+		t.Errorf("no token: error = %v", err)
+	}
+	if err := s.VerifyDecommissionToken("jane", "documentHold.1", token); err != nil {
+		t.Fatalf("VerifyDecommissionToken() error = %v", err)
+	}
+	if err := s.VerifyDecommissionToken("jane", "documentHold.1", token); !errors.Is(err, ErrInvalidConfirmation) {
+		t.Errorf("token used twice: error = %v", err)
+	}
+}
+
+func TestDecommissionApplicationRecordsOutcome(t *testing.T) {
+	s := &Service{}
+	s.cfg.Applications.DecommissionRecords = t.TempDir()
+
+	record, err := s.DecommissionApplication(context.Background(), nil, ApplicationSnapshot{
+		Application: "documentHold.1",
+		RecordedAt:  time.Now(),
+		RecordedBy:  "jane",
+	})
+	if !errors.Is(err, ErrNotImplemented) {
+		t.Fatalf("DecommissionApplication() error = %v, want %v", err, ErrNotImplemented)
+	}
+
+	b, err := os.ReadFile(record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var snapshot ApplicationSnapshot
+	if err := json.Unmarshal(b, &snapshot); err != nil {
+		t.Fatal(err)
+	}
+	if snapshot.Removed || snapshot.Error == "" {
+		t.Errorf("record = %+v, want the application not removed, with the error", snapshot)
+	}
+}
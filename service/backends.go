@@ -0,0 +1,295 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	adp "github.com/xifanyan/adp"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/xifanyan/ediscovery-data-service/client"
+	"github.com/xifanyan/ediscovery-data-service/config"
+	"github.com/xifanyan/ediscovery-data-service/logging"
+)
+
+// BackendHeader selects the ADP backend of a request by name, or all of them
+// with "all" for the listings that merge the entities of every backend.
+const BackendHeader = "ADP-Backend"
+
+// backend is an ADP instance with the application ID prefixes and workspaces
+// routed to it. svc calls it with the credentials of the config.
+type backend struct {
+	svc        *adp.Service
+	domain     string
+	port       int
+	prefixes   []string
+	workspaces map[string]struct{}
+	probe      *adpProbe
+}
+
+func newBackends(cfg config.Config, defaultSvc *adp.Service) map[string]*backend {
+	res := map[string]*backend{
+		config.DefaultADPBackend: {svc: defaultSvc, domain: cfg.ADP.Domain, port: cfg.ADP.Port, workspaces: map[string]struct{}{}, probe: &adpProbe{}},
+	}
+
+	for name, b := range cfg.ADPBackends {
+		workspaces := make(map[string]struct{}, len(b.Workspaces))
+		for _, w := range b.Workspaces {
+			workspaces[w] = struct{}{}
+		}
+		res[name] = &backend{
+			svc:        &adp.Service{ADPClient: client.NewBackendClient(b)},
+			domain:     b.Domain,
+			port:       b.Port,
+			prefixes:   b.ApplicationPrefixes,
+			workspaces: workspaces,
+			probe:      &adpProbe{},
+		}
+	}
+
+	return res
+}
+
+// Backends lists the names of the ADP backends, the default one first.
+func (s *Service) Backends() []string {
+	names := make([]string, 0, len(s.backends))
+	for name := range s.backends {
+		if name != config.DefaultADPBackend {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return append([]string{config.DefaultADPBackend}, names...)
+}
+
+// RouteBackend picks the ADP backend of a request: the one named by the
+// ADP-Backend header, else the one with the longest prefix of the application
+// ID, else the one of the workspace, else the default backend.
+func (s *Service) RouteBackend(c echo.Context) (string, error) {
+	if name := c.Request().Header.Get(BackendHeader); name != "" {
+		if _, ok := s.backends[name]; !ok && name != config.AllADPBackends {
+			return "", fmt.Errorf("%w: %s", ErrUnknownBackend, name)
+		}
+		return name, nil
+	}
+
+	if name := s.prefixBackend(requestApplication(c)); name != "" {
+		return name, nil
+	}
+
+	if name := s.workspaceBackend(c.QueryParam("workspace")); name != "" {
+		return name, nil
+	}
+
+	return config.DefaultADPBackend, nil
+}
+
+// RouteApplication routes the request again once it has bound the application
+// and workspace of its body, such as an ingestion request, or of the
+// application it creates, such as /createApplication. The ADP-Backend header
+// still wins. A body whose application belongs to another backend than the
+// application of the path or query is rejected, as is one whose workspace
+// belongs to another backend than the one the request was routed to by its
+// workspace.
+func (s *Service) RouteApplication(c echo.Context, application string, workspace string) error {
+	if c.Request().Header.Get(BackendHeader) != "" {
+		return nil
+	}
+
+	name := s.prefixBackend(application)
+	if name == "" {
+		name = s.workspaceBackend(workspace)
+	}
+	if name == "" {
+		return nil
+	}
+
+	if routed := backendName(c); name != routed && (requestApplication(c) != "" || c.QueryParam("workspace") != "") {
+		return fmt.Errorf("%w: the body belongs to backend %s, the query to %s", ErrAmbiguousBackend, name, routed)
+	}
+
+	c.Set("adp_backend", name)
+	c.SetRequest(c.Request().WithContext(WithBackend(c.Request().Context(), name)))
+	return nil
+}
+
+// ApplicationService returns the context and the ADP service with the
+// credentials of the request for another application than the one the request
+// was routed by, such as the baseline of a drift check. It is routed like a
+// request for that application: the ADP-Backend header still wins, else the
+// backend with the longest prefix of its ID, else the default backend.
+func (s *Service) ApplicationService(c echo.Context, application string) (context.Context, *adp.Service) {
+	name := c.Request().Header.Get(BackendHeader)
+	if name == "" || name == config.AllADPBackends {
+		name = s.prefixBackend(application)
+	}
+	if _, ok := s.backends[name]; !ok {
+		name = config.DefaultADPBackend
+	}
+	return WithBackend(c.Request().Context(), name), s.backendService(c, name)
+}
+
+// requestApplication is the application ID of the path or query.
+func requestApplication(c echo.Context) string {
+	if app := c.Param("applicationID"); app != "" {
+		return app
+	}
+	return c.QueryParam("application")
+}
+
+// prefixBackend is the backend with the longest prefix of the application ID,
+// if any.
+func (s *Service) prefixBackend(app string) string {
+	var match string
+	var matchLen int
+	if app == "" {
+		return match
+	}
+	for name, b := range s.backends {
+		for _, prefix := range b.prefixes {
+			if strings.HasPrefix(app, prefix) && len(prefix) > matchLen {
+				match, matchLen = name, len(prefix)
+			}
+		}
+	}
+	return match
+}
+
+// workspaceBackend is the backend of the workspace, if any.
+func (s *Service) workspaceBackend(workspace string) string {
+	if workspace == "" {
+		return ""
+	}
+	for name, b := range s.backends {
+		if _, ok := b.workspaces[workspace]; ok {
+			return name
+		}
+	}
+	return ""
+}
+
+// backendName is the backend the request was routed to.
+func backendName(c echo.Context) string {
+	name, _ := c.Get("adp_backend").(string)
+	if name == "" || name == config.AllADPBackends {
+		return config.DefaultADPBackend
+	}
+	return name
+}
+
+// backendService returns an ADP service of the backend with the credentials
+// of the request, or the one with the credentials of the config when the
+// request has none. The services of a request are kept for the request, they
+// are never shared with another one.
+func (s *Service) backendService(c echo.Context, name string) *adp.Service {
+	b, ok := s.backends[name]
+	if !ok {
+		name = config.DefaultADPBackend
+		b = s.backends[name]
+	}
+
+	user, password, ok := requestCredentials(c)
+	if !ok {
+		return b.svc
+	}
+
+	key := "adp_service/" + name
+	if svc, ok := c.Get(key).(*adp.Service); ok {
+		return svc
+	}
+
+	logging.From(c).Debug().Msgf("ADP client of backend %s: user=%s", name, user)
+	svc := &adp.Service{ADPClient: client.NewClient(b.domain, b.port, user, password)}
+	c.Set(key, svc)
+	return svc
+}
+
+// requestCredentials returns the ADP credentials of the request, if it has
+// both a user and a password.
+func requestCredentials(c echo.Context) (string, string, bool) {
+	user, _ := c.Get("adp_user").(string)
+	password, _ := c.Get("adp_password").(string)
+	return user, password, user != "" && password != ""
+}
+
+// adpIdentity names the credentials backendService calls ADP with for the
+// request: the user and a digest of the password of the request, or those of
+// the config of the backend. Requests of the same user with another password
+// are another identity, so they never see what the other one read.
+func adpIdentity(c echo.Context) string {
+	user, password, ok := requestCredentials(c)
+	if !ok {
+		return "config"
+	}
+	sum := sha256.Sum256([]byte(user + "\x00" + password))
+	return "user:" + user + ":" + hex.EncodeToString(sum[:])
+}
+
+// FanOut lists entities of every ADP backend concurrently with list and merges
+// them, each tagged with the name of its backend under "backend". Listings
+// that are objects are merged into one object keyed by "backend/key".
+func (s *Service) FanOut(c echo.Context, list func(ctx context.Context, adpService *adp.Service) (interface{}, error)) (interface{}, error) {
+	names := s.Backends()
+
+	type listing struct {
+		keys    []string
+		entries []map[string]interface{}
+	}
+	listings := make([]listing, len(names))
+
+	g, ctx := errgroup.WithContext(c.Request().Context())
+	for i, name := range names {
+		adpService := s.backendService(c, name)
+		g.Go(func() error {
+			items, err := list(WithBackend(ctx, name), adpService)
+			if err != nil {
+				return fmt.Errorf("backend %s: %w", name, err)
+			}
+
+			keys, entries, err := listEntries(items)
+			if err != nil {
+				return fmt.Errorf("backend %s: %w", name, err)
+			}
+			for _, entry := range entries {
+				entry["backend"] = name
+			}
+			listings[i] = listing{keys: keys, entries: entries}
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+
+	keyed := false
+	for _, l := range listings {
+		keyed = keyed || l.keys != nil
+	}
+
+	if keyed {
+		res := make(map[string]interface{})
+		for i, l := range listings {
+			for j, entry := range l.entries {
+				key := fmt.Sprint(j)
+				if l.keys != nil {
+					key = l.keys[j]
+				}
+				res[names[i]+"/"+key] = entry
+			}
+		}
+		return res, nil
+	}
+
+	res := make([]interface{}, 0)
+	for _, l := range listings {
+		for _, entry := range l.entries {
+			res = append(res, entry)
+		}
+	}
+	return res, nil
+}
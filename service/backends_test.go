@@ -0,0 +1,120 @@
+package service
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/xifanyan/adp"
+
+	"github.com/xifanyan/ediscovery-data-service/config"
+)
+
+func TestRouteApplication(t *testing.T) {
+	s := &Service{backends: map[string]*backend{
+		config.DefaultADPBackend: {workspaces: map[string]struct{}{}},
+		"emea":                   {prefixes: []string{"documentHold.EU_"}, workspaces: map[string]struct{}{"EMEA": {}}},
+	}}
+
+	tests := []struct {
+		name        string
+		target      string
+		header      string
+		application string
+		workspace   string
+		want        string
+		wantErr     error
+	}{
+		{"application of the body", "/submitFileIngestionData", "", "documentHold.EU_1", "", "emea", nil},
+		{"workspace of the body", "/provision", "", "documentHold.1", "EMEA", "emea", nil},
+		{"no backend of its own", "/submitFileIngestionData", "", "documentHold.1", "", config.DefaultADPBackend, nil},
+		{"same as the query", "/submitFileIngestionData?application=documentHold.EU_1", "", "documentHold.EU_1", "", "emea", nil},
+		{"other than the query", "/submitFileIngestionData?application=documentHold.1", "", "documentHold.EU_1", "", "", ErrAmbiguousBackend},
+		{"other than the query workspace", "/createApplication?workspace=EMEA", "", "documentHold.1", "Other", "emea", nil},
+		{"header wins", "/submitFileIngestionData", config.DefaultADPBackend, "documentHold.EU_1", "", config.DefaultADPBackend, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", tt.target, nil)
+			if tt.header != "" {
+				req.Header.Set(BackendHeader, tt.header)
+			}
+			c := echo.New().NewContext(req, httptest.NewRecorder())
+
+			name, err := s.RouteBackend(c)
+			if err != nil {
+				t.Fatal(err)
+			}
+			c.Set("adp_backend", name)
+
+			err = s.RouteApplication(c, tt.application, tt.workspace)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("RouteApplication() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && backendName(c) != tt.want {
+				t.Errorf("routed to %s, want %s", backendName(c), tt.want)
+			}
+		})
+	}
+}
+
+func TestApplicationService(t *testing.T) {
+	defaultSvc, emeaSvc := &adp.Service{}, &adp.Service{}
+	s := &Service{backends: map[string]*backend{
+		config.DefaultADPBackend: {svc: defaultSvc},
+		"emea":                   {svc: emeaSvc, prefixes: []string{"documentHold.EU_"}},
+	}}
+
+	tests := []struct {
+		name        string
+		header      string
+		application string
+		want        string
+		wantSvc     *adp.Service
+	}{
+		{"prefix of the application", "", "documentHold.EU_1", "emea", emeaSvc},
+		{"no backend of its own", "", "documentHold.1", config.DefaultADPBackend, defaultSvc},
+		{"header wins", config.DefaultADPBackend, "documentHold.EU_1", config.DefaultADPBackend, defaultSvc},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// the request itself is routed by an application of the other backend
+			req := httptest.NewRequest("GET", "/applications/documentHold.2/drift", nil)
+			if tt.header != "" {
+				req.Header.Set(BackendHeader, tt.header)
+			}
+			c := echo.New().NewContext(req, httptest.NewRecorder())
+			c.Set("adp_backend", "emea")
+
+			ctx, svc := s.ApplicationService(c, tt.application)
+			if backendOf(ctx) != tt.want || svc != tt.wantSvc {
+				t.Errorf("ApplicationService() backend = %s, want %s", backendOf(ctx), tt.want)
+			}
+		})
+	}
+}
+
+func TestADPIdentity(t *testing.T) {
+	identity := func(user, password string) string {
+		c := echo.New().NewContext(httptest.NewRequest("GET", "/getWorkspaces", nil), httptest.NewRecorder())
+		c.Set("adp_user", user)
+		c.Set("adp_password", password)
+		return adpIdentity(c)
+	}
+
+	if got := identity("", ""); got != "config" {
+		t.Errorf("identity without credentials = %q", got)
+	}
+	if got := identity("jane", ""); got != "config" {
+		t.Errorf("identity without password = %q, the client of the config is used", got)
+	}
+	if identity("jane", "a") == identity("jane", "b") {
+		t.Error("another password has the same identity")
+	}
+	if identity("jane", "a") != identity("jane", "a") {
+		t.Error("the same credentials have another identity")
+	}
+}
@@ -0,0 +1,208 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/rs/zerolog/log"
+	"golang.org/x/sync/singleflight"
+
+	"github.com/xifanyan/ediscovery-data-service/metrics"
+)
+
+// Cached resources. Their TTLs can be set under cache.ttl in the config file.
+const (
+	CacheWorkspaces         = "workspaces"
+	CacheHosts              = "hosts"
+	CacheTemplates          = "templates"
+	CacheDataModel          = "dataModel"
+	CacheFieldProperties    = "fieldProperties"
+	CacheIndexConfiguration = "indexConfiguration"
+	CacheGlobalSearches     = "globalSearches"
+)
+
+// defaultCacheTTLs are used for the resources not configured under cache.ttl.
+var defaultCacheTTLs = map[string]time.Duration{
+	CacheWorkspaces:         10 * time.Minute,
+	CacheHosts:              10 * time.Minute,
+	CacheTemplates:          5 * time.Minute,
+	CacheDataModel:          time.Hour,
+	CacheFieldProperties:    5 * time.Minute,
+	CacheIndexConfiguration: 5 * time.Minute,
+	CacheGlobalSearches:     time.Minute,
+}
+
+type cacheEntry struct {
+	value   interface{}
+	expires time.Time
+}
+
+// Cache keeps the results of ADP reads for a TTL per resource. Concurrent
+// misses of the same key share one ADP call.
+type Cache struct {
+	mu      sync.Mutex
+	ttls    map[string]time.Duration
+	entries map[string]cacheEntry
+	// generations of the resources, bumped by Invalidate so results of reads
+	// started before an invalidation are not stored
+	generations map[string]uint64
+
+	group singleflight.Group
+}
+
+// NewCache returns a cache with the TTLs given as durations, e.g. "5m". A TTL
+// of "0" disables caching of the resource.
+func NewCache(ttls map[string]string) *Cache {
+	c := &Cache{
+		entries:     make(map[string]cacheEntry),
+		generations: make(map[string]uint64),
+	}
+	c.SetTTLs(ttls)
+	return c
+}
+
+// SetTTLs replaces the configured TTLs. Invalid durations are logged and the
+// default TTL of the resource is used instead.
+func (c *Cache) SetTTLs(ttls map[string]string) {
+	res := make(map[string]time.Duration, len(defaultCacheTTLs))
+	for k, v := range defaultCacheTTLs {
+		res[k] = v
+	}
+
+	for k, v := range ttls {
+		ttl, err := time.ParseDuration(v)
+		if err != nil || ttl < 0 {
+			log.Error().Msgf("invalid cache.ttl.%s %q, using %s", k, v, res[k])
+			continue
+		}
+		res[k] = ttl
+	}
+
+	c.mu.Lock()
+	c.ttls = res
+	c.mu.Unlock()
+}
+
+// Invalidate drops the cached entries of the resources.
+func (c *Cache) Invalidate(resources ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, resource := range resources {
+		c.generations[resource]++
+		prefix := resource + "\x00"
+		for key := range c.entries {
+			if strings.HasPrefix(key, prefix) {
+				delete(c.entries, key)
+			}
+		}
+	}
+}
+
+func (c *Cache) get(key string) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok || time.Now().After(e.expires) {
+		return nil, false
+	}
+	return e.value, true
+}
+
+func (c *Cache) put(resource string, key string, generation uint64, value interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ttl := c.ttls[resource]
+	if ttl <= 0 || c.generations[resource] != generation {
+		return
+	}
+	c.entries[key] = cacheEntry{value: value, expires: time.Now().Add(ttl)}
+}
+
+func (c *Cache) generation(resource string) uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.generations[resource]
+}
+
+// Cached returns the result of fn for the resource and args from the cache of
+// the service, calling fn on a miss. Entries are kept per ADP backend and the
+// ADP credentials its client calls with for the request. A request with
+// "Cache-Control: no-cache" always calls fn and refreshes the entry.
+//
+// Concurrent misses share one call of fn. It runs on a context that is not
+// canceled with the request that started it, bounded by cacheLoadTimeout
+// instead, so a client going away does not fail the others waiting for the
+// same entry. Each request stops waiting when its own context is done.
+func Cached[T any](s *Service, c echo.Context, resource string, fn func(ctx context.Context) (T, error), args ...string) (T, error) {
+	key := resource + "\x00" + backendName(c) + "\x00" + adpIdentity(c) + "\x00" + strings.Join(args, "\x00")
+	ctx := c.Request().Context()
+
+	load := func(ctx context.Context) (interface{}, error) {
+		generation := s.cache.generation(resource)
+		v, err := fn(ctx)
+		if err != nil {
+			return nil, err
+		}
+		s.cache.put(resource, key, generation, v)
+		return v, nil
+	}
+
+	if strings.Contains(c.Request().Header.Get("Cache-Control"), "no-cache") {
+		metrics.ObserveCache(resource, "bypass")
+		v, err := load(ctx)
+		t, _ := v.(T)
+		return t, err
+	}
+
+	if v, ok := s.cache.get(key); ok {
+		metrics.ObserveCache(resource, "hit")
+		t, _ := v.(T)
+		return t, nil
+	}
+	metrics.ObserveCache(resource, "miss")
+
+	ch := s.cache.group.DoChan(key, func() (interface{}, error) {
+		shared, cancel := context.WithTimeout(context.WithoutCancel(ctx), cacheLoadTimeout())
+		defer cancel()
+		return load(shared)
+	})
+
+	var zero T
+	select {
+	case res := <-ch:
+		t, _ := res.Val.(T)
+		return t, res.Err
+	case <-ctx.Done():
+		return zero, ctx.Err()
+	}
+}
+
+// cacheLoadTimeout bounds a shared call of Cached: every attempt of the
+// slowest ADP operation and the backoff between them.
+func cacheLoadTimeout() time.Duration {
+	policy.mu.Lock()
+	defer policy.mu.Unlock()
+
+	timeout := policy.timeout
+	for _, t := range policy.timeouts {
+		timeout = max(timeout, t)
+	}
+	return time.Duration(policy.retries+1)*timeout + time.Duration(policy.retries)*policy.maxBackoff
+}
+
+// InvalidateCache drops the cached entries of the resources.
+func (s *Service) InvalidateCache(resources ...string) {
+	s.cache.Invalidate(resources...)
+}
+
+// SetCacheTTLs replaces the TTLs of the cached resources, e.g. after the
+// config was reloaded. Cached entries keep the TTL they were stored with.
+func (s *Service) SetCacheTTLs(ttls map[string]string) {
+	s.cache.SetTTLs(ttls)
+}
@@ -0,0 +1,71 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/xifanyan/ediscovery-data-service/config"
+)
+
+func TestCachedLeaderCanceled(t *testing.T) {
+	s := &Service{cache: NewCache(nil)}
+
+	request := func(ctx context.Context) echo.Context {
+		req := httptest.NewRequest("GET", "/getWorkspaces", nil).WithContext(ctx)
+		return echo.New().NewContext(req, httptest.NewRecorder())
+	}
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	calls := 0
+	load := func(ctx context.Context) (string, error) {
+		calls++
+		close(started)
+		<-release
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		return "Workspace1", nil
+	}
+
+	leaderCtx, cancel := context.WithCancel(context.Background())
+	leader := make(chan error, 1)
+	go func() {
+		_, err := Cached(s, request(leaderCtx), CacheWorkspaces, load)
+		leader <- err
+	}()
+	<-started
+
+	waiter := make(chan string, 1)
+	go func() {
+		v, err := Cached(s, request(context.Background()), CacheWorkspaces, load)
+		if err != nil {
+			v = err.Error()
+		}
+		waiter <- v
+	}()
+
+	cancel()
+	if err := <-leader; !errors.Is(err, context.Canceled) {
+		t.Errorf("canceled leader error = %v, want %v", err, context.Canceled)
+	}
+
+	// give the waiter time to join the call still running for the leader
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+
+	if v := <-waiter; v != "Workspace1" {
+		t.Errorf("waiter got %q, want the workspace", v)
+	}
+	if calls != 1 {
+		t.Errorf("ADP called %d times, want once", calls)
+	}
+	if v, ok := s.cache.get(CacheWorkspaces + "\x00" + config.DefaultADPBackend + "\x00config\x00"); !ok || v != "Workspace1" {
+		t.Errorf("cached %v, %v", v, ok)
+	}
+}
@@ -0,0 +1,131 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/xifanyan/ediscovery-data-service/config"
+)
+
+// CategoryValue is a single value of a category, e.g. one redaction reason.
+// DisplayName defaults to ID when empty.
+type CategoryValue struct {
+	ID          string `json:"id"`
+	DisplayName string `json:"displayName"`
+}
+
+// Category resolves a friendly category type, e.g. "redactionReason", to the
+// ADP category configured for it.
+func (s *Service) Category(categoryType string) (config.Category, error) {
+	category, ok := s.cfg.Categories[categoryType]
+	if !ok || category.Name == "" {
+		return config.Category{}, fmt.Errorf("%w: %s", ErrCategoryTypeNotSupported, categoryType)
+	}
+	return category, nil
+}
+
+// VerifyCategoryValues trims the given values, fills in missing display names
+// and rejects empty or duplicated IDs.
+func VerifyCategoryValues(values []CategoryValue) ([]CategoryValue, error) {
+	if len(values) == 0 {
+		return nil, ErrCategoryValueRequired
+	}
+
+	seen := make(map[string]struct{}, len(values))
+	verified := make([]CategoryValue, 0, len(values))
+
+	for _, v := range values {
+		v.ID = strings.TrimSpace(v.ID)
+		v.DisplayName = strings.TrimSpace(v.DisplayName)
+
+		if v.ID == "" {
+			return nil, ErrCategoryIDRequired
+		}
+		if _, ok := seen[v.ID]; ok {
+			return nil, fmt.Errorf("category value %s is duplicated", v.ID)
+		}
+		seen[v.ID] = struct{}{}
+
+		if v.DisplayName == "" {
+			v.DisplayName = v.ID
+		}
+		verified = append(verified, v)
+	}
+
+	return verified, nil
+}
+
+// CategoryNames flattens a category listing returned by ADP into the names of
+// its values. Values are either plain strings or objects, in which case the
+// display name is preferred over the name and the ID.
+func CategoryNames(listing interface{}) ([]string, error) {
+	js, err := json.Marshal(listing)
+	if err != nil {
+		return nil, err
+	}
+
+	var values []json.RawMessage
+	if err := json.Unmarshal(js, &values); err != nil {
+		return nil, fmt.Errorf("unexpected category listing: %v", err)
+	}
+
+	names := make([]string, 0, len(values))
+	for _, raw := range values {
+		var name string
+		if err := json.Unmarshal(raw, &name); err == nil {
+			names = append(names, name)
+			continue
+		}
+
+		var obj map[string]interface{}
+		if err := json.Unmarshal(raw, &obj); err != nil {
+			return nil, fmt.Errorf("unexpected category value: %s", string(raw))
+		}
+
+		for _, key := range []string{"displayName", "DisplayName", "name", "Name", "id", "ID"} {
+			if v, ok := obj[key].(string); ok && v != "" {
+				names = append(names, v)
+				break
+			}
+		}
+	}
+
+	return names, nil
+}
+
+// CategoryValues decodes a category listing returned by ADP into its values,
+// keeping their IDs. Values are either plain strings, used as ID and display
+// name, or objects with an id and a display name. Any other value fails the
+// listing.
+func CategoryValues(listing interface{}) ([]CategoryValue, error) {
+	js, err := json.Marshal(listing)
+	if err != nil {
+		return nil, err
+	}
+
+	var raws []json.RawMessage
+	if err := json.Unmarshal(js, &raws); err != nil {
+		return nil, fmt.Errorf("%w: category values: %v", ErrUnexpectedListing, err)
+	}
+
+	values := make([]CategoryValue, 0, len(raws))
+	for _, raw := range raws {
+		var v CategoryValue
+		if err := json.Unmarshal(raw, &v.ID); err != nil {
+			if err := json.Unmarshal(raw, &v); err != nil {
+				return nil, fmt.Errorf("%w: category value %s", ErrUnexpectedListing, string(raw))
+			}
+		}
+
+		if v.ID == "" {
+			return nil, fmt.Errorf("%w: category value %s has no id", ErrUnexpectedListing, string(raw))
+		}
+		if v.DisplayName == "" {
+			v.DisplayName = v.ID
+		}
+		values = append(values, v)
+	}
+
+	return values, nil
+}
@@ -0,0 +1,227 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/xifanyan/adp"
+)
+
+// CloneReport lists what was copied from the source application and what was
+// skipped and why.
+type CloneReport struct {
+	Source        string              `json:"source"`
+	ApplicationID string              `json:"applicationID"`
+	ExecutionID   string              `json:"executionID,omitempty"`
+	Copied        map[string][]string `json:"copied"`
+	Skipped       []SkippedItem       `json:"skipped"`
+}
+
+type SkippedItem struct {
+	Kind   string `json:"kind"`
+	Name   string `json:"name,omitempty"`
+	Reason string `json:"reason"`
+}
+
+func NewCloneReport(source string) *CloneReport {
+	return &CloneReport{
+		Source:  source,
+		Copied:  make(map[string][]string),
+		Skipped: []SkippedItem{},
+	}
+}
+
+func (r *CloneReport) Copy(kind string, name string) {
+	r.Copied[kind] = append(r.Copied[kind], name)
+}
+
+func (r *CloneReport) Skip(kind string, name string, reason string) {
+	r.Skipped = append(r.Skipped, SkippedItem{Kind: kind, Name: name, Reason: reason})
+}
+
+// ApplicationTypeFromID returns the application type used to create an
+// application like the one with the given ID, e.g. documentHold for
+// documentHold.demo00001.
+func ApplicationTypeFromID(applicationID string) (string, error) {
+	prefix, _, _ := strings.Cut(applicationID, ".")
+	switch prefix {
+	case "documentHold":
+		return "documentHold", nil
+	case "axcelerate":
+		return "axcelerateStandalone", nil
+	default:
+		return "", fmt.Errorf("%w: %s", ErrApplicationTypeNotSupported, prefix)
+	}
+}
+
+// ApplicationMember is a user or group of an application with its roles in
+// the application, comma separated.
+type ApplicationMember struct {
+	Name  string `json:"name"`
+	Group bool   `json:"group"`
+	Roles string `json:"roles"`
+}
+
+// adpMember is the part of a user or group returned by
+// GetUsersAndGroupsByApplicationID that is copied to a clone. The names follow
+// UserDefinition and GroupDefinition.
+type adpMember struct {
+	UserName  string          `json:"userName"`
+	GroupName string          `json:"groupName"`
+	Roles     json.RawMessage `json:"roles"`
+}
+
+// ApplicationMembers decodes the users and groups of an application, as
+// returned by GetUsersAndGroupsByApplicationID. A member without a name or
+// roles fails the whole listing rather than being left out of a clone.
+func ApplicationMembers(users interface{}, groups interface{}) ([]ApplicationMember, error) {
+	var members []ApplicationMember
+
+	for _, list := range []struct {
+		kind    string
+		group   bool
+		listing interface{}
+	}{
+		{"user", false, users},
+		{"group", true, groups},
+	} {
+		js, err := json.Marshal(list.listing)
+		if err != nil {
+			return nil, err
+		}
+
+		var entries []adpMember
+		if err := json.Unmarshal(js, &entries); err != nil {
+			return nil, fmt.Errorf("%w: %ss of the application: %v", ErrUnexpectedListing, list.kind, err)
+		}
+
+		for i, entry := range entries {
+			name := entry.UserName
+			if list.group {
+				name = entry.GroupName
+			}
+			if name == "" {
+				return nil, fmt.Errorf("%w: %s %d of the application has no name", ErrUnexpectedListing, list.kind, i)
+			}
+
+			roles, err := joinRoles(entry.Roles)
+			if err != nil || roles == "" {
+				return nil, fmt.Errorf("%w: %s %s of the application has no roles", ErrUnexpectedListing, list.kind, name)
+			}
+
+			members = append(members, ApplicationMember{Name: name, Group: list.group, Roles: roles})
+		}
+	}
+
+	return members, nil
+}
+
+// joinRoles reads roles given as comma separated string or as list.
+func joinRoles(raw json.RawMessage) (string, error) {
+	if len(raw) == 0 {
+		return "", nil
+	}
+
+	var roles string
+	if err := json.Unmarshal(raw, &roles); err == nil {
+		return strings.TrimSpace(roles), nil
+	}
+
+	var list []string
+	if err := json.Unmarshal(raw, &list); err != nil {
+		return "", err
+	}
+	return strings.Join(list, ","), nil
+}
+
+// SecurityAssignments assigns the members to an application with their roles.
+func SecurityAssignments(applicationID string, members []ApplicationMember) []adp.ApplicationRoles {
+	roles := make([]adp.ApplicationRoles, 0, len(members))
+	for _, m := range members {
+		roles = append(roles, adp.ApplicationRoles{
+			Enabled:               true,
+			GroupOrUserName:       m.Name,
+			ApplicationIdentifier: applicationID,
+			Roles:                 m.Roles,
+		})
+	}
+	return roles
+}
+
+// SourceGlobalSearches returns the global searches of the ListGlobalSearches
+// listing that are scoped to the source application, by ID.
+func SourceGlobalSearches(listing interface{}, source string) (map[string]interface{}, error) {
+	searches, err := keyedByID(listing)
+	if err != nil {
+		return nil, fmt.Errorf("%w: global searches: %v", ErrUnexpectedListing, err)
+	}
+	return searchesOfApplication(searches, source), nil
+}
+
+// CloneSearchID is the ID of the copy of a global search for the target
+// application. Global searches are shared by all applications, so the copy
+// needs an ID of its own.
+func CloneSearchID(id string, target string) string {
+	_, name, ok := strings.Cut(target, ".")
+	if !ok || name == "" {
+		name = target
+	}
+	return id + "_" + name
+}
+
+// CloneGlobalSearch copies a global search of the source application for the
+// target application: under the ID, and scoped to the target in place of the
+// source.
+func CloneGlobalSearch(search interface{}, id string, source string, target string) (map[string]interface{}, error) {
+	js, err := json.Marshal(search)
+	if err != nil {
+		return nil, err
+	}
+
+	var item map[string]interface{}
+	if err := json.Unmarshal(js, &item); err != nil {
+		return nil, fmt.Errorf("%w: global search: %v", ErrUnexpectedListing, err)
+	}
+
+	named := false
+	for _, key := range []string{"id", "ID", "Id"} {
+		if _, ok := item[key]; ok {
+			item[key] = id
+			named = true
+		}
+	}
+	if !named {
+		item["id"] = id
+	}
+
+	rescope(item, source, target)
+	for _, key := range []string{"searchParameters", "SearchParameters"} {
+		if params, ok := item[key].(map[string]interface{}); ok {
+			rescope(params, source, target)
+		}
+	}
+	return item, nil
+}
+
+// rescope replaces the source by the target in the scope fields of m.
+func rescope(m map[string]interface{}, source string, target string) {
+	for _, key := range searchScopes {
+		switch v := m[key].(type) {
+		case string:
+			apps := strings.Split(v, ",")
+			for i, app := range apps {
+				if app == source {
+					apps[i] = target
+				}
+			}
+			m[key] = strings.Join(apps, ",")
+		case []interface{}:
+			for i, app := range v {
+				if app == source {
+					v[i] = target
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package service
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestApplicationMembers(t *testing.T) {
+	tests := []struct {
+		name    string
+		users   interface{}
+		groups  interface{}
+		want    []ApplicationMember
+		wantErr error
+	}{
+		{
+			name:   "roles as string and list",
+			users:  []map[string]interface{}{{"userName": "jane", "roles": "reviewer"}},
+			groups: []map[string]interface{}{{"groupName": "admins", "roles": []string{"admin", "reviewer"}}},
+			want: []ApplicationMember{
+				{Name: "jane", Roles: "reviewer"},
+				{Name: "admins", Group: true, Roles: "admin,reviewer"},
+			},
+		},
+		{
+			name:   "field names are matched without regard to case",
+			users:  []map[string]interface{}{{"UserName": "jane", "Roles": "reviewer"}},
+			groups: nil,
+			want:   []ApplicationMember{{Name: "jane", Roles: "reviewer"}},
+		},
+		{
+			name:    "user without name",
+			users:   []map[string]interface{}{{"name": "jane", "roles": "reviewer"}},
+			wantErr: ErrUnexpectedListing,
+		},
+		{
+			name:    "group without roles",
+			groups:  []map[string]interface{}{{"groupName": "admins"}},
+			wantErr: ErrUnexpectedListing,
+		},
+		{
+			name:    "roles of unknown shape",
+			users:   []map[string]interface{}{{"userName": "jane", "roles": map[string]string{"a": "b"}}},
+			wantErr: ErrUnexpectedListing,
+		},
+		{
+			name:    "not a list",
+			users:   map[string]interface{}{"jane": "reviewer"},
+			wantErr: ErrUnexpectedListing,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ApplicationMembers(tt.users, tt.groups)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ApplicationMembers() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ApplicationMembers() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCategoryValues(t *testing.T) {
+	tests := []struct {
+		name    string
+		listing interface{}
+		want    []CategoryValue
+		wantErr error
+	}{
+		{
+			name:    "strings",
+			listing: []string{"AC", "WP"},
+			want:    []CategoryValue{{ID: "AC", DisplayName: "AC"}, {ID: "WP", DisplayName: "WP"}},
+		},
+		{
+			name:    "objects keep their ID",
+			listing: []map[string]string{{"id": "AC", "displayName": "Attorney-Client"}, {"ID": "WP"}},
+			want:    []CategoryValue{{ID: "AC", DisplayName: "Attorney-Client"}, {ID: "WP", DisplayName: "WP"}},
+		},
+		{
+			name:    "object without ID",
+			listing: []map[string]string{{"displayName": "Attorney-Client"}},
+			wantErr: ErrUnexpectedListing,
+		},
+		{
+			name:    "value of unknown shape",
+			listing: []interface{}{42},
+			wantErr: ErrUnexpectedListing,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := CategoryValues(tt.listing)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("CategoryValues() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("CategoryValues() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSourceGlobalSearches(t *testing.T) {
+	listing := []map[string]interface{}{
+		{"id": "privileged", "applications": []interface{}{"documentHold.m1"}},
+		{"id": "hot", "searchParameters": map[string]interface{}{"applicationIdentifier": "documentHold.m2"}},
+		{"id": "system"},
+	}
+
+	got, err := SourceGlobalSearches(listing, "documentHold.m1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got["privileged"] == nil {
+		t.Errorf("SourceGlobalSearches() = %v, want privileged only", got)
+	}
+
+	if _, err := SourceGlobalSearches("not a list", "documentHold.m1"); !errors.Is(err, ErrUnexpectedListing) {
+		t.Errorf("SourceGlobalSearches() of a string error = %v, want %v", err, ErrUnexpectedListing)
+	}
+}
+
+func TestCloneGlobalSearch(t *testing.T) {
+	search := map[string]interface{}{
+		"ID":           "privileged",
+		"displayName":  "Privileged",
+		"applications": []interface{}{"documentHold.m1", "documentHold.m9"},
+		"SearchParameters": map[string]interface{}{
+			"application": "documentHold.m1",
+			"rm_main":     []interface{}{"*"},
+		},
+	}
+
+	id := CloneSearchID("privileged", "documentHold.m2")
+	if id != "privileged_m2" {
+		t.Errorf("CloneSearchID() = %q", id)
+	}
+
+	got, err := CloneGlobalSearch(search, id, "documentHold.m1", "documentHold.m2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]interface{}{
+		"ID":           "privileged_m2",
+		"displayName":  "Privileged",
+		"applications": []interface{}{"documentHold.m2", "documentHold.m9"},
+		"SearchParameters": map[string]interface{}{
+			"application": "documentHold.m2",
+			"rm_main":     []interface{}{"*"},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("CloneGlobalSearch() = %v, want %v", got, want)
+	}
+	if search["ID"] != "privileged" || search["applications"].([]interface{})[0] != "documentHold.m1" {
+		t.Errorf("CloneGlobalSearch() changed the source search: %v", search)
+	}
+}
@@ -0,0 +1,217 @@
+package service
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"github.com/xuri/excelize/v2"
+)
+
+// CustodianRecord is a single row of an HR roster.
+type CustodianRecord struct {
+	Row        int    `json:"row"`
+	Name       string `json:"name"`
+	Email      string `json:"email,omitempty"`
+	Department string `json:"department,omitempty"`
+	EmployeeID string `json:"employeeID,omitempty"`
+}
+
+// CustodianReconciliation is the outcome of comparing a roster with the
+// custodians of an application.
+//
+// Added holds the roster entries missing from the application, AlreadyPresent
+// the ones the application has already, Unmatched the custodians of the
+// application that are not in the roster and Invalid the rows that could not
+// be used.
+type CustodianReconciliation struct {
+	Added          []CustodianRecord `json:"added"`
+	AlreadyPresent []CustodianRecord `json:"alreadyPresent"`
+	Unmatched      []string          `json:"unmatched"`
+	Invalid        []InvalidRow      `json:"invalid"`
+}
+
+// InvalidRow is a row of an uploaded file that was skipped and why.
+type InvalidRow struct {
+	Row   int    `json:"row"`
+	Error string `json:"error"`
+}
+
+// rosterColumns maps normalized header names to the record field they fill.
+var rosterColumns = map[string]string{
+	"name":           "name",
+	"custodian":      "name",
+	"custodianname":  "name",
+	"fullname":       "name",
+	"email":          "email",
+	"emailaddress":   "email",
+	"department":     "department",
+	"employeeid":     "employeeID",
+	"employeenumber": "employeeID",
+}
+
+// GetCustodianRoster reads an HR roster from a CSV or XLSX file. The first row
+// must be a header naming the columns; only the name column is required.
+// For XLSX files the first sheet is read.
+func GetCustodianRoster(fn string) ([]CustodianRecord, []InvalidRow, error) {
+	var rows [][]string
+	var err error
+
+	switch strings.ToLower(filepath.Ext(fn)) {
+	case ".csv":
+		rows, err = readCSVRows(fn)
+	case ".xlsx":
+		rows, err = readFirstSheetRows(fn)
+	default:
+		return nil, nil, fmt.Errorf("unsupported roster file type %s, expecting .csv or .xlsx", filepath.Ext(fn))
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(rows) == 0 {
+		return nil, nil, fmt.Errorf("roster is empty")
+	}
+
+	columns := make(map[string]int)
+	for i, header := range rows[0] {
+		if field, ok := rosterColumns[normalizeHeader(header)]; ok {
+			if _, exists := columns[field]; !exists {
+				columns[field] = i
+			}
+		}
+	}
+	if _, ok := columns["name"]; !ok {
+		return nil, nil, fmt.Errorf("roster has no name column")
+	}
+	log.Debug().Msgf("roster columns: %+v", columns)
+
+	cell := func(row []string, field string) string {
+		i, ok := columns[field]
+		if !ok || i >= len(row) {
+			return ""
+		}
+		return strings.TrimSpace(row[i])
+	}
+
+	var records []CustodianRecord
+	var invalid []InvalidRow
+
+	for i, row := range rows[1:] {
+		// rows are reported 1-based including the header
+		rowNumber := i + 2
+
+		record := CustodianRecord{
+			Row:        rowNumber,
+			Name:       cell(row, "name"),
+			Email:      cell(row, "email"),
+			Department: cell(row, "department"),
+			EmployeeID: cell(row, "employeeID"),
+		}
+
+		if record.Name == "" && record.Email == "" && record.Department == "" && record.EmployeeID == "" {
+			continue
+		}
+
+		if NormalizeCustodianName(record.Name) == "" {
+			invalid = append(invalid, InvalidRow{Row: rowNumber, Error: "name is empty"})
+			continue
+		}
+
+		records = append(records, record)
+	}
+
+	return records, invalid, nil
+}
+
+func readCSVRows(fn string) ([][]string, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+
+	return r.ReadAll()
+}
+
+func readFirstSheetRows(fn string) ([][]string, error) {
+	f, err := excelize.OpenFile(fn)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	sheets := f.GetSheetList()
+	if len(sheets) == 0 {
+		return nil, fmt.Errorf("workbook has no sheets")
+	}
+
+	return f.GetRows(sheets[0])
+}
+
+func normalizeHeader(s string) string {
+	s = strings.ToLower(strings.TrimSpace(s))
+	return strings.NewReplacer(" ", "", "_", "", "-", "", ".", "").Replace(s)
+}
+
+// NormalizeCustodianName returns the key used to compare custodian names:
+// lower case, single spaced, without periods, and with "Last, First" turned
+// into "first last".
+func NormalizeCustodianName(name string) string {
+	name = strings.ToLower(strings.ReplaceAll(name, ".", " "))
+
+	if parts := strings.SplitN(name, ",", 2); len(parts) == 2 {
+		name = parts[1] + " " + parts[0]
+	}
+
+	return strings.Join(strings.Fields(name), " ")
+}
+
+// ReconcileCustodians compares the roster with the custodians of an
+// application by normalized name. Duplicated roster entries are reported as
+// invalid after the first occurrence.
+func ReconcileCustodians(roster []CustodianRecord, existing []string) CustodianReconciliation {
+	res := CustodianReconciliation{
+		Added:          []CustodianRecord{},
+		AlreadyPresent: []CustodianRecord{},
+		Unmatched:      []string{},
+		Invalid:        []InvalidRow{},
+	}
+
+	existingNames := make(map[string]struct{}, len(existing))
+	for _, name := range existing {
+		existingNames[NormalizeCustodianName(name)] = struct{}{}
+	}
+
+	rosterNames := make(map[string]struct{}, len(roster))
+	for _, record := range roster {
+		key := NormalizeCustodianName(record.Name)
+
+		if _, ok := rosterNames[key]; ok {
+			res.Invalid = append(res.Invalid, InvalidRow{Row: record.Row, Error: fmt.Sprintf("custodian %s is duplicated", record.Name)})
+			continue
+		}
+		rosterNames[key] = struct{}{}
+
+		if _, ok := existingNames[key]; ok {
+			res.AlreadyPresent = append(res.AlreadyPresent, record)
+		} else {
+			res.Added = append(res.Added, record)
+		}
+	}
+
+	for _, name := range existing {
+		if _, ok := rosterNames[NormalizeCustodianName(name)]; !ok {
+			res.Unmatched = append(res.Unmatched, name)
+		}
+	}
+
+	return res
+}
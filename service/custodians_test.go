@@ -0,0 +1,95 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNormalizeCustodianName(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"plain", "Jane Doe", "jane doe"},
+		{"last name first", "Doe, Jane", "jane doe"},
+		{"last name first without space", "Doe,Jane", "jane doe"},
+		{"dots", "jane.doe", "jane doe"},
+		{"spacing", "  Jane \t DOE ", "jane doe"},
+		{"initial", "Doe, Jane A.", "jane a doe"},
+		{"empty", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NormalizeCustodianName(tt.in); got != tt.want {
+				t.Errorf("NormalizeCustodianName(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReconcileCustodians(t *testing.T) {
+	jane := CustodianRecord{Row: 2, Name: "Jane Doe"}
+	bob := CustodianRecord{Row: 3, Name: "Smith, Bob"}
+	janeAgain := CustodianRecord{Row: 4, Name: "doe, jane"}
+
+	tests := []struct {
+		name     string
+		roster   []CustodianRecord
+		existing []string
+		want     CustodianReconciliation
+	}{
+		{
+			name:   "add to an application without custodians",
+			roster: []CustodianRecord{jane, bob},
+			want: CustodianReconciliation{
+				Added:          []CustodianRecord{jane, bob},
+				AlreadyPresent: []CustodianRecord{},
+				Unmatched:      []string{},
+				Invalid:        []InvalidRow{},
+			},
+		},
+		{
+			name:     "already present under another spelling",
+			roster:   []CustodianRecord{jane, bob},
+			existing: []string{"Doe, Jane"},
+			want: CustodianReconciliation{
+				Added:          []CustodianRecord{bob},
+				AlreadyPresent: []CustodianRecord{jane},
+				Unmatched:      []string{},
+				Invalid:        []InvalidRow{},
+			},
+		},
+		{
+			name:     "custodians missing from the roster",
+			roster:   []CustodianRecord{jane},
+			existing: []string{"Jane Doe", "Ann Lee", "Carl.Berg"},
+			want: CustodianReconciliation{
+				Added:          []CustodianRecord{},
+				AlreadyPresent: []CustodianRecord{jane},
+				Unmatched:      []string{"Ann Lee", "Carl.Berg"},
+				Invalid:        []InvalidRow{},
+			},
+		},
+		{
+			name:   "duplicate after the first occurrence",
+			roster: []CustodianRecord{jane, bob, janeAgain},
+			want: CustodianReconciliation{
+				Added:          []CustodianRecord{jane, bob},
+				AlreadyPresent: []CustodianRecord{},
+				Unmatched:      []string{},
+				Invalid:        []InvalidRow{{Row: 4, Error: "custodian doe, jane is duplicated"}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ReconcileCustodians(tt.roster, tt.existing)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ReconcileCustodians() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
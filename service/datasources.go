@@ -0,0 +1,390 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xifanyan/adp"
+
+	"github.com/xifanyan/ediscovery-data-service/config"
+)
+
+const defaultIngestionRecords = "ingestions"
+
+// Data source states reported by DataSourceStatus.
+const (
+	DataSourceSubmitting = "submitting"
+	DataSourceRunning    = "running"
+	DataSourceFinished   = "finished"
+	DataSourceFailed     = "failed"
+	DataSourceStopped    = "stopped"
+	DataSourceUnknown    = "unknown"
+)
+
+// The fields of the ADP entity of a data source that report its crawl, and
+// its classifier rules table. A field that is missing is left out of the
+// status rather than looked for under other names.
+const (
+	stateField           = "processStatus"
+	startField           = "processStartTime"
+	endField             = "processEndTime"
+	documentsField       = "numberOfProcessedDocuments"
+	errorsField          = "numberOfErrors"
+	classifierRulesTable = "crawlLocationClassifierRules"
+)
+
+// adpCrawlStates maps the process states ADP reports for a data source,
+// compared without regard to case, "_", "-" and spaces, e.g. NOT_STARTED and
+// NotStarted. Any other state is unknown rather than guessed from its name.
+var adpCrawlStates = map[string]string{
+	"notstarted": DataSourceStopped,
+	"idle":       DataSourceStopped,
+	"stopped":    DataSourceStopped,
+	"running":    DataSourceRunning,
+	"finished":   DataSourceFinished,
+	"completed":  DataSourceFinished,
+	"failed":     DataSourceFailed,
+	"aborted":    DataSourceFailed,
+}
+
+// IngestionRecord is what the service submitted for a data source: its
+// template and path and the classifier rules written into its
+// crawlLocationClassifierRules table.
+type IngestionRecord struct {
+	DataSource  string           `json:"dataSource"`
+	Backend     string           `json:"backend,omitempty"`
+	Application string           `json:"application,omitempty"`
+	Engine      string           `json:"engine,omitempty"`
+	Template    string           `json:"template"`
+	Path        string           `json:"path"`
+	Rules       []ClassifierRule `json:"classifierRules"`
+	SubmittedAt time.Time        `json:"submittedAt"`
+	StartedAt   *time.Time       `json:"startedAt,omitempty"`
+}
+
+// DataSourceStatus is the state and progress of the crawl of a data source,
+// with the custodian, source and batch values it classifies documents with.
+type DataSourceStatus struct {
+	ID          string `json:"id"`
+	DisplayName string `json:"displayName,omitempty"`
+	Application string `json:"application,omitempty"`
+	// State is submitting, running, finished, failed, stopped or unknown,
+	// ADPState the state as reported by ADP.
+	State      string `json:"state"`
+	ADPState   string `json:"adpState,omitempty"`
+	StartedAt  string `json:"startedAt,omitempty"`
+	FinishedAt string `json:"finishedAt,omitempty"`
+	Documents  *int64 `json:"documents,omitempty"`
+	Errors     *int64 `json:"errors,omitempty"`
+
+	// Custodian, Source and Batch are the values of the classifier rules of
+	// all locations. ClassifierRulesFrom is "adp" when the rules are the
+	// crawlLocationClassifierRules ADP reports for the data source, "record"
+	// when they are the ones the service submitted and ADP reports none.
+	Custodian           string           `json:"custodian,omitempty"`
+	Source              string           `json:"source,omitempty"`
+	Batch               string           `json:"batch,omitempty"`
+	ClassifierRules     []ClassifierRule `json:"classifierRules,omitempty"`
+	ClassifierRulesFrom string           `json:"classifierRulesFrom,omitempty"`
+
+	// Submission is the checkpoint of a submission that did not complete.
+	Submission *Checkpoint `json:"submission,omitempty"`
+	// Entity is the ADP entity of the data source.
+	Entity map[string]interface{} `json:"entity,omitempty"`
+}
+
+// DataSourceID returns the ADP entity ID of a data source name, which starts
+// with "dataSource.".
+func DataSourceID(name string) string {
+	if name != "" && !strings.HasPrefix(name, "dataSource.") {
+		return "dataSource." + name
+	}
+	return name
+}
+
+// DataSourceStatus returns the state and progress of the data source. Data
+// sources ingested by this service also report their classifier values.
+func (s *Service) DataSourceStatus(ctx context.Context, adpService *adp.Service, dataSource string) (DataSourceStatus, error) {
+	id := DataSourceID(dataSource)
+
+	entities, err := Call(ctx, "ListEntities", BindV(adpService.ListEntities, adp.WithListEntitiesID(id)))
+	if err != nil {
+		return DataSourceStatus{}, err
+	}
+
+	var entity *adp.Entity
+	if len(entities) > 0 {
+		entity = &entities[0]
+	}
+
+	status, ok := s.dataSourceStatus(ctx, id, entity)
+	if !ok {
+		return DataSourceStatus{}, fmt.Errorf("%w: %s", ErrDataSourceNotFound, id)
+	}
+	return status, nil
+}
+
+// ApplicationDataSources returns the state and progress of the data sources
+// of the application.
+func (s *Service) ApplicationDataSources(ctx context.Context, adpService *adp.Service, application string) ([]DataSourceStatus, error) {
+	entities, err := Call(ctx, "ListEntities", BindV(adpService.ListEntities,
+		adp.WithListEntitiesType("dataSource"),
+		adp.WithListEntitiesRelatedEntity(application),
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]DataSourceStatus, 0, len(entities))
+	for i := range entities {
+		status, _ := s.dataSourceStatus(ctx, entities[i].ID, &entities[i])
+		if status.Application == "" {
+			status.Application = application
+		}
+		res = append(res, status)
+	}
+	return res, nil
+}
+
+// dataSourceStatus combines the ADP entity, the ingestion record and the
+// checkpoint of the data source on the backend of ctx. It reports false when
+// there is none of them.
+func (s *Service) dataSourceStatus(ctx context.Context, id string, entity *adp.Entity) (DataSourceStatus, bool) {
+	status := DataSourceStatus{ID: id, State: DataSourceUnknown}
+	key := recordKey(ctx, id)
+
+	found := false
+	if entity != nil {
+		found = true
+		status.DisplayName = entity.DisplayName
+
+		fields := entityFields(*entity)
+		status.Entity = fields
+		status.ADPState = stringField(fields, stateField)
+		status.State = crawlState(status.ADPState)
+		status.StartedAt = stringField(fields, startField)
+		status.FinishedAt = stringField(fields, endField)
+		status.Documents = countField(fields, documentsField)
+		status.Errors = countField(fields, errorsField)
+
+		if rules, ok := entityClassifierRules(fields); ok {
+			status.ClassifierRules = rules
+			status.ClassifierRulesFrom = "adp"
+		}
+	}
+
+	if rec, err := s.ingestions.load(key); err == nil && rec != nil {
+		found = true
+		status.Application = rec.Application
+		if status.ClassifierRulesFrom == "" {
+			status.ClassifierRules = rec.Rules
+			status.ClassifierRulesFrom = "record"
+		}
+		if status.StartedAt == "" && rec.StartedAt != nil {
+			status.StartedAt = rec.StartedAt.Format(time.RFC3339)
+		}
+	}
+
+	for _, rule := range status.ClassifierRules {
+		if rule.Pattern != "*" {
+			continue
+		}
+		switch rule.Field {
+		case "rm_custodian":
+			status.Custodian = rule.Value
+		case "rm_source":
+			status.Source = rule.Value
+		case "rm_loadbatch":
+			status.Batch = rule.Value
+		}
+	}
+
+	if cp, ok := s.operations.pending("ingestion", key); ok {
+		found = true
+		status.Submission = cp
+		switch {
+		case cp.Error != "":
+			status.State = DataSourceFailed
+		case status.State == DataSourceUnknown:
+			status.State = DataSourceSubmitting
+		}
+	}
+
+	return status, found
+}
+
+// recordKey is the key of the ingestion record and the checkpoint of a data
+// source: its ID on the default backend and "backend/ID" on the others, as
+// every backend names its data sources on its own.
+func recordKey(ctx context.Context, id string) string {
+	if backend := backendOf(ctx); backend != config.DefaultADPBackend {
+		return backend + "/" + id
+	}
+	return id
+}
+
+// crawlState maps the state ADP reports for a data source to one of the
+// states of DataSourceStatus.
+func crawlState(adpState string) string {
+	normalized := strings.ToLower(strings.NewReplacer("_", "", "-", "", " ", "").Replace(adpState))
+	if state, ok := adpCrawlStates[normalized]; ok {
+		return state
+	}
+	return DataSourceUnknown
+}
+
+// entityClassifierRules reads the crawlLocationClassifierRules table from the
+// fields of the ADP entity, a list of rows of the pattern, value and field
+// columns, or of objects with these names. It reports false when the entity
+// has no such table or it has another shape.
+func entityClassifierRules(fields map[string]interface{}) ([]ClassifierRule, bool) {
+	v, ok := lookupEntityField(fields, classifierRulesTable)
+	if !ok {
+		return nil, false
+	}
+	rows, ok := v.([]interface{})
+	if !ok {
+		return nil, false
+	}
+
+	rules := make([]ClassifierRule, 0, len(rows))
+	for _, row := range rows {
+		var rule ClassifierRule
+		switch row := row.(type) {
+		case []interface{}:
+			if len(row) != 3 {
+				return nil, false
+			}
+			rule.Pattern, _ = row[0].(string)
+			rule.Value, _ = row[1].(string)
+			rule.Field, _ = row[2].(string)
+		case map[string]interface{}:
+			rule.Pattern = stringField(row, "pattern")
+			rule.Value = stringField(row, "value")
+			rule.Field = stringField(row, "field")
+		default:
+			return nil, false
+		}
+		if rule.Pattern == "" || rule.Field == "" {
+			return nil, false
+		}
+		rules = append(rules, rule)
+	}
+	return rules, true
+}
+
+func entityFields(entity adp.Entity) map[string]interface{} {
+	b, err := json.Marshal(entity)
+	if err != nil {
+		return nil
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return nil
+	}
+	return fields
+}
+
+// lookupEntityField returns the value of the field, matching its name without
+// regard to case.
+func lookupEntityField(fields map[string]interface{}, name string) (interface{}, bool) {
+	for k, v := range fields {
+		if strings.EqualFold(k, name) && v != nil {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+func stringField(fields map[string]interface{}, name string) string {
+	v, ok := lookupEntityField(fields, name)
+	if !ok {
+		return ""
+	}
+	return formatValue(v)
+}
+
+func countField(fields map[string]interface{}, name string) *int64 {
+	v, ok := lookupEntityField(fields, name)
+	if !ok {
+		return nil
+	}
+
+	var n int64
+	switch v := v.(type) {
+	case float64:
+		n = int64(v)
+	case string:
+		parsed, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+		if err != nil {
+			return nil
+		}
+		n = parsed
+	default:
+		return nil
+	}
+	return &n
+}
+
+// ingestionRecords stores the ingestion record of every data source submitted
+// by the service, one file per data source.
+type ingestionRecords struct {
+	dir string
+}
+
+func newIngestionRecords(dir string) *ingestionRecords {
+	if dir == "" {
+		dir = defaultIngestionRecords
+	}
+	return &ingestionRecords{dir: dir}
+}
+
+// path names the record file after a hash of the record key, as data source
+// IDs are chosen by the clients.
+func (r *ingestionRecords) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(r.dir, hex.EncodeToString(sum[:16])+".json")
+}
+
+func (r *ingestionRecords) load(key string) (*IngestionRecord, error) {
+	b, err := os.ReadFile(r.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var rec IngestionRecord
+	if err := json.Unmarshal(b, &rec); err != nil {
+		return nil, fmt.Errorf("invalid ingestion record of %s: %v", key, err)
+	}
+	return &rec, nil
+}
+
+func (r *ingestionRecords) save(key string, rec *IngestionRecord) error {
+	if err := os.MkdirAll(r.dir, os.ModePerm); err != nil {
+		return fmt.Errorf("failed to create ingestion records directory: %v", err)
+	}
+
+	b, err := json.MarshalIndent(rec, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	path := r.path(key)
+	if err := os.WriteFile(path+".tmp", b, 0664); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
@@ -0,0 +1,110 @@
+package service
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/xifanyan/ediscovery-data-service/config"
+)
+
+func TestCrawlState(t *testing.T) {
+	tests := []struct {
+		adpState string
+		want     string
+	}{
+		{"RUNNING", DataSourceRunning},
+		{"Running", DataSourceRunning},
+		{"FINISHED", DataSourceFinished},
+		{"Completed", DataSourceFinished},
+		{"FAILED", DataSourceFailed},
+		{"Aborted", DataSourceFailed},
+		{"STOPPED", DataSourceStopped},
+		{"NOT_STARTED", DataSourceStopped},
+		{"NotStarted", DataSourceStopped},
+		{"Not started", DataSourceStopped},
+		{"Incomplete", DataSourceUnknown},
+		{"Unfinished", DataSourceUnknown},
+		{"RunningWithErrors", DataSourceUnknown},
+		{"", DataSourceUnknown},
+	}
+
+	for _, tt := range tests {
+		if got := crawlState(tt.adpState); got != tt.want {
+			t.Errorf("crawlState(%q) = %s, want %s", tt.adpState, got, tt.want)
+		}
+	}
+}
+
+func TestEntityClassifierRules(t *testing.T) {
+	want := []ClassifierRule{
+		{Pattern: "*", Value: "Jane Doe", Field: "rm_custodian"},
+		{Pattern: "*", Value: "Email", Field: "rm_source"},
+	}
+
+	tests := []struct {
+		name   string
+		fields map[string]interface{}
+		want   []ClassifierRule
+		wantOK bool
+	}{
+		{
+			name: "rows",
+			fields: map[string]interface{}{"crawlLocationClassifierRules": []interface{}{
+				[]interface{}{"*", "Jane Doe", "rm_custodian"},
+				[]interface{}{"*", "Email", "rm_source"},
+			}},
+			want:   want,
+			wantOK: true,
+		},
+		{
+			name: "objects",
+			fields: map[string]interface{}{"CrawlLocationClassifierRules": []interface{}{
+				map[string]interface{}{"pattern": "*", "value": "Jane Doe", "field": "rm_custodian"},
+				map[string]interface{}{"Pattern": "*", "Value": "Email", "Field": "rm_source"},
+			}},
+			want:   want,
+			wantOK: true,
+		},
+		{
+			name:   "empty table",
+			fields: map[string]interface{}{"crawlLocationClassifierRules": []interface{}{}},
+			want:   []ClassifierRule{},
+			wantOK: true,
+		},
+		{
+			name:   "no table",
+			fields: map[string]interface{}{"processStatus": "RUNNING"},
+		},
+		{
+			name:   "row of another width",
+			fields: map[string]interface{}{"crawlLocationClassifierRules": []interface{}{[]interface{}{"*", "Jane Doe"}}},
+		},
+		{
+			name:   "not a list",
+			fields: map[string]interface{}{"crawlLocationClassifierRules": "*=Jane Doe"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := entityClassifierRules(tt.fields)
+			if ok != tt.wantOK {
+				t.Fatalf("entityClassifierRules() ok = %v, want %v", ok, tt.wantOK)
+			}
+			if ok && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("entityClassifierRules() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRecordKey(t *testing.T) {
+	ctx := context.Background()
+	if got := recordKey(WithBackend(ctx, config.DefaultADPBackend), "file_1"); got != "file_1" {
+		t.Errorf("key on the default backend = %q", got)
+	}
+	if got := recordKey(WithBackend(ctx, "emea"), "file_1"); got != "emea/file_1" {
+		t.Errorf("key on emea = %q", got)
+	}
+}
@@ -0,0 +1,410 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/xifanyan/adp"
+
+	"github.com/xifanyan/ediscovery-data-service/config"
+	"github.com/xifanyan/ediscovery-data-service/logging"
+)
+
+// ConfigurationSnapshot is the part of an application's configuration that is
+// checked for drift. Every section is keyed by item name so snapshots can be
+// compared item by item whatever shape ADP returns the items in.
+type ConfigurationSnapshot struct {
+	Application      string                 `json:"application"`
+	RecordedAt       time.Time              `json:"recordedAt"`
+	RedactionReasons map[string]interface{} `json:"redactionReasons"`
+	Taxonomies       map[string]interface{} `json:"taxonomies"`
+	FieldProperties  map[string]interface{} `json:"fieldProperties"`
+	GlobalSearches   map[string]interface{} `json:"globalSearches"`
+}
+
+// DriftItem is a single difference between an application and its baseline.
+type DriftItem struct {
+	Section  string      `json:"section"`
+	Name     string      `json:"name"`
+	Baseline interface{} `json:"baseline,omitempty"`
+	Actual   interface{} `json:"actual,omitempty"`
+}
+
+// DriftReport lists the items the application is missing compared to the
+// baseline, the ones it has in addition and the ones that differ.
+type DriftReport struct {
+	Application string      `json:"application"`
+	Baseline    string      `json:"baseline"`
+	CheckedAt   time.Time   `json:"checkedAt"`
+	Missing     []DriftItem `json:"missing"`
+	Extra       []DriftItem `json:"extra"`
+	Changed     []DriftItem `json:"changed"`
+}
+
+func (r DriftReport) HasDrift() bool {
+	return len(r.Missing) > 0 || len(r.Extra) > 0 || len(r.Changed) > 0
+}
+
+// SnapshotConfiguration reads the drift relevant configuration of an application.
+func (s *Service) SnapshotConfiguration(ctx context.Context, adpService *adp.Service, application string) (ConfigurationSnapshot, error) {
+	snapshot := ConfigurationSnapshot{
+		Application: application,
+		RecordedAt:  time.Now(),
+	}
+
+	category, err := s.Category("redactionReason")
+	if err != nil {
+		return snapshot, err
+	}
+
+	reasons, err := Call(ctx, "GetCategories", Bind2(adpService.GetCategories, application, category.ID))
+	if err != nil {
+		return snapshot, err
+	}
+
+	names, err := CategoryNames(reasons)
+	if err != nil {
+		return snapshot, err
+	}
+
+	snapshot.RedactionReasons = make(map[string]interface{}, len(names))
+	for _, name := range names {
+		snapshot.RedactionReasons[name] = true
+	}
+
+	dataModel, err := GetDataModel(ctx, adpService, application)
+	if err != nil {
+		return snapshot, err
+	}
+
+	indexConfiguration, err := Call(ctx, "GetIndexConfigurationTable", Bind(adpService.GetIndexConfigurationTable, dataModel))
+	if err != nil {
+		return snapshot, err
+	}
+	if snapshot.Taxonomies, err = toGeneric(indexConfiguration); err != nil {
+		return snapshot, err
+	}
+
+	fieldProperties, err := Call(ctx, "GetFieldProperties", Bind(adpService.GetFieldProperties, dataModel))
+	if err != nil {
+		return snapshot, err
+	}
+	if snapshot.FieldProperties, err = toGeneric(fieldProperties); err != nil {
+		return snapshot, err
+	}
+
+	globalSearches, err := Call(ctx, "ListGlobalSearches", adpService.ListGlobalSearches)
+	if err != nil {
+		return snapshot, err
+	}
+	if snapshot.GlobalSearches, err = keyedByID(globalSearches); err != nil {
+		return snapshot, err
+	}
+	snapshot.GlobalSearches = searchesOfApplication(snapshot.GlobalSearches, application)
+
+	return snapshot, nil
+}
+
+// toGeneric converts a map of ADP items into its JSON form, so it can be
+// stored in a baseline and compared with one read back from a file.
+func toGeneric(v interface{}) (map[string]interface{}, error) {
+	js, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	m := make(map[string]interface{})
+	if err := json.Unmarshal(js, &m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// searchScopes are the fields of a global search that name the applications it
+// is scoped to, at the top or under its search parameters.
+var searchScopes = []string{"applications", "application", "applicationIdentifiers", "applicationIdentifier"}
+
+// searchesOfApplication keeps the global searches scoped to the application.
+// ListGlobalSearches lists the searches of the whole system, so those of
+// other applications and those without a scope would show up as drift of
+// every application.
+func searchesOfApplication(searches map[string]interface{}, application string) map[string]interface{} {
+	res := make(map[string]interface{})
+	for id, search := range searches {
+		item, _ := search.(map[string]interface{})
+		params, _ := item["searchParameters"].(map[string]interface{})
+		if params == nil {
+			params, _ = item["SearchParameters"].(map[string]interface{})
+		}
+
+		var scope []string
+		for _, m := range []map[string]interface{}{item, params} {
+			if apps := firstString(m, searchScopes...); apps != "" {
+				scope = append(scope, strings.Split(apps, ",")...)
+			}
+		}
+		for _, app := range scope {
+			if app == application {
+				res[id] = search
+				break
+			}
+		}
+	}
+	return res
+}
+
+// keyedByID converts a list of ADP items into a map keyed by their ID.
+func keyedByID(v interface{}) (map[string]interface{}, error) {
+	js, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var items []map[string]interface{}
+	if err := json.Unmarshal(js, &items); err != nil {
+		return nil, fmt.Errorf("unexpected listing: %v", err)
+	}
+
+	m := make(map[string]interface{}, len(items))
+	for _, item := range items {
+		id := firstString(item, "id", "ID", "Id", "displayName", "DisplayName")
+		if id != "" {
+			m[id] = item
+		}
+	}
+	return m, nil
+}
+
+// CompareConfiguration reports the drift of the actual configuration from the baseline.
+func CompareConfiguration(baselineName string, baseline ConfigurationSnapshot, actual ConfigurationSnapshot) DriftReport {
+	report := DriftReport{
+		Application: actual.Application,
+		Baseline:    baselineName,
+		CheckedAt:   time.Now(),
+		Missing:     []DriftItem{},
+		Extra:       []DriftItem{},
+		Changed:     []DriftItem{},
+	}
+
+	sections := []struct {
+		name     string
+		baseline map[string]interface{}
+		actual   map[string]interface{}
+	}{
+		{"redactionReasons", baseline.RedactionReasons, actual.RedactionReasons},
+		{"taxonomies", baseline.Taxonomies, actual.Taxonomies},
+		{"fieldProperties", baseline.FieldProperties, actual.FieldProperties},
+		{"globalSearches", baseline.GlobalSearches, actual.GlobalSearches},
+	}
+
+	for _, section := range sections {
+		for _, name := range sortedKeys(section.baseline) {
+			want := section.baseline[name]
+			got, ok := section.actual[name]
+			switch {
+			case !ok:
+				report.Missing = append(report.Missing, DriftItem{Section: section.name, Name: name, Baseline: want})
+			case !reflect.DeepEqual(want, got):
+				report.Changed = append(report.Changed, DriftItem{Section: section.name, Name: name, Baseline: want, Actual: got})
+			}
+		}
+
+		for _, name := range sortedKeys(section.actual) {
+			if _, ok := section.baseline[name]; !ok {
+				report.Extra = append(report.Extra, DriftItem{Section: section.name, Name: name, Actual: section.actual[name]})
+			}
+		}
+	}
+
+	return report
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (s *Service) baselinePath(name string) string {
+	dir := s.cfg.Drift.Baselines
+	if dir == "" {
+		dir = "baselines"
+	}
+	return filepath.Join(dir, filepath.Base(name)+".json")
+}
+
+// SaveBaseline stores the snapshot as the named baseline.
+func (s *Service) SaveBaseline(name string, snapshot ConfigurationSnapshot) error {
+	path := s.baselinePath(name)
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return fmt.Errorf("failed to create baselines directory: %v", err)
+	}
+
+	b, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, b, 0664)
+}
+
+// LoadBaseline reads a stored baseline.
+func (s *Service) LoadBaseline(name string) (ConfigurationSnapshot, error) {
+	var snapshot ConfigurationSnapshot
+
+	b, err := os.ReadFile(s.baselinePath(name))
+	if errors.Is(err, os.ErrNotExist) {
+		return snapshot, fmt.Errorf("%w: %s", ErrBaselineNotFound, name)
+	}
+	if err != nil {
+		return snapshot, err
+	}
+
+	err = json.Unmarshal(b, &snapshot)
+	return snapshot, err
+}
+
+// ResolveBaseline returns the baseline snapshot named by baseline: the
+// configuration of another application when it is an application ID, read
+// from the backend that application is routed to, a stored baseline otherwise.
+func (s *Service) ResolveBaseline(c echo.Context, baseline string) (ConfigurationSnapshot, error) {
+	if _, err := ApplicationTypeFromID(baseline); err == nil {
+		ctx, adpService := s.ApplicationService(c, baseline)
+		return s.SnapshotConfiguration(ctx, adpService, baseline)
+	}
+	return s.LoadBaseline(baseline)
+}
+
+// CheckDrift compares the application the request was routed by with its
+// baseline.
+func (s *Service) CheckDrift(c echo.Context, application string, baseline string) (DriftReport, error) {
+	want, err := s.ResolveBaseline(c, baseline)
+	if err != nil {
+		return DriftReport{}, err
+	}
+
+	got, err := s.SnapshotConfiguration(c.Request().Context(), s.ResetADPServiceWithContextCredential(c), application)
+	if err != nil {
+		return DriftReport{}, err
+	}
+
+	return CompareConfiguration(baseline, want, got), nil
+}
+
+// RunDriftChecks checks the applications configured under drift.checks
+// against their baselines every drift.interval and logs what drifted. Each
+// application and baseline is read from its own ADP backend with the ADP
+// credentials of the config file, not those of any request.
+func (s *Service) RunDriftChecks(ctx context.Context) {
+	if len(s.cfg.Drift.Checks) == 0 {
+		return
+	}
+
+	interval, err := time.ParseDuration(s.cfg.Drift.Interval)
+	if err != nil || interval <= 0 {
+		logging.Ctx(ctx).Error().Msgf("invalid drift.interval %q, scheduled drift checks are disabled", s.cfg.Drift.Interval)
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for _, check := range s.cfg.Drift.Checks {
+				report, err := s.runDriftCheck(ctx, check.Application, check.Baseline)
+				if err != nil {
+					logging.Ctx(ctx).Error().Err(err).Msgf("drift check of %s against %s failed", check.Application, check.Baseline)
+					continue
+				}
+
+				if !report.HasDrift() {
+					logging.Ctx(ctx).Info().Msgf("no drift of %s from %s", check.Application, check.Baseline)
+					continue
+				}
+
+				for _, item := range report.Missing {
+					logging.Ctx(ctx).Warn().Msgf("drift of %s from %s: missing %s %s", check.Application, check.Baseline, item.Section, item.Name)
+				}
+				for _, item := range report.Extra {
+					logging.Ctx(ctx).Warn().Msgf("drift of %s from %s: extra %s %s", check.Application, check.Baseline, item.Section, item.Name)
+				}
+				for _, item := range report.Changed {
+					logging.Ctx(ctx).Warn().Msgf("drift of %s from %s: changed %s %s", check.Application, check.Baseline, item.Section, item.Name)
+				}
+			}
+		}
+	}
+}
+
+// runDriftCheck is a scheduled CheckDrift, routed like a request without an
+// ADP-Backend header: the application and a baseline that is an application
+// go to the backend with the longest prefix of their ID, else to the default
+// backend.
+func (s *Service) runDriftCheck(ctx context.Context, application string, baseline string) (DriftReport, error) {
+	var want ConfigurationSnapshot
+	var err error
+	if _, typeErr := ApplicationTypeFromID(baseline); typeErr == nil {
+		backendCtx, adpService := s.configBackend(ctx, baseline)
+		want, err = s.SnapshotConfiguration(backendCtx, adpService, baseline)
+	} else {
+		want, err = s.LoadBaseline(baseline)
+	}
+	if err != nil {
+		return DriftReport{}, err
+	}
+
+	backendCtx, adpService := s.configBackend(ctx, application)
+	got, err := s.SnapshotConfiguration(backendCtx, adpService, application)
+	if err != nil {
+		return DriftReport{}, err
+	}
+
+	return CompareConfiguration(baseline, want, got), nil
+}
+
+// configBackend returns the context and the ADP service with the credentials
+// of the config of the backend of the application.
+func (s *Service) configBackend(ctx context.Context, application string) (context.Context, *adp.Service) {
+	name := s.prefixBackend(application)
+	if name == "" {
+		name = config.DefaultADPBackend
+	}
+	return WithBackend(ctx, name), s.backends[name].svc
+}
+
+func firstString(m map[string]interface{}, keys ...string) string {
+	for _, key := range keys {
+		switch v := m[key].(type) {
+		case string:
+			if v != "" {
+				return v
+			}
+		case []interface{}:
+			var parts []string
+			for _, p := range v {
+				if s, ok := p.(string); ok && s != "" {
+					parts = append(parts, s)
+				}
+			}
+			if len(parts) > 0 {
+				return strings.Join(parts, ",")
+			}
+		}
+	}
+	return ""
+}
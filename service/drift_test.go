@@ -0,0 +1,39 @@
+package service
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestSearchesOfApplication(t *testing.T) {
+	searches := map[string]interface{}{
+		"savedSearch.a": map[string]interface{}{"id": "savedSearch.a", "applications": []interface{}{"axcelerate.m1", "axcelerate.m2"}},
+		"savedSearch.b": map[string]interface{}{"id": "savedSearch.b", "application": "axcelerate.m2"},
+		"savedSearch.c": map[string]interface{}{"id": "savedSearch.c", "searchParameters": map[string]interface{}{"applicationIdentifiers": []interface{}{"axcelerate.m1"}}},
+		"savedSearch.d": map[string]interface{}{"id": "savedSearch.d"},
+		"savedSearch.e": map[string]interface{}{"id": "savedSearch.e", "application": "axcelerate.m10"},
+	}
+
+	tests := []struct {
+		application string
+		want        []string
+	}{
+		{"axcelerate.m1", []string{"savedSearch.a", "savedSearch.c"}},
+		{"axcelerate.m2", []string{"savedSearch.a", "savedSearch.b"}},
+		{"axcelerate.m3", []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.application, func(t *testing.T) {
+			got := make([]string, 0)
+			for id := range searchesOfApplication(searches, tt.application) {
+				got = append(got, id)
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("searchesOfApplication() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
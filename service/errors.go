@@ -9,13 +9,44 @@ var (
 	ErrCustodianRequired       = errors.New("custodian is required")
 	ErrTemplateRequired        = errors.New("template is required")
 	ErrValidEntityTypeRequired = errors.New("valid entity type is required")
+	ErrTaggerRequired          = errors.New("at least one tagger is required")
+	ErrTaggerIDRequired        = errors.New("tagger id is required")
+	ErrCategoryValueRequired   = errors.New("at least one category value is required")
+	ErrCategoryIDRequired      = errors.New("category value id is required")
+	ErrConfirmationRequired    = errors.New("confirmation token is required")
+	ErrClassifierRuleInvalid   = errors.New("classifier rule requires pattern, field and value")
 
 	ErrApplicationTypeNotSupported = errors.New("application type not supported")
+	ErrDataSourceExists            = errors.New("datasource already exist")
+	ErrUnknownBackend              = errors.New("unknown ADP backend")
+	ErrAmbiguousBackend            = errors.New("request is routed to two ADP backends")
+	ErrUnknownField                = errors.New("unknown field")
+	ErrFanOutNotSupported          = errors.New("listing all ADP backends is not supported here")
+	ErrUnexpectedListing           = errors.New("unexpected ADP listing")
+	ErrCategoryTypeNotSupported    = errors.New("category type not supported")
+	ErrInvalidConfirmation         = errors.New("confirmation token is invalid or expired")
+	ErrPreconditionFailed          = errors.New("resource was modified, If-Match does not match its current ETag")
 
-	ErrUserNotFound     = errors.New("user not found")
-	ErrGroupNotFound    = errors.New("groupnot found")
-	ErrEntityNotFound   = errors.New("entity not found")
-	ErrTemplateNotFound = errors.New("template not found")
+	ErrUserNotFound          = errors.New("user not found")
+	ErrGroupNotFound         = errors.New("groupnot found")
+	ErrEntityNotFound        = errors.New("entity not found")
+	ErrTemplateNotFound      = errors.New("template not found")
+	ErrDataModelNotFound     = errors.New("data model not found")
+	ErrApplicationNotFound   = errors.New("application not found")
+	ErrBaselineNotFound      = errors.New("baseline not found")
+	ErrDataSourceNotFound    = errors.New("datasource not found")
+	ErrTaggerNotFound        = errors.New("tagger not found")
+	ErrCategoryValueNotFound = errors.New("category value not found")
 
 	ErrNotImplemented = errors.New("not implemented")
+	ErrShuttingDown   = errors.New("service is shutting down")
+	ErrADPUnavailable = errors.New("ADP is unavailable")
+	ErrADPTimeout     = errors.New("ADP did not answer in time")
+
+	ErrOperationInProgress = errors.New("operation is in progress")
+	ErrCheckpointMismatch  = errors.New("a checkpoint of the operation has other parameters, submit it again as before")
+
+	ErrIdempotencyKeyInvalid  = errors.New("Idempotency-Key must be 1 to 255 printable ASCII characters")
+	ErrIdempotencyKeyReused   = errors.New("Idempotency-Key was used for a different request")
+	ErrIdempotencyKeyInFlight = errors.New("a request with this Idempotency-Key is in progress")
 )
@@ -0,0 +1,344 @@
+package service
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+
+	"github.com/xifanyan/ediscovery-data-service/config"
+)
+
+const (
+	defaultProbeTimeout  = 5 * time.Second
+	defaultProbeCacheTTL = 10 * time.Second
+
+	// probeSamples is the number of probe latencies kept for the percentiles
+	probeSamples = 100
+)
+
+// ProbeResult is the outcome of one ADP connectivity probe.
+type ProbeResult struct {
+	OK        bool      `json:"ok"`
+	CheckedAt time.Time `json:"checkedAt"`
+	Latency   string    `json:"latency"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// ReadinessCheck is the outcome of one of the checks of Readiness.
+type ReadinessCheck struct {
+	Name  string `json:"name"`
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+type TLSInfo struct {
+	Version     string    `json:"version,omitempty"`
+	CipherSuite string    `json:"cipherSuite,omitempty"`
+	Subject     string    `json:"subject,omitempty"`
+	Issuer      string    `json:"issuer,omitempty"`
+	NotAfter    time.Time `json:"notAfter,omitempty"`
+	Verified    bool      `json:"verified"`
+	Error       string    `json:"error,omitempty"`
+}
+
+type EndpointDiagnostics struct {
+	Endpoint    string            `json:"endpoint"`
+	TLS         *TLSInfo          `json:"tls,omitempty"`
+	Probe       *ProbeResult      `json:"probe,omitempty"`
+	Latency     map[string]string `json:"latency,omitempty"`
+	LastError   string            `json:"lastError,omitempty"`
+	LastErrorAt *time.Time        `json:"lastErrorAt,omitempty"`
+}
+
+type Diagnostics struct {
+	// ADP is the default backend, ADPBackends are the others by name.
+	ADP          EndpointDiagnostics            `json:"adp"`
+	ADPBackends  map[string]EndpointDiagnostics `json:"adpBackends,omitempty"`
+	SearchWebAPI EndpointDiagnostics            `json:"searchWebAPI"`
+	// Circuits are the states of the circuit breakers of the ADP backends.
+	Circuits map[string]string `json:"circuits"`
+}
+
+// adpProbe keeps the last probe result of an ADP backend, the latest probe
+// latencies and the last probe error. Concurrent probes share one call.
+type adpProbe struct {
+	group singleflight.Group
+
+	mu        sync.Mutex
+	last      ProbeResult
+	latencies []time.Duration
+	next      int
+
+	lastError   string
+	lastErrorAt time.Time
+}
+
+func parseDurationOr(s string, def time.Duration) time.Duration {
+	if d, err := time.ParseDuration(s); err == nil && d > 0 {
+		return d
+	}
+	return def
+}
+
+// ProbeADP checks that every ADP backend answers a lightweight call with the
+// credentials of the config file. The backends are probed concurrently, the
+// result of each is reused for health.probeCacheTTL, and a probe not answered
+// within health.probeTimeout fails.
+func (s *Service) ProbeADP(ctx context.Context) map[string]ProbeResult {
+	names := s.Backends()
+	results := make([]ProbeResult, len(names))
+
+	var wg sync.WaitGroup
+	for i, name := range names {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = s.probeBackend(ctx, name)
+		}()
+	}
+	wg.Wait()
+
+	res := make(map[string]ProbeResult, len(names))
+	for i, name := range names {
+		res[name] = results[i]
+	}
+	return res
+}
+
+func (s *Service) probeBackend(ctx context.Context, name string) ProbeResult {
+	b := s.backends[name]
+	p := b.probe
+
+	ttl := parseDurationOr(s.cfg.Health.ProbeCacheTTL, defaultProbeCacheTTL)
+	p.mu.Lock()
+	last := p.last
+	p.mu.Unlock()
+	if !last.CheckedAt.IsZero() && time.Since(last.CheckedAt) < ttl {
+		return last
+	}
+
+	v, _, _ := p.group.Do(name, func() (interface{}, error) {
+		timeout := parseDurationOr(s.cfg.Health.ProbeTimeout, defaultProbeTimeout)
+		// the probe is shared, so a caller that goes away does not end it
+		probeCtx, cancel := context.WithTimeout(WithBackend(context.WithoutCancel(ctx), name), timeout)
+		defer cancel()
+
+		start := time.Now()
+		_, err := Call(probeCtx, "ListWorkspaces", b.svc.ListWorkspaces)
+		latency := time.Since(start)
+		if err != nil && errors.Is(probeCtx.Err(), context.DeadlineExceeded) {
+			err = fmt.Errorf("no answer from ADP within %s", timeout)
+		}
+
+		return p.record(err, latency), nil
+	})
+	return v.(ProbeResult)
+}
+
+// record keeps the outcome of a probe.
+func (p *adpProbe) record(err error, latency time.Duration) ProbeResult {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.last = ProbeResult{OK: err == nil, CheckedAt: time.Now(), Latency: latency.String()}
+	if err != nil {
+		p.last.Error = err.Error()
+		p.lastError = err.Error()
+		p.lastErrorAt = p.last.CheckedAt
+	}
+
+	if len(p.latencies) < probeSamples {
+		p.latencies = append(p.latencies, latency)
+	} else {
+		p.latencies[p.next] = latency
+		p.next = (p.next + 1) % probeSamples
+	}
+
+	return p.last
+}
+
+// Readiness checks that the service is not shutting down, the config, that
+// the log file is writable and that ADP answers.
+func (s *Service) Readiness(ctx context.Context) (bool, []ReadinessCheck) {
+	var checks []ReadinessCheck
+
+	add := func(name string, err error) {
+		check := ReadinessCheck{Name: name, OK: err == nil}
+		if err != nil {
+			check.Error = err.Error()
+		}
+		checks = append(checks, check)
+	}
+
+	if s.operations.draining.Load() {
+		add("shutdown", ErrShuttingDown)
+	}
+	add("config", s.cfg.Validate())
+	add("log", checkWritable(s.cfg.Log.Path))
+
+	probes := s.ProbeADP(ctx)
+	for _, name := range s.Backends() {
+		check := "adp"
+		if name != config.DefaultADPBackend {
+			check = "adp/" + name
+		}
+
+		if probe := probes[name]; probe.OK {
+			add(check, nil)
+		} else {
+			add(check, fmt.Errorf("%s", probe.Error))
+		}
+	}
+
+	ready := true
+	for _, check := range checks {
+		ready = ready && check.OK
+	}
+	return ready, checks
+}
+
+func checkWritable(path string) error {
+	if path == "" {
+		return fmt.Errorf("log.path is not set")
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0664)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// Diagnostics reports the configured ADP backends and SearchWebAPI endpoint,
+// the TLS details of every backend and the latencies and last error of its
+// probes.
+func (s *Service) Diagnostics(ctx context.Context) Diagnostics {
+	probes := s.ProbeADP(ctx)
+	timeout := parseDurationOr(s.cfg.Health.ProbeTimeout, defaultProbeTimeout)
+
+	names := s.Backends()
+	endpoints := make([]EndpointDiagnostics, len(names))
+
+	var wg sync.WaitGroup
+	for i, name := range names {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			probe := probes[name]
+			endpoints[i] = s.backends[name].diagnostics(probe, timeout)
+		}()
+	}
+	wg.Wait()
+
+	d := Diagnostics{
+		ADP: endpoints[0],
+		SearchWebAPI: EndpointDiagnostics{
+			Endpoint: fmt.Sprintf("%s:%d%s", s.cfg.SearchWebAPI.Domain, s.cfg.SearchWebAPI.Port, s.cfg.SearchWebAPI.Endpoint),
+		},
+		Circuits: CircuitBreakers(),
+	}
+	if len(names) > 1 {
+		d.ADPBackends = make(map[string]EndpointDiagnostics, len(names)-1)
+		for i, name := range names[1:] {
+			d.ADPBackends[name] = endpoints[i+1]
+		}
+	}
+
+	return d
+}
+
+// diagnostics reports the endpoint, TLS details and probes of the backend.
+func (b *backend) diagnostics(probe ProbeResult, timeout time.Duration) EndpointDiagnostics {
+	address := net.JoinHostPort(b.domain, fmt.Sprint(b.port))
+	d := EndpointDiagnostics{
+		Endpoint: address,
+		TLS:      inspectTLS(address, b.domain, timeout),
+		Probe:    &probe,
+	}
+
+	p := b.probe
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	d.Latency = percentiles(p.latencies)
+	if p.lastError != "" {
+		at := p.lastErrorAt
+		d.LastError = p.lastError
+		d.LastErrorAt = &at
+	}
+
+	return d
+}
+
+func percentiles(samples []time.Duration) map[string]string {
+	if len(samples) == 0 {
+		return nil
+	}
+
+	sorted := append([]time.Duration(nil), samples...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	at := func(p int) string {
+		return sorted[(len(sorted)-1)*p/100].String()
+	}
+
+	return map[string]string{"p50": at(50), "p90": at(90), "p99": at(99)}
+}
+
+// inspectTLS connects to the address and reports the negotiated TLS version
+// and cipher suite and the server certificate, and whether it verifies.
+func inspectTLS(address string, serverName string, timeout time.Duration) *TLSInfo {
+	dialer := &net.Dialer{Timeout: timeout}
+	conn, err := tls.DialWithDialer(dialer, "tcp", address, &tls.Config{
+		ServerName: serverName,
+		// the certificate is verified below, so its details can be reported either way
+		InsecureSkipVerify: true,
+	})
+	if err != nil {
+		return &TLSInfo{Error: err.Error()}
+	}
+	defer conn.Close()
+
+	state := conn.ConnectionState()
+	info := &TLSInfo{
+		Version:     tls.VersionName(state.Version),
+		CipherSuite: tls.CipherSuiteName(state.CipherSuite),
+	}
+
+	if len(state.PeerCertificates) == 0 {
+		info.Error = "no server certificate"
+		return info
+	}
+
+	cert := state.PeerCertificates[0]
+	info.Subject = cert.Subject.String()
+	info.Issuer = cert.Issuer.String()
+	info.NotAfter = cert.NotAfter
+
+	intermediates := x509.NewCertPool()
+	for _, c := range state.PeerCertificates[1:] {
+		intermediates.AddCert(c)
+	}
+
+	_, err = cert.Verify(x509.VerifyOptions{DNSName: serverName, Intermediates: intermediates})
+	info.Verified = err == nil
+	if err != nil {
+		info.Error = err.Error()
+	}
+
+	return info
+}
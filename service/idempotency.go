@@ -0,0 +1,211 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/xifanyan/ediscovery-data-service/logging"
+)
+
+const (
+	defaultIdempotencyStore  = "idempotency"
+	defaultIdempotencyWindow = 24 * time.Hour
+	idempotencyPurgeInterval = time.Hour
+)
+
+// IdempotentResponse is the final response of a request sent with an
+// Idempotency-Key, replayed to retries of the request within the window.
+type IdempotentResponse struct {
+	Key         string    `json:"key"`
+	User        string    `json:"user"`
+	Fingerprint string    `json:"fingerprint"`
+	Status      int       `json:"status"`
+	ContentType string    `json:"contentType"`
+	Body        []byte    `json:"body"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+// idempotency stores the responses of the requests with an Idempotency-Key,
+// one file per user and key, and tracks the requests in progress.
+type idempotency struct {
+	dir    string
+	window time.Duration
+
+	mu     sync.Mutex
+	active map[string]string
+}
+
+func newIdempotency(dir string, window string) *idempotency {
+	if dir == "" {
+		dir = defaultIdempotencyStore
+	}
+	return &idempotency{
+		dir:    dir,
+		window: parseDurationOr(window, defaultIdempotencyWindow),
+		active: make(map[string]string),
+	}
+}
+
+// BeginIdempotent starts the request of user with the Idempotency-Key key and
+// the fingerprint of its method, URL and body. It returns the stored response
+// when the request was completed before, ErrIdempotencyKeyReused when the key
+// was used for a different request and ErrIdempotencyKeyInFlight while the
+// first request with the key is still running. A request that failed with a
+// server error is run again when it is resumable, as the checkpoint of its
+// operation continues it after the steps that finished. Otherwise the request
+// is registered and must be ended with CompleteIdempotent or
+// AbandonIdempotent.
+func (s *Service) BeginIdempotent(user string, key string, fingerprint string, resumable bool) (*IdempotentResponse, error) {
+	store := s.idempotency
+	path := store.path(user, key)
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if active, ok := store.active[path]; ok {
+		if active != fingerprint {
+			return nil, ErrIdempotencyKeyReused
+		}
+		return nil, ErrIdempotencyKeyInFlight
+	}
+
+	res, err := store.load(path)
+	if err != nil {
+		return nil, err
+	}
+	if res != nil {
+		if res.Fingerprint != fingerprint {
+			return nil, ErrIdempotencyKeyReused
+		}
+		if res.Status < http.StatusInternalServerError || !resumable {
+			return res, nil
+		}
+	}
+
+	store.active[path] = fingerprint
+	return nil, nil
+}
+
+// CompleteIdempotent stores the final response of the request and ends it.
+func (s *Service) CompleteIdempotent(res IdempotentResponse) error {
+	store := s.idempotency
+	path := store.path(res.User, res.Key)
+
+	defer func() {
+		store.mu.Lock()
+		delete(store.active, path)
+		store.mu.Unlock()
+	}()
+
+	res.CreatedAt = time.Now()
+
+	if err := os.MkdirAll(store.dir, os.ModePerm); err != nil {
+		return fmt.Errorf("failed to create idempotency store: %v", err)
+	}
+
+	b, err := json.Marshal(res)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path+".tmp", b, 0664); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// AbandonIdempotent ends the request without storing its response, so a retry
+// runs it again.
+func (s *Service) AbandonIdempotent(user string, key string) {
+	store := s.idempotency
+	path := store.path(user, key)
+
+	store.mu.Lock()
+	delete(store.active, path)
+	store.mu.Unlock()
+}
+
+// path names the file of the response after a hash of the user and key, as
+// keys are chosen by the clients.
+func (store *idempotency) path(user string, key string) string {
+	sum := sha256.Sum256([]byte(user + "\x00" + key))
+	return filepath.Join(store.dir, hex.EncodeToString(sum[:16])+".json")
+}
+
+// load returns the response stored at path, or nil if there is none within
+// the window. Expired responses are removed.
+func (store *idempotency) load(path string) (*IdempotentResponse, error) {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var res IdempotentResponse
+	if err := json.Unmarshal(b, &res); err != nil {
+		log.Error().Err(err).Msgf("invalid idempotent response %s, ignoring it", path)
+		return nil, nil
+	}
+
+	if time.Since(res.CreatedAt) > store.window {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		return nil, nil
+	}
+	return &res, nil
+}
+
+// RunIdempotencyPurge removes the stored responses older than the window
+// every hour until ctx is done.
+func (s *Service) RunIdempotencyPurge(ctx context.Context) {
+	ticker := time.NewTicker(idempotencyPurgeInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.idempotency.purge(); err != nil {
+			logging.Ctx(ctx).Error().Err(err).Msg("failed to purge idempotent responses")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (store *idempotency) purge() error {
+	entries, err := os.ReadDir(store.dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+		if _, err := store.load(filepath.Join(store.dir, entry.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
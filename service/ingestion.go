@@ -0,0 +1,304 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/xifanyan/adp"
+
+	"github.com/xifanyan/ediscovery-data-service/logging"
+	"github.com/xifanyan/ediscovery-data-service/metrics"
+)
+
+// DataIngestionParams describes a data source to create from a template and crawl.
+type DataIngestionParams struct {
+	Application string
+	Engine      string
+	Datasource  string
+	Template    string
+	Path        string
+	Source      string
+	Custodian   string
+	Batch       string
+	// Rules are classifier rules mapping further fields, added after the
+	// source, custodian and batch rules.
+	Rules []ClassifierRule
+}
+
+func createDataSourceOptions(params DataIngestionParams) []func(*adp.CreateDataSourceConfiguration) {
+	opts := []func(*adp.CreateDataSourceConfiguration){
+		adp.WithCreateDatasourceDatasourceIdentifier(params.Datasource),
+		adp.WithCreateDatasourceDatasourceTemplate(params.Template),
+	}
+
+	if params.Engine != "" {
+		opts = append(opts, adp.WithCreateDatasourceEngineIdentifier(params.Engine))
+	} else if params.Application != "" {
+		opts = append(opts, adp.WithCreateDatasourceApplicationIdentifier(params.Application))
+	}
+
+	return opts
+}
+
+// ClassifierRule is a row of the crawlLocationClassifierRules table of a data
+// source: the documents whose location matches Pattern get Value in Field.
+type ClassifierRule struct {
+	Pattern string `json:"pattern"`
+	Value   string `json:"value"`
+	Field   string `json:"field"`
+}
+
+// ClassifierRules returns the classifier rules of the source, custodian and
+// batch of the ingestion followed by its own rules. The source defaults to
+// the data source name.
+func ClassifierRules(params DataIngestionParams) []ClassifierRule {
+	source := params.Source
+	if len(source) == 0 {
+		source = params.Datasource
+	}
+	rules := []ClassifierRule{{Pattern: "*", Value: source, Field: "rm_source"}}
+
+	if len(params.Custodian) != 0 {
+		rules = append(rules, ClassifierRule{Pattern: "*", Value: params.Custodian, Field: "rm_custodian"})
+	}
+
+	if len(params.Batch) != 0 {
+		rules = append(rules, ClassifierRule{Pattern: "*", Value: params.Batch, Field: "rm_loadbatch"})
+	}
+
+	return append(rules, params.Rules...)
+}
+
+// ValidateClassifierRules checks that the rules of the ingestion are complete
+// and map fields of the data model of the application or engine.
+func ValidateClassifierRules(ctx context.Context, adpService *adp.Service, params DataIngestionParams) error {
+	if len(params.Rules) == 0 {
+		return nil
+	}
+
+	for i, rule := range params.Rules {
+		if rule.Pattern == "" || rule.Field == "" || rule.Value == "" {
+			return fmt.Errorf("%w: rule %d", ErrClassifierRuleInvalid, i)
+		}
+	}
+
+	owner, err := dataModelOwner(params)
+	if err != nil {
+		return err
+	}
+
+	dataModel, err := GetDataModel(ctx, adpService, owner)
+	if err != nil {
+		return err
+	}
+
+	fieldProperties, err := Call(ctx, "GetFieldProperties", Bind(adpService.GetFieldProperties, dataModel))
+	if err != nil {
+		return err
+	}
+
+	for _, rule := range params.Rules {
+		if _, ok := fieldProperties[rule.Field]; !ok {
+			return fmt.Errorf("%w: %s is not a field of %s", ErrUnknownField, rule.Field, owner)
+		}
+	}
+	return nil
+}
+
+// dataModelOwner returns the entity the data model of the ingestion is
+// related to: the application, or the engine the data source is created on
+// when the request names no application.
+func dataModelOwner(params DataIngestionParams) (string, error) {
+	switch {
+	case params.Application != "":
+		return params.Application, nil
+	case params.Engine != "":
+		return params.Engine, nil
+	default:
+		return "", ErrApplicationRequired
+	}
+}
+
+// ConfigTableMaps returns the changes to the config tables of the data source
+// that point it at the path and replace its classifier rules.
+func ConfigTableMaps(params DataIngestionParams) []adp.ConfigTableMapsArg {
+	configs := []adp.ConfigTableMapsArg{
+		// Update crawl seed URI with the provided path
+		{
+			Action:       "Update",
+			Column:       "0",
+			Row:          0,
+			Substitution: "",
+			TableName:    "crawlSeedURIs",
+			Value:        params.Path,
+		},
+		// Remove any auto-created entries to start with clean mapping
+		{
+			Action:       "Remove",
+			Column:       "0",
+			Row:          0,
+			Substitution: "",
+			TableName:    "crawlLocationClassifierRules",
+			Value:        "*",
+		},
+	}
+
+	// Helper function to create classifier rule entries
+	addClassifierRule := func(row int, pattern, value, field string) {
+		configs = append(configs,
+			adp.ConfigTableMapsArg{
+				Action:       "Append",
+				Column:       "0",
+				Substitution: "",
+				TableName:    "crawlLocationClassifierRules",
+				Value:        pattern,
+			},
+			adp.ConfigTableMapsArg{
+				Action:       "Update",
+				Column:       "1",
+				Row:          row,
+				Substitution: "",
+				TableName:    "crawlLocationClassifierRules",
+				Value:        value,
+			},
+			adp.ConfigTableMapsArg{
+				Action:       "Update",
+				Column:       "2",
+				Row:          row,
+				Substitution: "",
+				TableName:    "crawlLocationClassifierRules",
+				Value:        field,
+			},
+		)
+	}
+
+	for i, rule := range ClassifierRules(params) {
+		addClassifierRule(i, rule.Pattern, rule.Value, rule.Field)
+	}
+
+	return configs
+}
+
+func configDataSourceOptions(params DataIngestionParams) []func(*adp.ConfigureDataSourceConfiguration) {
+	configs := ConfigTableMaps(params)
+
+	log.Debug().Msgf("configTableMaps: %+v", configs)
+
+	return []func(*adp.ConfigureDataSourceConfiguration){
+		adp.WithConfigureDataSourceNames(params.Datasource),
+		adp.WithConfigureDataSourceMetaDataMappingToConfigTables(configs),
+	}
+}
+
+func startDataSourceOptions(params DataIngestionParams) []func(*adp.StartDataSourceConfiguration) {
+	opts := []func(*adp.StartDataSourceConfiguration){
+		adp.WithStartDataSourceDataSourceName(params.Datasource),
+		adp.WithStartDataSourceSynchronous(false),
+	}
+	return opts
+}
+
+// SubmitIngestionData creates the data source from its template, points it at
+// the path with the custodian, source and batch classifier rules and the rules
+// of params, which are validated first, and starts it without waiting for the
+// crawl to finish. The steps are checkpointed, so
+// submitting a data source whose submission failed or was stopped by the
+// shutdown continues with the step that did not finish.
+func (s *Service) SubmitIngestionData(ctx context.Context, adpService *adp.Service, params DataIngestionParams) (err error) {
+	defer func() {
+		switch {
+		case err == nil:
+			metrics.ObserveIngestion("submitted")
+		case errors.Is(err, ErrDataSourceExists):
+			metrics.ObserveIngestion("exists")
+		default:
+			metrics.ObserveIngestion("failed")
+		}
+	}()
+
+	if err := ValidateClassifierRules(ctx, adpService, params); err != nil {
+		return err
+	}
+
+	dataSource := DataSourceID(params.Datasource)
+	key := recordKey(ctx, dataSource)
+
+	rec := &IngestionRecord{
+		DataSource:  dataSource,
+		Backend:     backendOf(ctx),
+		Application: params.Application,
+		Engine:      params.Engine,
+		Template:    params.Template,
+		Path:        params.Path,
+		Rules:       ClassifierRules(params),
+		SubmittedAt: time.Now(),
+	}
+
+	return s.RunSteps(ctx, "ingestion", key, params, []OperationStep{
+		{"checkDataSource", func(ctx context.Context) error {
+			opts := []func(*adp.ListEntitiesConfiguration){
+				adp.WithListEntitiesID(dataSource),
+			}
+
+			dataSources, err := Call(ctx, "ListEntities", BindV(adpService.ListEntities, opts...))
+			if err != nil {
+				logging.Ctx(ctx).Error().Err(err).Msg("failed to check datasource exists")
+				return err
+			}
+
+			if len(dataSources) > 0 {
+				logging.Ctx(ctx).Error().Msgf("datasource %s already exist", dataSource)
+				return fmt.Errorf("%w: %s", ErrDataSourceExists, dataSource)
+			}
+			return nil
+		}},
+		{"createDataSource", func(ctx context.Context) error {
+			createDataSourceOpts := createDataSourceOptions(params)
+			// a create that timed out may still have created the data source,
+			// so it is only retried while the data source does not exist
+			exists := func() (bool, error) {
+				dataSources, err := Call(ctx, "ListEntities", BindV(adpService.ListEntities, adp.WithListEntitiesID(dataSource)))
+				return len(dataSources) > 0, err
+			}
+			if err := ExecGuarded(ctx, "CreateDataSource", func() error { return adpService.CreateDataSource(createDataSourceOpts...) }, exists); err != nil {
+				logging.Ctx(ctx).Error().Err(err).Msg("failed to create datasource")
+				return err
+			}
+			return nil
+		}},
+		{"configureDataSource", func(ctx context.Context) error {
+			configDataSourceOpts := configDataSourceOptions(params)
+			if err := Exec(ctx, "ConfigureDataSource", func() error { return adpService.ConfigureDataSource(configDataSourceOpts...) }); err != nil {
+				logging.Ctx(ctx).Error().Err(err).Msg("failed to configure datasource")
+				return err
+			}
+
+			// the classifier rules are reported with the status of the data source
+			if err := s.ingestions.save(key, rec); err != nil {
+				logging.Ctx(ctx).Error().Err(err).Msgf("failed to record ingestion of %s", dataSource)
+			}
+			return nil
+		}},
+		{"startDataSource", func(ctx context.Context) error {
+			startDataSourceOpts := startDataSourceOptions(params)
+			if err := Exec(ctx, "StartDataSource", func() error { return adpService.StartDataSource(startDataSourceOpts...) }); err != nil {
+				logging.Ctx(ctx).Error().Err(err).Msg("failed to start datasource")
+				return err
+			}
+
+			// a resumed submission has the record of the run that configured it
+			if saved, err := s.ingestions.load(key); err == nil && saved != nil {
+				rec = saved
+			}
+			startedAt := time.Now()
+			rec.StartedAt = &startedAt
+			if err := s.ingestions.save(key, rec); err != nil {
+				logging.Ctx(ctx).Error().Err(err).Msgf("failed to record start of %s", dataSource)
+			}
+			return nil
+		}},
+	})
+}
@@ -0,0 +1,32 @@
+package service
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestDataModelOwner(t *testing.T) {
+	tests := []struct {
+		name    string
+		params  DataIngestionParams
+		want    string
+		wantErr error
+	}{
+		{"application", DataIngestionParams{Application: "documentHold.1"}, "documentHold.1", nil},
+		{"application before engine", DataIngestionParams{Application: "documentHold.1", Engine: "singleMindServer.1"}, "documentHold.1", nil},
+		{"engine only", DataIngestionParams{Engine: "singleMindServer.1"}, "singleMindServer.1", nil},
+		{"neither", DataIngestionParams{}, "", ErrApplicationRequired},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := dataModelOwner(tt.params)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("dataModelOwner() error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("dataModelOwner() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
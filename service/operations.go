@@ -0,0 +1,319 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/xifanyan/ediscovery-data-service/logging"
+	"github.com/xifanyan/ediscovery-data-service/tracing"
+)
+
+const defaultCheckpoints = "checkpoints"
+
+// OperationStep is one ADP call, or group of calls, of a multi-step operation.
+type OperationStep struct {
+	Name string
+	Fn   func(ctx context.Context) error
+}
+
+// Checkpoint records the finished steps of a multi-step operation that did
+// not complete, so running the same operation again continues after them.
+// Fingerprint identifies the parameters and ADP backend the steps ran with.
+type Checkpoint struct {
+	Operation   string    `json:"operation"`
+	Key         string    `json:"key"`
+	Fingerprint string    `json:"fingerprint,omitempty"`
+	Done        []string  `json:"done"`
+	Interrupted bool      `json:"interrupted,omitempty"`
+	Error       string    `json:"error,omitempty"`
+	StartedAt   time.Time `json:"startedAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+func (cp *Checkpoint) done(step string) bool {
+	for _, name := range cp.Done {
+		if name == step {
+			return true
+		}
+	}
+	return false
+}
+
+// operations tracks the running multi-step operations, so the shutdown can
+// wait for them and stop them between two steps.
+type operations struct {
+	dir string
+
+	mu      sync.Mutex
+	running sync.WaitGroup
+	active  map[string]struct{}
+
+	draining atomic.Bool
+
+	stopping chan struct{}
+	stopOnce sync.Once
+}
+
+func newOperations(dir string) *operations {
+	if dir == "" {
+		dir = defaultCheckpoints
+	}
+	return &operations{dir: dir, active: make(map[string]struct{}), stopping: make(chan struct{})}
+}
+
+// BeginOperation registers a multi-step operation that runs outside of
+// RunSteps, e.g. a provisioning run. It fails once the operations are being
+// stopped.
+func (s *Service) BeginOperation() (end func(), err error) {
+	ops := s.operations
+	ops.mu.Lock()
+	defer ops.mu.Unlock()
+
+	if s.Stopping() {
+		return nil, ErrShuttingDown
+	}
+
+	ops.running.Add(1)
+	return ops.running.Done, nil
+}
+
+// Drain marks the service as shutting down, so it reports not ready while the
+// requests in flight finish.
+func (s *Service) Drain() {
+	s.operations.draining.Store(true)
+}
+
+// Stopping reports whether the running operations should stop at their next
+// step.
+func (s *Service) Stopping() bool {
+	select {
+	case <-s.operations.stopping:
+		return true
+	default:
+		return false
+	}
+}
+
+// StopOperations asks the running operations to stop before their next step
+// and waits for them until ctx is done.
+func (s *Service) StopOperations(ctx context.Context) error {
+	ops := s.operations
+	ops.mu.Lock()
+	ops.stopOnce.Do(func() { close(ops.stopping) })
+	ops.mu.Unlock()
+
+	return s.WaitOperations(ctx)
+}
+
+// WaitOperations waits until no operation is running or ctx is done.
+func (s *Service) WaitOperations(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		s.operations.running.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// RunSteps runs the steps of the operation identified by key in order. The
+// finished steps are checkpointed after every step; when the operation fails
+// or is stopped by the shutdown, running it again with the same key skips
+// them. Running it again with other params, or on another ADP backend, fails
+// with ErrCheckpointMismatch, as the finished steps did something else. The
+// checkpoint is removed when all steps are done.
+func (s *Service) RunSteps(ctx context.Context, operation string, key string, params interface{}, steps []OperationStep) error {
+	fingerprint, err := fingerprintOf(backendOf(ctx), params)
+	if err != nil {
+		return err
+	}
+
+	end, err := s.BeginOperation()
+	if err != nil {
+		return err
+	}
+	defer end()
+
+	// one run at a time per key, so two runs do not repeat each other's steps
+	path := s.operations.path(operation, key)
+	s.operations.mu.Lock()
+	if _, ok := s.operations.active[path]; ok {
+		s.operations.mu.Unlock()
+		return fmt.Errorf("%w: %s %s", ErrOperationInProgress, operation, key)
+	}
+	s.operations.active[path] = struct{}{}
+	s.operations.mu.Unlock()
+
+	defer func() {
+		s.operations.mu.Lock()
+		delete(s.operations.active, path)
+		s.operations.mu.Unlock()
+	}()
+
+	cp, err := s.operations.load(operation, key)
+	if err != nil {
+		return err
+	}
+
+	// checkpoints saved before they had a fingerprint are resumed as before
+	if cp.Fingerprint != "" && cp.Fingerprint != fingerprint {
+		return fmt.Errorf("%w: %s %s finished %v with other parameters", ErrCheckpointMismatch, operation, key, cp.Done)
+	}
+	cp.Fingerprint = fingerprint
+
+	if len(cp.Done) > 0 {
+		logging.Ctx(ctx).Info().Msgf("%s %s: resuming after %v", operation, key, cp.Done)
+	}
+
+	for _, step := range steps {
+		if cp.done(step.Name) {
+			continue
+		}
+
+		if s.Stopping() {
+			cp.Interrupted = true
+			if err := s.operations.save(cp); err != nil {
+				return err
+			}
+			logging.Ctx(ctx).Warn().Msgf("%s %s: stopped before %s for shutdown", operation, key, step.Name)
+			return fmt.Errorf("%w: %s %s stopped before %s", ErrShuttingDown, operation, key, step.Name)
+		}
+
+		if err := tracing.Step(ctx, operation+"."+step.Name, step.Fn); err != nil {
+			cp.Error = err.Error()
+			if len(cp.Done) > 0 {
+				if saveErr := s.operations.save(cp); saveErr != nil {
+					logging.Ctx(ctx).Error().Err(saveErr).Msgf("%s %s: failed to save checkpoint", operation, key)
+				}
+			}
+			return err
+		}
+
+		cp.Done = append(cp.Done, step.Name)
+		cp.Interrupted = false
+		cp.Error = ""
+		if err := s.operations.save(cp); err != nil {
+			return err
+		}
+	}
+
+	return s.operations.remove(cp)
+}
+
+// Checkpoints lists the operations that did not complete.
+func (s *Service) Checkpoints() ([]Checkpoint, error) {
+	entries, err := os.ReadDir(s.operations.dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return []Checkpoint{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	res := []Checkpoint{}
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+
+		b, err := os.ReadFile(filepath.Join(s.operations.dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		var cp Checkpoint
+		if err := json.Unmarshal(b, &cp); err != nil {
+			return nil, fmt.Errorf("invalid checkpoint %s: %v", entry.Name(), err)
+		}
+		res = append(res, cp)
+	}
+
+	return res, nil
+}
+
+// fingerprintOf returns the hex SHA-256 of the backend and the JSON of params.
+func fingerprintOf(backend string, params interface{}) (string, error) {
+	b, err := json.Marshal(params)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(append([]byte(backend+"\x00"), b...))
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// path names the checkpoint file after a hash of operation and key, as keys
+// are data source names or user names.
+func (ops *operations) path(operation string, key string) string {
+	sum := sha256.Sum256([]byte(operation + "\x00" + key))
+	return filepath.Join(ops.dir, operation+"-"+hex.EncodeToString(sum[:8])+".json")
+}
+
+func (ops *operations) load(operation string, key string) (*Checkpoint, error) {
+	b, err := os.ReadFile(ops.path(operation, key))
+	if errors.Is(err, os.ErrNotExist) {
+		return &Checkpoint{Operation: operation, Key: key, Done: []string{}, StartedAt: time.Now()}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var cp Checkpoint
+	if err := json.Unmarshal(b, &cp); err != nil {
+		return nil, fmt.Errorf("invalid checkpoint of %s %s: %v", operation, key, err)
+	}
+	return &cp, nil
+}
+
+// pending returns the checkpoint of the operation with key, if it did not
+// complete.
+func (ops *operations) pending(operation string, key string) (*Checkpoint, bool) {
+	if _, err := os.Stat(ops.path(operation, key)); err != nil {
+		return nil, false
+	}
+	cp, err := ops.load(operation, key)
+	if err != nil {
+		return nil, false
+	}
+	return cp, true
+}
+
+func (ops *operations) save(cp *Checkpoint) error {
+	cp.UpdatedAt = time.Now()
+
+	if err := os.MkdirAll(ops.dir, os.ModePerm); err != nil {
+		return fmt.Errorf("failed to create checkpoints directory: %v", err)
+	}
+
+	b, err := json.MarshalIndent(cp, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	path := ops.path(cp.Operation, cp.Key)
+	if err := os.WriteFile(path+".tmp", b, 0664); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+func (ops *operations) remove(cp *Checkpoint) error {
+	err := os.Remove(ops.path(cp.Operation, cp.Key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
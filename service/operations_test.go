@@ -0,0 +1,57 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestRunStepsResume(t *testing.T) {
+	s := &Service{operations: newOperations(t.TempDir())}
+	ctx := context.Background()
+	failed := errors.New("ADP failed")
+
+	var ran []string
+	steps := func(failAt string) []OperationStep {
+		step := func(name string) OperationStep {
+			return OperationStep{Name: name, Fn: func(context.Context) error {
+				if name == failAt {
+					return failed
+				}
+				ran = append(ran, name)
+				return nil
+			}}
+		}
+		return []OperationStep{step("create"), step("configure"), step("start")}
+	}
+
+	params := map[string]string{"path": `E:\Datasource\1`}
+	if err := s.RunSteps(ctx, "ingestion", "dataSource.a", params, steps("configure")); !errors.Is(err, failed) {
+		t.Fatalf("first run = %v, want %v", err, failed)
+	}
+
+	other := map[string]string{"path": `E:\Datasource\2`}
+	if err := s.RunSteps(ctx, "ingestion", "dataSource.a", other, steps("")); !errors.Is(err, ErrCheckpointMismatch) {
+		t.Fatalf("run with other params = %v, want %v", err, ErrCheckpointMismatch)
+	}
+	if err := s.RunSteps(WithBackend(ctx, "emea"), "ingestion", "dataSource.a", params, steps("")); !errors.Is(err, ErrCheckpointMismatch) {
+		t.Fatalf("run on another backend = %v, want %v", err, ErrCheckpointMismatch)
+	}
+
+	ran = nil
+	if err := s.RunSteps(ctx, "ingestion", "dataSource.a", params, steps("")); err != nil {
+		t.Fatalf("resume = %v", err)
+	}
+	if len(ran) != 2 || ran[0] != "configure" || ran[1] != "start" {
+		t.Errorf("resume ran %v, want [configure start]", ran)
+	}
+
+	// the checkpoint is gone, so other params start over
+	ran = nil
+	if err := s.RunSteps(ctx, "ingestion", "dataSource.a", other, steps("")); err != nil {
+		t.Fatalf("new run = %v", err)
+	}
+	if len(ran) != 3 {
+		t.Errorf("new run ran %v", ran)
+	}
+}
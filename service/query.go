@@ -0,0 +1,404 @@
+package service
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ListQuery is the paging, filtering, sorting and projection requested for a
+// list endpoint:
+//
+//	limit=50                page size, all items when not set
+//	cursor=...              position returned in X-Next-Cursor by the previous page
+//	sort=displayName,-id    sort keys, descending with a leading "-"
+//	fields=id,displayName   fields to return
+//	workspace=Workspace1    items whose field equals the value
+//	displayName~=demo       items whose field contains the value
+//
+// Field names are matched case-insensitively against the JSON fields of the
+// items. A filter on a field none of the items has is rejected with
+// ErrUnknownField, so a mistyped parameter is not answered with an empty page.
+// The parameter "_" that clients add to bypass caches is ignored.
+type ListQuery struct {
+	Limit   int
+	Offset  int
+	Sort    []SortKey
+	Fields  []string
+	Filters []Filter
+}
+
+type SortKey struct {
+	Field      string
+	Descending bool
+}
+
+type Filter struct {
+	Field    string
+	Value    string
+	Contains bool
+}
+
+// ListPage is one page of a list after applying a ListQuery.
+type ListPage struct {
+	Items      interface{}
+	Total      int
+	NextCursor string
+}
+
+var listQueryParams = map[string]struct{}{
+	"limit":  {},
+	"cursor": {},
+	"sort":   {},
+	"fields": {},
+	"_":      {},
+}
+
+// ParseListQuery reads a ListQuery from query parameters. Parameters in
+// reserved are consumed by the endpoint itself and are not used as filters.
+func ParseListQuery(values url.Values, reserved ...string) (ListQuery, error) {
+	var q ListQuery
+
+	skip := make(map[string]struct{}, len(reserved))
+	for _, r := range reserved {
+		skip[r] = struct{}{}
+	}
+
+	if v := values.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 0 {
+			return q, fmt.Errorf("invalid limit %q", v)
+		}
+		q.Limit = limit
+	}
+
+	if v := values.Get("cursor"); v != "" {
+		offset, err := decodeCursor(v)
+		if err != nil {
+			return q, err
+		}
+		q.Offset = offset
+	}
+
+	for _, field := range splitList(values.Get("sort")) {
+		key := SortKey{Field: field}
+		if strings.HasPrefix(field, "-") {
+			key = SortKey{Field: field[1:], Descending: true}
+		}
+		q.Sort = append(q.Sort, key)
+	}
+
+	q.Fields = splitList(values.Get("fields"))
+
+	for name, vs := range values {
+		if _, ok := listQueryParams[name]; ok {
+			continue
+		}
+		if _, ok := skip[name]; ok {
+			continue
+		}
+
+		// "displayName~=demo" arrives as parameter "displayName~"
+		field, contains := strings.CutSuffix(name, "~")
+		for _, v := range vs {
+			q.Filters = append(q.Filters, Filter{Field: field, Value: v, Contains: contains})
+		}
+	}
+
+	return q, nil
+}
+
+func splitList(s string) []string {
+	var res []string
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			res = append(res, part)
+		}
+	}
+	return res
+}
+
+func encodeCursor(offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte("o:" + strconv.Itoa(offset)))
+}
+
+func decodeCursor(cursor string) (int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err == nil {
+		if v, ok := strings.CutPrefix(string(b), "o:"); ok {
+			if offset, err := strconv.Atoi(v); err == nil && offset >= 0 {
+				return offset, nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("invalid cursor %q", cursor)
+}
+
+// Apply filters, sorts, pages and projects the items, which are anything that
+// marshals to a JSON array or object. An object is treated as a list of its
+// entries ordered by key, which sort can name as "key". It is returned as
+// object again, unless sort is given: a JSON object has no order, so a sorted
+// object is returned as array of its entries, each with its key in the field
+// "key" unless the entry has a field of that name.
+func (q ListQuery) Apply(items interface{}) (ListPage, error) {
+	keys, list, err := listEntries(items)
+	if err != nil {
+		return ListPage{}, err
+	}
+
+	// remember the object key of every entry through filtering and sorting
+	type entry struct {
+		key  string
+		item map[string]interface{}
+	}
+
+	if err := q.checkFilters(list, keys != nil); err != nil {
+		return ListPage{}, err
+	}
+
+	// the object key is a field to filter and sort by
+	value := func(e entry, name string) (interface{}, bool) {
+		if v, ok := lookupField(e.item, name); ok || keys == nil || !strings.EqualFold(name, "key") {
+			return v, ok
+		}
+		return e.key, true
+	}
+
+	entries := make([]entry, 0, len(list))
+	for i, item := range list {
+		e := entry{item: item}
+		if keys != nil {
+			e.key = keys[i]
+		}
+		if !q.matches(func(name string) (interface{}, bool) { return value(e, name) }) {
+			continue
+		}
+		entries = append(entries, e)
+	}
+
+	if len(q.Sort) > 0 {
+		sort.SliceStable(entries, func(i, j int) bool {
+			for _, key := range q.Sort {
+				a, _ := value(entries[i], key.Field)
+				b, _ := value(entries[j], key.Field)
+				c := compareValues(a, b)
+				if c == 0 {
+					continue
+				}
+				// missing values stay last in either direction
+				if key.Descending && a != nil && b != nil {
+					return c > 0
+				}
+				return c < 0
+			}
+			return false
+		})
+	}
+
+	page := ListPage{Total: len(entries)}
+
+	start := min(q.Offset, len(entries))
+	end := len(entries)
+	if q.Limit > 0 && start+q.Limit < end {
+		end = start + q.Limit
+		page.NextCursor = encodeCursor(end)
+	}
+	entries = entries[start:end]
+
+	if keys != nil && len(q.Sort) == 0 {
+		obj := make(map[string]interface{}, len(entries))
+		for _, e := range entries {
+			obj[e.key] = q.project(e.item)
+		}
+		page.Items = obj
+		return page, nil
+	}
+
+	res := make([]interface{}, 0, len(entries))
+	for _, e := range entries {
+		item := q.project(e.item)
+		if keys != nil {
+			if _, ok := lookupField(e.item, "key"); !ok {
+				item["key"] = e.key
+			}
+		}
+		res = append(res, item)
+	}
+	page.Items = res
+
+	return page, nil
+}
+
+// listEntries returns the entries of a listing that marshals to a JSON array,
+// or to an object along with its keys, sorted.
+func listEntries(items interface{}) ([]string, []map[string]interface{}, error) {
+	js, err := json.Marshal(items)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var keys []string
+	var list []map[string]interface{}
+
+	if trimmed := strings.TrimSpace(string(js)); strings.HasPrefix(trimmed, "{") {
+		var obj map[string]map[string]interface{}
+		if err := json.Unmarshal(js, &obj); err != nil {
+			return nil, nil, fmt.Errorf("unexpected listing: %v", err)
+		}
+		for k := range obj {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			list = append(list, obj[k])
+		}
+	} else if trimmed != "null" {
+		if err := json.Unmarshal(js, &list); err != nil {
+			return nil, nil, fmt.Errorf("unexpected listing: %v", err)
+		}
+	}
+
+	return keys, list, nil
+}
+
+// checkFilters returns ErrUnknownField for a filter on a field that none of
+// the items has, naming the fields there are. Without items every filter
+// matches nothing anyway.
+func (q ListQuery) checkFilters(list []map[string]interface{}, keyed bool) error {
+	if len(list) == 0 {
+		return nil
+	}
+
+	known := make(map[string]string)
+	if keyed {
+		known["key"] = "key"
+	}
+	for _, item := range list {
+		for k := range item {
+			known[strings.ToLower(k)] = k
+		}
+	}
+
+	for _, f := range q.Filters {
+		if _, ok := known[strings.ToLower(f.Field)]; ok {
+			continue
+		}
+		fields := make([]string, 0, len(known))
+		for _, k := range known {
+			fields = append(fields, k)
+		}
+		sort.Strings(fields)
+		return fmt.Errorf("%w: cannot filter by %q, the items have the fields %s", ErrUnknownField, f.Field, strings.Join(fields, ", "))
+	}
+	return nil
+}
+
+// matches reports whether the item, whose fields are looked up by field, passes
+// all filters. An item without a filtered field does not.
+func (q ListQuery) matches(field func(name string) (interface{}, bool)) bool {
+	for _, f := range q.Filters {
+		v, ok := field(f.Field)
+		if !ok {
+			return false
+		}
+
+		s := strings.ToLower(formatValue(v))
+		want := strings.ToLower(f.Value)
+		if f.Contains {
+			if !strings.Contains(s, want) {
+				return false
+			}
+		} else if s != want {
+			return false
+		}
+	}
+	return true
+}
+
+func (q ListQuery) project(item map[string]interface{}) map[string]interface{} {
+	if len(q.Fields) == 0 {
+		return item
+	}
+
+	res := make(map[string]interface{}, len(q.Fields))
+	for _, name := range q.Fields {
+		for k, v := range item {
+			if strings.EqualFold(k, name) {
+				res[k] = v
+			}
+		}
+	}
+	return res
+}
+
+// lookupField finds a field by exact name first and case-insensitively after.
+func lookupField(item map[string]interface{}, name string) (interface{}, bool) {
+	if v, ok := item[name]; ok {
+		return v, true
+	}
+	for k, v := range item {
+		if strings.EqualFold(k, name) {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+func formatValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		js, _ := json.Marshal(v)
+		return string(js)
+	}
+}
+
+// compareValues orders missing values last, numbers numerically, booleans
+// false before true and everything else as case-insensitive text.
+func compareValues(a, b interface{}) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return 1
+	case b == nil:
+		return -1
+	}
+
+	if x, ok := a.(float64); ok {
+		if y, ok := b.(float64); ok {
+			switch {
+			case x < y:
+				return -1
+			case x > y:
+				return 1
+			}
+			return 0
+		}
+	}
+
+	if x, ok := a.(bool); ok {
+		if y, ok := b.(bool); ok {
+			switch {
+			case x == y:
+				return 0
+			case !x:
+				return -1
+			}
+			return 1
+		}
+	}
+
+	return strings.Compare(strings.ToLower(formatValue(a)), strings.ToLower(formatValue(b)))
+}
@@ -0,0 +1,198 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"net/url"
+	"testing"
+)
+
+func TestListQueryApply(t *testing.T) {
+	list := []map[string]interface{}{
+		{"id": "documentHold.b", "displayName": "Beta", "size": 20},
+		{"id": "documentHold.a", "displayName": "alpha demo", "size": 3},
+		{"id": "documentHold.c", "displayName": "Gamma demo"},
+	}
+	keyed := map[string]map[string]interface{}{
+		"jane": {"name": "Jane", "age": 41},
+		"bob":  {"name": "Bob", "age": 29},
+		"ann":  {"name": "Ann", "age": 35},
+	}
+
+	tests := []struct {
+		name       string
+		items      interface{}
+		query      string
+		want       string
+		wantTotal  int
+		wantCursor bool
+	}{
+		{
+			name:      "no query",
+			items:     list,
+			want:      `[{"displayName":"Beta","id":"documentHold.b","size":20},{"displayName":"alpha demo","id":"documentHold.a","size":3},{"displayName":"Gamma demo","id":"documentHold.c"}]`,
+			wantTotal: 3,
+		},
+		{
+			name:      "sort is case-insensitive text",
+			items:     list,
+			query:     "sort=displayName&fields=id",
+			want:      `[{"id":"documentHold.a"},{"id":"documentHold.b"},{"id":"documentHold.c"}]`,
+			wantTotal: 3,
+		},
+		{
+			name:      "numbers descending, missing last",
+			items:     list,
+			query:     "sort=-size&fields=id",
+			want:      `[{"id":"documentHold.b"},{"id":"documentHold.a"},{"id":"documentHold.c"}]`,
+			wantTotal: 3,
+		},
+		{
+			name:      "contains filter",
+			items:     list,
+			query:     "displayName~=DEMO&fields=id",
+			want:      `[{"id":"documentHold.a"},{"id":"documentHold.c"}]`,
+			wantTotal: 2,
+		},
+		{
+			name:       "first page",
+			items:      list,
+			query:      "limit=2&fields=id",
+			want:       `[{"id":"documentHold.b"},{"id":"documentHold.a"}]`,
+			wantTotal:  3,
+			wantCursor: true,
+		},
+		{
+			name:      "second page",
+			items:     list,
+			query:     "limit=2&fields=id&cursor=" + encodeCursor(2),
+			want:      `[{"id":"documentHold.c"}]`,
+			wantTotal: 3,
+		},
+		{
+			name:      "object stays an object",
+			items:     keyed,
+			query:     "name~=n",
+			want:      `{"ann":{"age":35,"name":"Ann"},"jane":{"age":41,"name":"Jane"}}`,
+			wantTotal: 2,
+		},
+		{
+			name:       "object is paged by key",
+			items:      keyed,
+			query:      "limit=2",
+			want:       `{"ann":{"age":35,"name":"Ann"},"bob":{"age":29,"name":"Bob"}}`,
+			wantTotal:  3,
+			wantCursor: true,
+		},
+		{
+			name:      "sorted object is an array with the key",
+			items:     keyed,
+			query:     "sort=-age&fields=age",
+			want:      `[{"age":41,"key":"jane"},{"age":35,"key":"ann"},{"age":29,"key":"bob"}]`,
+			wantTotal: 3,
+		},
+		{
+			name:       "sorted by key",
+			items:      keyed,
+			query:      "sort=-key&limit=2&fields=name",
+			want:       `[{"key":"jane","name":"Jane"},{"key":"bob","name":"Bob"}]`,
+			wantTotal:  3,
+			wantCursor: true,
+		},
+		{
+			name:      "filter by key",
+			items:     keyed,
+			query:     "key=bob",
+			want:      `{"bob":{"age":29,"name":"Bob"}}`,
+			wantTotal: 1,
+		},
+		{
+			name:       "cache buster is ignored",
+			items:      list,
+			query:      "_=1729330000&fields=id&limit=1",
+			want:       `[{"id":"documentHold.b"}]`,
+			wantTotal:  3,
+			wantCursor: true,
+		},
+		{
+			name:      "filter on a field some items lack",
+			items:     list,
+			query:     "size=3&fields=id",
+			want:      `[{"id":"documentHold.a"}]`,
+			wantTotal: 1,
+		},
+		{
+			name:      "null",
+			items:     nil,
+			want:      `[]`,
+			wantTotal: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values, err := url.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			q, err := ParseListQuery(values)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			page, err := q.Apply(tt.items)
+			if err != nil {
+				t.Fatalf("Apply() error = %v", err)
+			}
+
+			got, err := json.Marshal(page.Items)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("Apply() = %s, want %s", got, tt.want)
+			}
+			if page.Total != tt.wantTotal {
+				t.Errorf("Total = %d, want %d", page.Total, tt.wantTotal)
+			}
+			if (page.NextCursor != "") != tt.wantCursor {
+				t.Errorf("NextCursor = %q", page.NextCursor)
+			}
+		})
+	}
+}
+
+func TestParseListQueryErrors(t *testing.T) {
+	for _, query := range []string{"limit=-1", "limit=ten", "cursor=abc", "cursor=" + encodeCursor(-1)} {
+		values, _ := url.ParseQuery(query)
+		if _, err := ParseListQuery(values); err == nil {
+			t.Errorf("ParseListQuery(%q) succeeded", query)
+		}
+	}
+}
+
+func TestListQueryUnknownFilter(t *testing.T) {
+	list := []map[string]interface{}{{"id": "documentHold.a", "displayName": "Alpha"}}
+
+	tests := []struct {
+		query   string
+		wantErr bool
+	}{
+		{"displayname=Alpha", false},
+		{"workspace=Workspace1", true},
+		{"nmae~=a", true},
+	}
+
+	for _, tt := range tests {
+		values, _ := url.ParseQuery(tt.query)
+		q, err := ParseListQuery(values)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = q.Apply(list)
+		if got := errors.Is(err, ErrUnknownField); got != tt.wantErr {
+			t.Errorf("Apply(%q) error = %v, want unknown field %v", tt.query, err, tt.wantErr)
+		}
+	}
+}
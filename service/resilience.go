@@ -0,0 +1,318 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"regexp"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/xifanyan/ediscovery-data-service/config"
+	"github.com/xifanyan/ediscovery-data-service/metrics"
+	"github.com/xifanyan/ediscovery-data-service/ratelimit"
+)
+
+const (
+	defaultCallTimeout     = 60 * time.Second
+	defaultBackoff         = 200 * time.Millisecond
+	defaultMaxBackoff      = 5 * time.Second
+	defaultBreakerCooldown = 30 * time.Second
+)
+
+// idempotentWrites are the ADP writes that can be repeated without changing
+// the outcome, so they are retried like reads.
+var idempotentWrites = map[string]struct{}{
+	"CreateOrUpdateCategory": {},
+}
+
+// transientStatus matches the HTTP statuses of an ADP node that is
+// restarting or overloaded in the error messages of the ADP client.
+var transientStatus = regexp.MustCompile(`\b50[234]\b`)
+
+// UnavailableError is returned without calling ADP while the circuit breaker
+// of the backend is open.
+type UnavailableError struct {
+	Backend    string
+	RetryAfter time.Duration
+}
+
+func (e *UnavailableError) Error() string {
+	return fmt.Sprintf("%v: ADP backend %s failed repeatedly, retry in %s", ErrADPUnavailable, e.Backend, e.RetryAfter.Round(time.Second))
+}
+
+func (e *UnavailableError) Unwrap() error {
+	return ErrADPUnavailable
+}
+
+// resilience holds the timeouts, retry policy and circuit breakers of the
+// ADP calls, set from the resilience section of the config.
+type resilience struct {
+	mu sync.Mutex
+
+	timeout    time.Duration
+	timeouts   map[string]time.Duration
+	retries    int
+	backoff    time.Duration
+	maxBackoff time.Duration
+	failures   int
+	cooldown   time.Duration
+
+	breakers map[string]*breaker
+
+	// caps limit the concurrent calls of ADP operations
+	caps *ratelimit.Caps
+}
+
+var policy = &resilience{
+	timeout:    defaultCallTimeout,
+	backoff:    defaultBackoff,
+	maxBackoff: defaultMaxBackoff,
+	cooldown:   defaultBreakerCooldown,
+	breakers:   make(map[string]*breaker),
+}
+
+// configureResilience applies the resilience section of the config and the
+// caps of limits.concurrency to the ADP calls. Retries and the circuit
+// breakers are off unless configured.
+func configureResilience(cfg config.Config, caps *ratelimit.Caps) {
+	r := cfg.Resilience
+
+	timeouts := make(map[string]time.Duration, len(r.Timeouts))
+	for op, timeout := range r.Timeouts {
+		timeouts[op] = parseDurationOr(timeout, defaultCallTimeout)
+	}
+
+	policy.mu.Lock()
+	defer policy.mu.Unlock()
+
+	policy.timeout = parseDurationOr(r.Timeout, defaultCallTimeout)
+	policy.timeouts = timeouts
+	policy.retries = max(r.Retries, 0)
+	policy.backoff = parseDurationOr(r.Backoff, defaultBackoff)
+	policy.maxBackoff = parseDurationOr(r.MaxBackoff, defaultMaxBackoff)
+	policy.failures = max(r.BreakerFailures, 0)
+	policy.cooldown = parseDurationOr(r.BreakerCooldown, defaultBreakerCooldown)
+	policy.caps = caps
+}
+
+func (r *resilience) capsOf() *ratelimit.Caps {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.caps
+}
+
+func (r *resilience) timeoutOf(operation string) time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if timeout, ok := r.timeouts[operation]; ok {
+		return timeout
+	}
+	return r.timeout
+}
+
+// retriesOf is the number of retries of the operation: reads and idempotent
+// writes are retried, other writes only when guarded.
+func (r *resilience) retriesOf(operation string, guarded bool) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if guarded || isRead(operation) {
+		return r.retries
+	}
+	if _, ok := idempotentWrites[operation]; ok {
+		return r.retries
+	}
+	return 0
+}
+
+// wait sleeps the jittered exponential backoff before retry attempt, or until
+// ctx is done.
+func (r *resilience) wait(ctx context.Context, attempt int) error {
+	r.mu.Lock()
+	backoff := r.backoff << attempt
+	if backoff <= 0 || backoff > r.maxBackoff {
+		backoff = r.maxBackoff
+	}
+	r.mu.Unlock()
+
+	// full jitter, so clients retrying together spread out
+	timer := time.NewTimer(rand.N(backoff) + 1)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (r *resilience) breaker(backend string) *breaker {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	b, ok := r.breakers[backend]
+	if !ok {
+		b = &breaker{backend: backend}
+		r.breakers[backend] = b
+	}
+	return b
+}
+
+func (r *resilience) limits() (int, time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.failures, r.cooldown
+}
+
+func isRead(operation string) bool {
+	for _, prefix := range []string{"List", "Get", "Find"} {
+		if strings.HasPrefix(operation, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// transient reports whether err means ADP did not answer, or answered that
+// it cannot serve the call right now, rather than rejecting the call.
+func transient(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var netErr net.Error
+	switch {
+	case errors.Is(err, ErrADPTimeout),
+		errors.As(err, &netErr),
+		errors.Is(err, io.EOF),
+		errors.Is(err, io.ErrUnexpectedEOF),
+		errors.Is(err, syscall.ECONNREFUSED),
+		errors.Is(err, syscall.ECONNRESET):
+		return true
+	}
+	return transientStatus.MatchString(err.Error())
+}
+
+// breaker opens after breakerFailures transient failures in a row of the
+// calls to an ADP backend and fails its calls fast for breakerCooldown. Then
+// one trial call is let through, which closes it again when it succeeds.
+type breaker struct {
+	backend string
+
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	trial     bool
+}
+
+// allow returns an UnavailableError while the breaker is open.
+func (b *breaker) allow() error {
+	threshold, _ := policy.limits()
+	if threshold == 0 {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.openUntil.IsZero() {
+		return nil
+	}
+	if wait := time.Until(b.openUntil); wait > 0 || b.trial {
+		return &UnavailableError{Backend: b.backend, RetryAfter: max(wait, time.Second)}
+	}
+
+	b.trial = true
+	return nil
+}
+
+// record counts the outcome of a call that was let through.
+func (b *breaker) record(err error) {
+	threshold, cooldown := policy.limits()
+	if threshold == 0 {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	wasOpen := !b.openUntil.IsZero()
+	b.trial = false
+
+	if !transient(err) {
+		b.failures = 0
+		b.openUntil = time.Time{}
+		if wasOpen {
+			metrics.SetADPCircuitOpen(b.backend, false)
+		}
+		return
+	}
+
+	b.failures++
+	if wasOpen || b.failures >= threshold {
+		b.openUntil = time.Now().Add(cooldown)
+		metrics.SetADPCircuitOpen(b.backend, true)
+	}
+}
+
+// abort lets the next call through as trial when a trial call was given up
+// on before ADP answered.
+func (b *breaker) abort() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.trial = false
+}
+
+func (b *breaker) state() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch {
+	case b.openUntil.IsZero():
+		return "closed"
+	case time.Now().Before(b.openUntil):
+		return "open"
+	default:
+		return "half-open"
+	}
+}
+
+// CircuitBreakers returns the state of the circuit breaker of every ADP
+// backend called so far: closed, open or half-open.
+func CircuitBreakers() map[string]string {
+	policy.mu.Lock()
+	breakers := make([]*breaker, 0, len(policy.breakers))
+	for _, b := range policy.breakers {
+		breakers = append(breakers, b)
+	}
+	policy.mu.Unlock()
+
+	res := make(map[string]string, len(breakers))
+	for _, b := range breakers {
+		res[b.backend] = b.state()
+	}
+	return res
+}
+
+type backendKey struct{}
+
+// WithBackend returns ctx for the ADP calls to the named backend, whose
+// circuit breaker they count towards.
+func WithBackend(ctx context.Context, backend string) context.Context {
+	return context.WithValue(ctx, backendKey{}, backend)
+}
+
+func backendOf(ctx context.Context) string {
+	if backend, ok := ctx.Value(backendKey{}).(string); ok && backend != "" {
+		return backend
+	}
+	return config.DefaultADPBackend
+}
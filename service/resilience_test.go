@@ -0,0 +1,161 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/xifanyan/ediscovery-data-service/config"
+	"github.com/xifanyan/ediscovery-data-service/ratelimit"
+)
+
+// configurePolicy applies the config to the ADP calls for the test and resets
+// them afterwards.
+func configurePolicy(t *testing.T, cfg config.Config) *ratelimit.Caps {
+	t.Helper()
+
+	caps := ratelimit.NewCaps(cfg)
+	configureResilience(cfg, caps)
+	t.Cleanup(func() {
+		configureResilience(config.Config{}, nil)
+		policy.mu.Lock()
+		policy.breakers = make(map[string]*breaker)
+		policy.mu.Unlock()
+	})
+	return caps
+}
+
+func TestTransient(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"timeout", fmt.Errorf("%w: ListEntities within 1s", ErrADPTimeout), true},
+		{"network", &net.OpError{Op: "dial", Err: errors.New("no route to host")}, true},
+		{"connection refused", fmt.Errorf("post: %w", syscall.ECONNREFUSED), true},
+		{"connection reset", fmt.Errorf("read: %w", syscall.ECONNRESET), true},
+		{"EOF", io.EOF, true},
+		{"unexpected EOF", io.ErrUnexpectedEOF, true},
+		{"bad gateway", errors.New("unexpected status 502 Bad Gateway"), true},
+		{"unavailable", errors.New("status code: 503"), true},
+		{"gateway timeout", errors.New("504"), true},
+		{"server error", errors.New("status code: 500"), false},
+		{"number containing 503", errors.New("application documentHold.15030 not found"), false},
+		{"rejected", errors.New("entity not found"), false},
+		{"canceled", context.Canceled, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := transient(tt.err); got != tt.want {
+				t.Errorf("transient(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBreaker(t *testing.T) {
+	var cfg config.Config
+	cfg.Resilience.BreakerFailures = 2
+	cfg.Resilience.BreakerCooldown = "50ms"
+	configurePolicy(t, cfg)
+
+	b := policy.breaker("test")
+	unavailable := errors.New("status code: 503")
+
+	steps := []struct {
+		name    string
+		wait    time.Duration
+		outcome error
+		allowed bool
+		state   string
+	}{
+		{"first failure", 0, unavailable, true, "closed"},
+		{"rejection resets nothing", 0, errors.New("not found"), true, "closed"},
+		{"failure", 0, unavailable, true, "closed"},
+		{"second failure in a row opens", 0, unavailable, true, "open"},
+		{"open fails fast", 0, nil, false, "open"},
+		{"trial after the cooldown fails", 60 * time.Millisecond, unavailable, true, "open"},
+		{"trial after the cooldown succeeds", 60 * time.Millisecond, nil, true, "closed"},
+	}
+
+	for _, step := range steps {
+		time.Sleep(step.wait)
+
+		err := b.allow()
+		if (err == nil) != step.allowed {
+			t.Fatalf("%s: allow() = %v", step.name, err)
+		}
+		if err == nil {
+			b.record(step.outcome)
+		} else if !errors.Is(err, ErrADPUnavailable) {
+			t.Fatalf("%s: allow() = %v, want %v", step.name, err, ErrADPUnavailable)
+		}
+		if got := b.state(); got != step.state {
+			t.Fatalf("%s: state = %s, want %s", step.name, got, step.state)
+		}
+	}
+}
+
+func TestBreakerSingleTrial(t *testing.T) {
+	var cfg config.Config
+	cfg.Resilience.BreakerFailures = 1
+	cfg.Resilience.BreakerCooldown = "10ms"
+	configurePolicy(t, cfg)
+
+	b := policy.breaker("test")
+	b.record(errors.New("status code: 503"))
+	time.Sleep(20 * time.Millisecond)
+
+	if err := b.allow(); err != nil {
+		t.Fatalf("trial call = %v", err)
+	}
+	if err := b.allow(); err == nil {
+		t.Fatal("second call during the trial was let through")
+	}
+
+	b.abort()
+	if err := b.allow(); err != nil {
+		t.Fatalf("trial call after an aborted one = %v", err)
+	}
+}
+
+func TestCallHoldsCapUntilADPAnswers(t *testing.T) {
+	var cfg config.Config
+	cfg.Resilience.Timeouts = map[string]string{"ListSlow": "20ms"}
+	cfg.Limits.Concurrency = map[string]int{"ListSlow": 1}
+	configurePolicy(t, cfg)
+
+	answer := make(chan struct{})
+	answered := make(chan struct{})
+	slow := func() (int, error) {
+		<-answer
+		defer close(answered)
+		return 1, nil
+	}
+
+	if _, err := Call(context.Background(), "ListSlow", slow); !errors.Is(err, ErrADPTimeout) {
+		t.Fatalf("first call = %v, want %v", err, ErrADPTimeout)
+	}
+
+	// ADP is still working on the first call
+	var busy *ratelimit.BusyError
+	if _, err := Call(context.Background(), "ListSlow", func() (int, error) { return 2, nil }); !errors.As(err, &busy) {
+		t.Fatalf("second call = %v, want a BusyError", err)
+	}
+
+	close(answer)
+	<-answered
+	time.Sleep(10 * time.Millisecond)
+
+	if v, err := Call(context.Background(), "ListSlow", func() (int, error) { return 3, nil }); err != nil || v != 3 {
+		t.Fatalf("call after the answer = %v, %v", v, err)
+	}
+}
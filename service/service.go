@@ -4,6 +4,7 @@ import (
 	"github.com/rs/zerolog/log"
 	"github.com/xifanyan/ediscovery-data-service/client"
 	"github.com/xifanyan/ediscovery-data-service/config"
+	"github.com/xifanyan/ediscovery-data-service/ratelimit"
 
 	"github.com/labstack/echo/v4"
 	adp "github.com/xifanyan/adp"
@@ -14,26 +15,54 @@ type Service struct {
 	cfg    config.Config
 	ADPsvc *adp.Service
 	// SWAClient *searchwebapi.Client
+
+	// decommissions signs the confirmation tokens of decommissioning
+	decommissions *decommissions
+
+	// backends are the ADP instances by name, ADPsvc is the default one
+	backends map[string]*backend
+
+	cache       *Cache
+	operations  *operations
+	idempotency *idempotency
+	caps        *ratelimit.Caps
+	ingestions  *ingestionRecords
+	taggers     *taggerRecords
 }
 
 func NewService(config config.Config) *Service {
+	decommissions, err := newDecommissions()
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to generate confirmation key")
+	}
+
+	caps := ratelimit.NewCaps(config)
+	configureResilience(config, caps)
+
+	adpService := &adp.Service{ADPClient: client.NewADPClient(config)}
+
 	return &Service{
-		cfg:    config,
-		ADPsvc: &adp.Service{ADPClient: client.NewADPClient(config)},
+		cfg:      config,
+		ADPsvc:   adpService,
+		backends: newBackends(config, adpService),
 		// SWAClient: searchwebapi.NewClient(config.SearchWebAPI.Domain, config.SearchWebAPI.Port, config.SearchWebAPI.Endpoint),
+		decommissions: decommissions,
+		cache:         NewCache(config.Cache.TTL),
+		operations:    newOperations(config.Shutdown.Checkpoints),
+		idempotency:   newIdempotency(config.Idempotency.Store, config.Idempotency.Window),
+		caps:          caps,
+		ingestions:    newIngestionRecords(config.Ingestion.Records),
+		taggers:       newTaggerRecords(config.Taggers.Records),
 	}
 }
 
-func (s *Service) ResetADPServiceWithContextCredential(c echo.Context) *adp.Service {
-	// Extract user and password from context
-	user, userOk := c.Get("adp_user").(string)
-	password, passwordOk := c.Get("adp_password").(string)
-
-	// If both credentials are provided and valid, reset them
-	if userOk && user != "" && passwordOk && password != "" {
-		log.Debug().Msgf("Resetting ADP credentials: user=%s", user)
-		s.ADPsvc.ADPClient.ResetCredentials(user, password)
-	}
+// Caps returns the caps of the concurrent requests and ADP operations.
+func (s *Service) Caps() *ratelimit.Caps {
+	return s.caps
+}
 
-	return s.ADPsvc
+// ResetADPServiceWithContextCredential returns the ADP service of the backend
+// the request was routed to, with the ADP credentials of the request.
+func (s *Service) ResetADPServiceWithContextCredential(c echo.Context) *adp.Service {
+	return s.backendService(c, backendName(c))
 }
@@ -0,0 +1,149 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/xifanyan/adp"
+
+	"github.com/xifanyan/ediscovery-data-service/logging"
+)
+
+const defaultTaggerRecords = "taggers"
+
+// TaggerRecord is a tagger the service installed into an application. ADP has
+// no call that lists the taggers of an application, so the service keeps the
+// ones it installed, by submitTagger, the tagger routes, the global search and
+// tagger import and provisioning.
+type TaggerRecord struct {
+	adp.TaggerInfo
+	Application string    `json:"application"`
+	Backend     string    `json:"backend,omitempty"`
+	InstalledAt time.Time `json:"installedAt"`
+}
+
+// taggerRecords stores the tagger records, one file per application.
+type taggerRecords struct {
+	mu  sync.Mutex
+	dir string
+}
+
+func newTaggerRecords(dir string) *taggerRecords {
+	if dir == "" {
+		dir = defaultTaggerRecords
+	}
+	return &taggerRecords{dir: dir}
+}
+
+func (r *taggerRecords) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(r.dir, hex.EncodeToString(sum[:16])+".json")
+}
+
+func (r *taggerRecords) load(key string) ([]TaggerRecord, error) {
+	b, err := os.ReadFile(r.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return []TaggerRecord{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var records []TaggerRecord
+	if err := json.Unmarshal(b, &records); err != nil {
+		return nil, fmt.Errorf("invalid tagger records of %s: %v", key, err)
+	}
+	return records, nil
+}
+
+// record adds the taggers to the records of the application, replacing the
+// ones with the same ID as installing them does in ADP.
+func (r *taggerRecords) record(key string, application string, backend string, taggers []adp.TaggerInfo) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	records, err := r.load(key)
+	if err != nil {
+		return err
+	}
+
+	byID := make(map[string]int, len(records))
+	for i, rec := range records {
+		byID[rec.ID] = i
+	}
+
+	now := time.Now()
+	for _, tagger := range taggers {
+		rec := TaggerRecord{TaggerInfo: tagger, Application: application, Backend: backend, InstalledAt: now}
+		if i, ok := byID[tagger.ID]; ok {
+			records[i] = rec
+			continue
+		}
+		byID[tagger.ID] = len(records)
+		records = append(records, rec)
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].ID < records[j].ID })
+
+	if err := os.MkdirAll(r.dir, os.ModePerm); err != nil {
+		return fmt.Errorf("failed to create tagger records directory: %v", err)
+	}
+
+	b, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	path := r.path(key)
+	if err := os.WriteFile(path+".tmp", b, 0664); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// InstallTaggers installs the taggers into the application like the package
+// level InstallTaggers and records them for Taggers and Tagger. A record that
+// cannot be written is logged, the taggers are installed nonetheless.
+func (s *Service) InstallTaggers(ctx context.Context, adpService *adp.Service, application string, taggers []adp.TaggerInfo) error {
+	if err := InstallTaggers(ctx, adpService, application, taggers); err != nil {
+		return err
+	}
+
+	if err := s.taggers.record(recordKey(ctx, application), application, backendOf(ctx), taggers); err != nil {
+		logging.Ctx(ctx).Error().Err(err).Msgf("failed to record taggers of %s", application)
+	}
+	return nil
+}
+
+// Taggers returns the taggers the service installed into the application on
+// the backend of ctx, sorted by ID.
+func (s *Service) Taggers(ctx context.Context, application string) ([]TaggerRecord, error) {
+	s.taggers.mu.Lock()
+	defer s.taggers.mu.Unlock()
+
+	return s.taggers.load(recordKey(ctx, application))
+}
+
+// Tagger returns the tagger with the ID the service installed into the
+// application, or ErrTaggerNotFound.
+func (s *Service) Tagger(ctx context.Context, application string, id string) (TaggerRecord, error) {
+	records, err := s.Taggers(ctx, application)
+	if err != nil {
+		return TaggerRecord{}, err
+	}
+
+	for _, rec := range records {
+		if rec.ID == id {
+			return rec, nil
+		}
+	}
+	return TaggerRecord{}, fmt.Errorf("%w: %s in %s", ErrTaggerNotFound, id, application)
+}
@@ -0,0 +1,50 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/xifanyan/adp"
+
+	"github.com/xifanyan/ediscovery-data-service/config"
+)
+
+func TestTaggerRecords(t *testing.T) {
+	s := &Service{taggers: newTaggerRecords(t.TempDir())}
+	ctx := WithBackend(context.Background(), config.DefaultADPBackend)
+	const app = "axcelerate.Matter1"
+
+	record := func(ctx context.Context, taggers ...adp.TaggerInfo) {
+		t.Helper()
+		if err := s.taggers.record(recordKey(ctx, app), app, backendOf(ctx), taggers); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	record(ctx, adp.TaggerInfo{ID: "b", Description: "first"}, adp.TaggerInfo{ID: "a"})
+	record(ctx, adp.TaggerInfo{ID: "b", Description: "updated"})
+	record(WithBackend(ctx, "emea"), adp.TaggerInfo{ID: "c"})
+
+	taggers, err := s.Taggers(ctx, app)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(taggers) != 2 || taggers[0].ID != "a" || taggers[1].ID != "b" {
+		t.Fatalf("Taggers() = %+v, want a and b", taggers)
+	}
+	if taggers[1].Description != "updated" {
+		t.Errorf("tagger b = %+v, installing it again replaces it", taggers[1])
+	}
+
+	if _, err := s.Tagger(ctx, app, "c"); !errors.Is(err, ErrTaggerNotFound) {
+		t.Errorf("Tagger() of another backend error = %v, want %v", err, ErrTaggerNotFound)
+	}
+	if rec, err := s.Tagger(WithBackend(ctx, "emea"), app, "c"); err != nil || rec.Backend != "emea" {
+		t.Errorf("Tagger() on emea = %+v, %v", rec, err)
+	}
+
+	if taggers, err := s.Taggers(ctx, "axcelerate.Other"); err != nil || len(taggers) != 0 {
+		t.Errorf("Taggers() of an application without taggers = %+v, %v", taggers, err)
+	}
+}
@@ -0,0 +1,135 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/xifanyan/adp"
+
+	"github.com/xifanyan/ediscovery-data-service/logging"
+)
+
+// VerifyTaggers checks that every tagger has an ID and that its term and type
+// taxonomies are among the taxonomies configured for the application.
+func VerifyTaggers(taggers []adp.TaggerInfo, taxonomies []string) error {
+	if len(taggers) == 0 {
+		return ErrTaggerRequired
+	}
+
+	var allowedTaxonomies map[string]struct{} = make(map[string]struct{})
+	for _, taxonomy := range taxonomies {
+		allowedTaxonomies[taxonomy] = struct{}{}
+	}
+
+	for _, tagger := range taggers {
+		if tagger.ID == "" {
+			return ErrTaggerIDRequired
+		}
+
+		if _, ok := allowedTaxonomies[tagger.TermTaxonomy]; !ok {
+			return fmt.Errorf("tagger %s: termTaxonomy %s is not a taxonomy of the application", tagger.ID, tagger.TermTaxonomy)
+		}
+
+		if _, ok := allowedTaxonomies[tagger.TypeTaxonomy]; !ok {
+			return fmt.Errorf("tagger %s: typeTaxonomy %s is not a taxonomy of the application", tagger.ID, tagger.TypeTaxonomy)
+		}
+	}
+
+	return nil
+}
+
+// InstallTaggers installs the given taggers into the application using the ADP
+// manage taggers task. Installing a tagger with an existing ID replaces it.
+func InstallTaggers(ctx context.Context, adpService *adp.Service, application string, taggers []adp.TaggerInfo) error {
+	js, err := json.Marshal(taggers)
+	if err != nil {
+		return err
+	}
+	logging.Ctx(ctx).Debug().Msgf("js: %+v", string(js))
+
+	parts := strings.Split(application, ".")
+	applicationType := parts[0]
+
+	return Exec(ctx, "ManageTaggers", func() error {
+		return adpService.ManageTaggers(
+			adp.WithAdpManTagsApplicationIdentifier(application),
+			adp.WithAdpManTagsApplicationType(applicationType),
+			adp.WithAdpManTagsJSONInstall(string(js)),
+			adp.WithAdpManTagsWait4Completion("true"),
+		)
+	})
+}
+
+// GetDataModel returns the ID of the dataModel entity related to the given application.
+func GetDataModel(ctx context.Context, adpService *adp.Service, app string) (string, error) {
+	entities, err := Call(ctx, "ListEntitiesByRelatedEntity", Bind2(adpService.ListEntitiesByRelatedEntity, "dataModel", app))
+	if err != nil {
+		return "", err
+	}
+
+	if len(entities) == 0 {
+		return "", ErrDataModelNotFound
+	}
+
+	dataModel := entities[0].ID
+	logging.Ctx(ctx).Debug().Msgf("get dataModel: %s", dataModel)
+
+	return dataModel, nil
+}
+
+// GetApplicationTaxonomies returns the names of all fields of the application's data model
+// that are shown in the structured view, i.e. the taxonomies of the application.
+func GetApplicationTaxonomies(ctx context.Context, adpService *adp.Service, app string) ([]string, error) {
+	dataModel, err := GetDataModel(ctx, adpService, app)
+	if err != nil {
+		return nil, err
+	}
+
+	props, err := Call(ctx, "GetIndexConfigurationTable", Bind(adpService.GetIndexConfigurationTable, dataModel))
+	if err != nil {
+		return nil, err
+	}
+
+	return StructuredViewTaxonomies(props), nil
+}
+
+// DataModel is GetDataModel served from the cache.
+func (s *Service) DataModel(c echo.Context, adpService *adp.Service, app string) (string, error) {
+	return Cached(s, c, CacheDataModel, func(ctx context.Context) (string, error) {
+		return GetDataModel(ctx, adpService, app)
+	}, app)
+}
+
+// ApplicationTaxonomies is GetApplicationTaxonomies served from the cache.
+func (s *Service) ApplicationTaxonomies(c echo.Context, adpService *adp.Service, app string) ([]string, error) {
+	dataModel, err := s.DataModel(c, adpService, app)
+	if err != nil {
+		return nil, err
+	}
+
+	props, err := Cached(s, c, CacheIndexConfiguration,
+		Observed("GetIndexConfigurationTable", Bind(adpService.GetIndexConfigurationTable, dataModel)), dataModel)
+	if err != nil {
+		return nil, err
+	}
+
+	return StructuredViewTaxonomies(props), nil
+}
+
+// StructuredViewTaxonomies returns the names of the fields of the index
+// configuration that are shown in the structured view, sorted so that the
+// same configuration always gives the same list and ETag.
+func StructuredViewTaxonomies(props map[string]adp.IndexConfiguration) []string {
+	taxonomies := []string{}
+	for key, prop := range props {
+		if prop.StructuredView {
+			taxonomies = append(taxonomies, key)
+		}
+	}
+	sort.Strings(taxonomies)
+	return taxonomies
+}
@@ -0,0 +1,174 @@
+// Package tlsconfig builds the TLS configuration of the server from the echo.tls
+// config section and reloads the certificate and client CA when their files
+// change.
+package tlsconfig
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/xifanyan/ediscovery-data-service/config"
+)
+
+const defaultReloadInterval = 30 * time.Second
+
+// Reloader serves the certificate and client CAs last loaded from their files.
+type Reloader struct {
+	cfg  config.TLS
+	base *tls.Config
+
+	mu        sync.RWMutex
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+	modTimes  map[string]time.Time
+}
+
+// New loads the certificate, key and client CA and returns the TLS config of
+// the server. The reloader picks up changed files once Run is started.
+func New(cfg config.TLS) (*tls.Config, *Reloader, error) {
+	minVersion, err := cfg.Version()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ciphers, err := cfg.Ciphers()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	r := &Reloader{cfg: cfg, modTimes: make(map[string]time.Time)}
+	if err := r.reload(); err != nil {
+		return nil, nil, err
+	}
+
+	r.base = &tls.Config{
+		MinVersion:     minVersion,
+		CipherSuites:   ciphers,
+		GetCertificate: r.getCertificate,
+	}
+
+	if cfg.ClientCA != "" {
+		r.base.ClientAuth = tls.VerifyClientCertIfGiven
+		if cfg.ClientAuth == "require" {
+			r.base.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+
+	serverConfig := r.base.Clone()
+	serverConfig.GetConfigForClient = r.getConfigForClient
+
+	return serverConfig, r, nil
+}
+
+// Run checks the files for changes every echo.tls.reloadInterval until ctx is
+// done. A failed reload keeps the certificate and client CAs loaded before.
+func (r *Reloader) Run(ctx context.Context) {
+	interval := defaultReloadInterval
+	if d, err := time.ParseDuration(r.cfg.ReloadInterval); err == nil && d > 0 {
+		interval = d
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !r.changed() {
+				continue
+			}
+			if err := r.reload(); err != nil {
+				log.Error().Err(err).Msg("failed to reload TLS certificates, keeping the current ones")
+				continue
+			}
+			log.Info().Msg("reloaded TLS certificates")
+		}
+	}
+}
+
+func (r *Reloader) files() []string {
+	files := []string{r.cfg.Cert, r.cfg.Key}
+	if r.cfg.ClientCA != "" {
+		files = append(files, r.cfg.ClientCA)
+	}
+	return files
+}
+
+func (r *Reloader) changed() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, f := range r.files() {
+		info, err := os.Stat(f)
+		if err != nil {
+			// a file being replaced is retried on the next tick
+			continue
+		}
+		if !info.ModTime().Equal(r.modTimes[f]) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Reloader) reload() error {
+	modTimes := make(map[string]time.Time)
+	for _, f := range r.files() {
+		info, err := os.Stat(f)
+		if err != nil {
+			return err
+		}
+		modTimes[f] = info.ModTime()
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.cfg.Cert, r.cfg.Key)
+	if err != nil {
+		return fmt.Errorf("failed to load echo.tls cert and key: %v", err)
+	}
+
+	var clientCAs *x509.CertPool
+	if r.cfg.ClientCA != "" {
+		pem, err := os.ReadFile(r.cfg.ClientCA)
+		if err != nil {
+			return fmt.Errorf("failed to read echo.tls.clientCA: %v", err)
+		}
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("echo.tls.clientCA %s has no PEM certificates", r.cfg.ClientCA)
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.cert = &cert
+	r.clientCAs = clientCAs
+	r.modTimes = modTimes
+
+	return nil
+}
+
+func (r *Reloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+// getConfigForClient hands every handshake the client CAs loaded last.
+func (r *Reloader) getConfigForClient(*tls.ClientHelloInfo) (*tls.Config, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	c := r.base.Clone()
+	c.ClientCAs = r.clientCAs
+	return c, nil
+}